@@ -0,0 +1,92 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/cloudevents/sdk-go/v2/event"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+const CorrelationIDExtension = "correlationid"
+
+// PartitionKeyExtension is the CloudEvents partitioning extension, the broker delivers events with the same key to
+// each subscriber in order
+const PartitionKeyExtension = "partitionkey"
+
+// CorrelationID returns the id linking an event to the request it answers, or an empty string if it has none
+func CorrelationID(event event.Event) string {
+	value, ok := event.Extensions()[CorrelationIDExtension]
+	if !ok {
+		return ""
+	}
+
+	id, ok := value.(string)
+	if !ok {
+		return ""
+	}
+
+	return id
+}
+
+// PartitionKey returns the key ordering an event relative to others, or an empty string if it has none
+func PartitionKey(event event.Event) string {
+	key, _ := event.Extensions()[PartitionKeyExtension].(string)
+	return key
+}
+
+// Request sends an event and waits for the first reply carrying the same correlation id, which is either a
+// "<type>.response" or a "<type>.rejection.response". Replies are only seen if HandleReply is listening on the
+// address they are routed to.
+func (e *Events) Request(ctx context.Context, eventType string, data interface{}, extensions ...map[string]interface{}) (event.Event, error) {
+	id := uuid.New().String()
+	replies := make(chan event.Event, 1)
+
+	e.pending.Store(id, replies)
+	defer e.pending.Delete(id)
+
+	extensions = append(extensions, map[string]interface{}{CorrelationIDExtension: id})
+
+	err := e.SendContext(ctx, eventType, data, extensions...)
+	if err != nil {
+		return event.Event{}, err
+	}
+
+	for {
+		select {
+		case reply := <-replies:
+			if strings.HasPrefix(reply.Type(), eventType+".") {
+				return reply, nil
+			}
+
+			logrus.Warnf("Ignoring unexpected reply %s to %s", reply.Type(), eventType)
+		case <-ctx.Done():
+			return event.Event{}, fmt.Errorf("no reply to %s: %+v", eventType, ctx.Err())
+		}
+	}
+}
+
+// HandleReply is an EventHandler which hands correlated replies back to the pending Request calls
+func (e *Events) HandleReply(ctx context.Context, reply event.Event) error {
+	id := CorrelationID(reply)
+	if id == "" {
+		logrus.Debugf("Ignoring uncorrelated event %s", reply.Type())
+		return nil
+	}
+
+	replies, ok := e.pending.Load(id)
+	if !ok {
+		logrus.Debugf("Ignoring reply %s, no pending request for %s", reply.Type(), id)
+		return nil
+	}
+
+	select {
+	case replies.(chan event.Event) <- reply:
+	default:
+		logrus.Warnf("Dropping reply %s, request %s already has a pending reply", reply.Type(), id)
+	}
+
+	return nil
+}
@@ -0,0 +1,78 @@
+package events
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+type pingRequest struct {
+	Message string `json:"message"`
+}
+
+type pingResponse struct {
+	Message string `json:"message"`
+}
+
+func TestRequest(t *testing.T) {
+	logrus.SetOutput(io.Discard)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	transport := NewMemoryTransport()
+	retry := RetryPolicy{Delay: 10 * time.Millisecond, MaxRetries: 100}
+
+	client, err := New(EventsArgs{
+		BrokerURL: "game",
+		Source:    "unit-tests",
+		Transport: transport,
+		Retry:     &retry,
+	})
+	assert.NoError(t, err)
+
+	_, err = transport.Listen(ctx, "client", client.HandleReply)
+	assert.NoError(t, err)
+
+	go Serve(ctx, ServeParams{
+		BrokerURL: "client",
+		Source:    "game",
+		Transport: transport,
+		Address:   "game",
+		Handlers: TypedRoutes{
+			"test.ping": Handle(func(ctx context.Context, userId string, request pingRequest) ([]Reply[pingResponse], error) {
+				if request.Message == "" {
+					return nil, Reject("empty message", nil)
+				}
+
+				return []Reply[pingResponse]{{UserId: userId, Data: pingResponse{Message: request.Message}}}, nil
+			}),
+		},
+	})
+
+	reply, err := client.Request(ctx, "test.ping", pingRequest{Message: "hello"}, map[string]interface{}{"userid": "user", PartitionKeyExtension: "game-1"})
+	assert.NoError(t, err)
+	assert.Equal(t, "test.ping.response", reply.Type())
+	assert.NotEmpty(t, CorrelationID(reply))
+	assert.Equal(t, "game-1", PartitionKey(reply))
+
+	data := pingResponse{}
+	assert.NoError(t, reply.DataAs(&data))
+	assert.Equal(t, "hello", data.Message)
+
+	reply, err = client.Request(ctx, "test.ping", pingRequest{}, map[string]interface{}{"userid": "user"})
+	assert.NoError(t, err)
+	assert.Equal(t, "test.ping.rejection.response", reply.Type())
+
+	reply, err = client.Request(ctx, "test.ping", map[string]string{"mesage": "hello"}, map[string]interface{}{"userid": "user"})
+	assert.NoError(t, err)
+	assert.Equal(t, "test.ping.rejection.response", reply.Type())
+
+	rejection := map[string]string{}
+	assert.NoError(t, reply.DataAs(&rejection))
+	assert.Equal(t, "invalid payload: message: missing required property", rejection["reason"])
+}
@@ -0,0 +1,129 @@
+package events
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	nethttp "net/http"
+
+	"github.com/cloudevents/sdk-go/v2/event"
+	"github.com/cloudevents/sdk-go/v2/protocol/http"
+	"github.com/sirupsen/logrus"
+)
+
+type Encoding int
+
+const (
+	// BinaryEncoding sends event attributes as ce- headers, with the data as the request body
+	BinaryEncoding Encoding = iota
+	// StructuredEncoding sends the whole event as an application/cloudevents+json body
+	StructuredEncoding
+)
+
+// TargetOptions controls how events are sent to a target. Targets which reply 415 Unsupported Media Type to
+// a compressed request or a batch are remembered, and sent plain, individual events from then on.
+type TargetOptions struct {
+	Encoding Encoding
+	// Gzip compresses request bodies
+	Gzip bool
+}
+
+// BatchTransport is implemented by transports which can deliver several events in a single request
+type BatchTransport interface {
+	SendBatch(ctx context.Context, target string, events []event.Event) error
+}
+
+type gzipKey struct{}
+
+func withGzip(ctx context.Context) context.Context {
+	return context.WithValue(ctx, gzipKey{}, true)
+}
+
+// gzipRoundTripper compresses the body of requests whose context was marked with withGzip
+type gzipRoundTripper struct {
+	next nethttp.RoundTripper
+}
+
+func (g gzipRoundTripper) RoundTrip(req *nethttp.Request) (*nethttp.Response, error) {
+	if compress, _ := req.Context().Value(gzipKey{}).(bool); !compress || req.Body == nil {
+		return g.next.RoundTrip(req)
+	}
+
+	var buffer bytes.Buffer
+	writer := gzip.NewWriter(&buffer)
+
+	_, err := io.Copy(writer, req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to compress request: %+v", err)
+	}
+
+	err = writer.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to compress request: %+v", err)
+	}
+
+	req = req.Clone(req.Context())
+	req.Body = io.NopCloser(&buffer)
+	req.GetBody = nil
+	req.ContentLength = int64(buffer.Len())
+	req.Header.Set("Content-Encoding", "gzip")
+
+	return g.next.RoundTrip(req)
+}
+
+// receiveMiddleware decompresses gzipped requests and unpacks batches of events, which the cloudevents
+// receiver doesn't handle itself
+func receiveMiddleware(receive func(event.Event) error) http.Middleware {
+	return func(next nethttp.Handler) nethttp.Handler {
+		return nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+			if r.Header.Get("Content-Encoding") == "gzip" {
+				body, err := gzip.NewReader(r.Body)
+				if err != nil {
+					nethttp.Error(w, "invalid gzip body", nethttp.StatusBadRequest)
+					return
+				}
+
+				r.Body = body
+				r.ContentLength = -1
+				r.Header.Del("Content-Encoding")
+				r.Header.Del("Content-Length")
+			}
+
+			mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+			if r.Method != nethttp.MethodPost || mediaType != event.ApplicationCloudEventsBatchJSON {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			batch := []event.Event{}
+			err := json.NewDecoder(r.Body).Decode(&batch)
+			if err != nil {
+				nethttp.Error(w, fmt.Sprintf("invalid batch: %+v", err), nethttp.StatusBadRequest)
+				return
+			}
+
+			for _, event := range batch {
+				if err := event.Validate(); err != nil {
+					nethttp.Error(w, fmt.Sprintf("invalid event in batch: %+v", err), nethttp.StatusBadRequest)
+					return
+				}
+			}
+
+			// a rejected event fails the whole batch, so earlier events will be redelivered with it
+			for _, event := range batch {
+				if err := receive(event); err != nil {
+					logrus.Errorf("Rejecting batch at %s: %+v", event.Type(), err)
+					nethttp.Error(w, err.Error(), RejectionStatus(err))
+					return
+				}
+			}
+
+			w.WriteHeader(nethttp.StatusOK)
+		})
+	}
+}
@@ -5,18 +5,29 @@ import (
 	"fmt"
 	nethttp "net/http"
 	"os"
+	"sync"
 	"time"
 
 	cloudevents "github.com/cloudevents/sdk-go/v2"
 	"github.com/cloudevents/sdk-go/v2/event"
 	"github.com/cloudevents/sdk-go/v2/protocol/http"
+	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type Events struct {
-	ctx    context.Context
-	sender cloudevents.Client
-	source string
+	ctx        context.Context
+	transport  Transport
+	target     string
+	source     string
+	retry      RetryPolicy
+	timeout    time.Duration
+	deadLetter DeadLetterSink
+	signer     *Signer
+	pending    sync.Map
 }
 
 type EventsArgs struct {
@@ -24,6 +35,16 @@ type EventsArgs struct {
 	BrokerURL string
 	Source    string
 	Cookies   nethttp.CookieJar
+	// Transport defaults to an HTTP transport using Cookies
+	Transport Transport
+	// Retry defaults to DefaultRetryPolicy
+	Retry *RetryPolicy
+	// Timeout optionally limits each delivery attempt, on top of any timeout in the transport
+	Timeout time.Duration
+	// DeadLetter optionally receives events which couldn't be delivered
+	DeadLetter DeadLetterSink
+	// Signer signs every event sent, defaults to SignerFromEnv
+	Signer *Signer
 }
 
 type Error string
@@ -48,65 +69,234 @@ func New(args EventsArgs) (*Events, error) {
 		return nil, fmt.Errorf("no broker url found, provide either BrokerEnv or BrokerURL")
 	}
 
-	ctx := cloudevents.ContextWithTarget(context.Background(), brokerUrl)
-
-	p, err := cloudevents.NewHTTP()
-	if err != nil {
-		return nil, fmt.Errorf("error connecting to NATS: %+v", err)
+	transport := args.Transport
+	if transport == nil {
+		var err error
+		transport, err = NewHTTPTransport(HTTPTransportArgs{Cookies: args.Cookies})
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	p.Client.Timeout = time.Second
-	p.Client.Jar = args.Cookies
+	retry := DefaultRetryPolicy
+	if args.Retry != nil {
+		retry = *args.Retry
+	}
 
-	client, err := cloudevents.NewClient(p, cloudevents.WithTimeNow(), cloudevents.WithUUIDs())
-	if err != nil {
-		return nil, fmt.Errorf("error creating cloudevents instance: %+v", err)
+	signer := args.Signer
+	if signer == nil {
+		var err error
+		signer, err = SignerFromEnv()
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	return &Events{
-		ctx:    ctx,
-		sender: client,
-		source: args.Source,
+		ctx:        context.Background(),
+		transport:  transport,
+		target:     brokerUrl,
+		source:     args.Source,
+		retry:      retry,
+		timeout:    args.Timeout,
+		deadLetter: args.DeadLetter,
+		signer:     signer,
 	}, nil
 }
 
 func (e *Events) Proxy(event event.Event) error {
-	ctx := cloudevents.ContextWithRetriesConstantBackoff(e.ctx, time.Second, 20)
-	res := e.sender.Send(ctx, event)
+	return e.ProxyContext(e.ctx, event)
+}
+
+// ProxyContext sends the event as part of the trace in ctx, or continues the trace already carried by the event
+// if ctx doesn't have one
+func (e *Events) ProxyContext(ctx context.Context, event event.Event) error {
+	event = e.prepare(event)
 
-	if cloudevents.IsUndelivered(res) {
-		return fmt.Errorf("failed to send event: %v", res.Error())
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		ctx = ExtractTrace(ctx, event)
 	}
 
-	var result *http.RetriesResult
-	if !cloudevents.ResultAs(res, &result) {
-		return fmt.Errorf("error decoding retries result %T: %+v", res, res)
+	ctx, span := StartSpan(ctx, "send "+event.Type(), trace.WithSpanKind(trace.SpanKindProducer), eventAttributes(event))
+	defer span.End()
+
+	InjectTrace(ctx, &event)
+
+	return e.deliver(span, []cloudevents.Event{event}, func() error {
+		ctx, cancel := e.attempt(ctx)
+		defer cancel()
+
+		// signed on each attempt, so that retries aren't refused as old
+		e.signer.Sign(&event)
+
+		return e.transport.Send(ctx, e.target, event)
+	})
+}
+
+// ProxyBatch sends the events in a single request if the transport supports batches, retrying the batch as a whole
+func (e *Events) ProxyBatch(ctx context.Context, events []event.Event) error {
+	batcher, ok := e.transport.(BatchTransport)
+	if !ok || len(events) == 1 {
+		for _, event := range events {
+			err := e.ProxyContext(ctx, event)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
 	}
 
-	var final *http.Result
-	if !cloudevents.ResultAs(result.Result, &final) {
-		return fmt.Errorf("error decoding final result %T: %+v", res, res)
+	ctx, span := StartSpan(ctx, "send batch", trace.WithSpanKind(trace.SpanKindProducer), trace.WithAttributes(attribute.Int("event.count", len(events))))
+	defer span.End()
+
+	batch := make([]event.Event, len(events))
+	for i, event := range events {
+		batch[i] = e.prepare(event)
+		InjectTrace(ctx, &batch[i])
 	}
 
-	if cloudevents.IsNACK(res) {
-		if final.StatusCode == 401 {
-			return UnauthorizedError
-		} else {
-			return fmt.Errorf("event for %s not acknowledged: %d", event.Type(), final.StatusCode)
+	return e.deliver(span, batch, func() error {
+		ctx, cancel := e.attempt(ctx)
+		defer cancel()
+
+		for i := range batch {
+			e.signer.Sign(&batch[i])
 		}
+
+		return batcher.SendBatch(ctx, e.target, batch)
+	})
+}
+
+func (e *Events) attempt(ctx context.Context) (context.Context, context.CancelFunc) {
+	if e.timeout == 0 {
+		return context.WithCancel(ctx)
 	}
 
-	retriesString := ""
-	if result.Retries > 0 {
-		retriesString = fmt.Sprintf(" (%d attempts)", result.Retries)
+	return context.WithTimeout(ctx, e.timeout)
+}
+
+func (e *Events) prepare(event event.Event) event.Event {
+	event = event.Clone()
+	if event.ID() == "" {
+		// keep the same id across retries so that receivers can de-duplicate
+		event.SetID(uuid.New().String())
 	}
 
-	logrus.Infof("Sent %s with status: %d%s", event.Type(), final.StatusCode, retriesString)
+	return event
+}
+
+// deliver calls send until it succeeds or the retry policy gives up, then hands the events to the dead letter sink
+func (e *Events) deliver(span trace.Span, events []event.Event, send func() error) error {
+	start := time.Now()
+	attempts := 0
+
+	var err error
+	for {
+		attempts += 1
+
+		if attempts > 1 {
+			for _, event := range events {
+				retryCounter.WithLabelValues(event.Type()).Inc()
+			}
+		}
+
+		err = send()
+		if err == nil {
+			if attempts > 1 {
+				logrus.Infof("Sent %s after %d attempts", describe(events), attempts)
+			}
+
+			span.SetAttributes(attribute.Int("event.attempts", attempts))
+
+			for _, event := range events {
+				sentCounter.WithLabelValues(event.Type(), result(nil)).Inc()
+			}
+			return nil
+		}
+
+		for _, event := range events {
+			observeNack(event.Type(), err)
+		}
+
+		if !e.retry.retryable(StatusCode(err)) || attempts > e.retry.MaxRetries {
+			break
+		}
 
-	return nil
+		delay := e.retry.delay(attempts - 1)
+		if e.retry.MaxElapsed > 0 && time.Since(start)+delay > e.retry.MaxElapsed {
+			break
+		}
+
+		time.Sleep(delay)
+	}
+
+	span.SetAttributes(attribute.Int("event.attempts", attempts))
+	span.RecordError(err)
+	span.SetStatus(codes.Error, "delivery failed")
+
+	for _, event := range events {
+		sentCounter.WithLabelValues(event.Type(), result(err)).Inc()
+
+		if e.deadLetter == nil {
+			continue
+		}
+
+		deadLetterCounter.WithLabelValues(event.Type()).Inc()
+		dlErr := e.deadLetter.DeadLetter(event, DeliveryFailure{
+			Target:     e.target,
+			StatusCode: StatusCode(err),
+			Attempts:   attempts,
+			Err:        err,
+		})
+		if dlErr != nil {
+			logrus.Errorf("Failed to dead-letter %s for %s: %+v", event.Type(), e.target, dlErr)
+		}
+	}
+
+	if StatusCode(err) == 401 {
+		return UnauthorizedError
+	}
+
+	return err
+}
+
+func describe(events []event.Event) string {
+	if len(events) == 1 {
+		return events[0].Type()
+	}
+
+	return fmt.Sprintf("batch of %d events", len(events))
+}
+
+// DeadLetter forwards an undeliverable event to this client's target, with the failure details attached as extensions
+func (e *Events) DeadLetter(event event.Event, failure DeliveryFailure) error {
+	event = event.Clone()
+	event.SetExtension("deadlettertarget", failure.Target)
+	event.SetExtension("deadletterstatus", failure.StatusCode)
+	event.SetExtension("deadletterattempts", failure.Attempts)
+	event.SetExtension("deadletterreason", failure.Err.Error())
+	e.signer.Sign(&event)
+
+	return e.transport.Send(e.ctx, e.target, event)
 }
 
 func (e *Events) Send(eventType string, data interface{}, extensions ...map[string]interface{}) error {
+	return e.SendContext(e.ctx, eventType, data, extensions...)
+}
+
+// SendContext sends a new event as part of the trace in ctx
+func (e *Events) SendContext(ctx context.Context, eventType string, data interface{}, extensions ...map[string]interface{}) error {
+	event, err := e.NewEvent(eventType, data, extensions...)
+	if err != nil {
+		return err
+	}
+
+	return e.ProxyContext(ctx, event)
+}
+
+// NewEvent builds an event from this client's source, stamped with a correlation id unless one is given
+func (e *Events) NewEvent(eventType string, data interface{}, extensions ...map[string]interface{}) (event.Event, error) {
 	event := cloudevents.NewEvent()
 	event.SetType(eventType)
 	event.SetSource(e.source)
@@ -117,42 +307,29 @@ func (e *Events) Send(eventType string, data interface{}, extensions ...map[stri
 		}
 	}
 
+	if CorrelationID(event) == "" {
+		event.SetExtension(CorrelationIDExtension, uuid.New().String())
+	}
+
 	if data != nil {
 		err := event.SetData(cloudevents.ApplicationJSON, data)
 		if err != nil {
-			return fmt.Errorf("failed to serialize event data: %+v", err)
+			return event, fmt.Errorf("failed to serialize event data: %+v", err)
 		}
 	}
 
-	return e.Proxy(event)
+	return event, nil
 }
 
-type EventHandler func(ctx context.Context, event event.Event)
+// EventHandler processes a received event. Returning an error rejects the event, so that the sender retries it.
+type EventHandler func(ctx context.Context, event event.Event) error
 
-func Listen(port int, handler EventHandler) (context.CancelFunc, error) {
-	p, err := cloudevents.NewHTTP(cloudevents.WithPort(port))
+// Listen receives events over HTTP on the given port, see HTTPTransport.Listen
+func Listen(ctx context.Context, port int, handler EventHandler, options ...http.Option) (<-chan error, error) {
+	transport, err := NewHTTPTransport(HTTPTransportArgs{ListenOptions: options})
 	if err != nil {
-		return nil, fmt.Errorf("failed to create protocol: %s", err.Error())
+		return nil, err
 	}
 
-	client, err := cloudevents.NewClient(p)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create client, %v", err)
-	}
-
-	ctx, cancel := context.WithCancel(context.Background())
-
-	go func() {
-		err := client.StartReceiver(ctx, handler)
-
-		if err != nil && ctx.Err() == nil {
-			logrus.Fatalf("Error in event listener: %+v", err)
-		} else {
-			logrus.Infof("Stopped event listener")
-		}
-	}()
-
-	logrus.Infof("Listening on port %d...", port)
-
-	return cancel, nil
+	return transport.Listen(ctx, fmt.Sprintf(":%d", port), handler)
 }
@@ -0,0 +1,185 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/cloudevents/sdk-go/v2/event"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+type stubTransport struct {
+	statusCodes []int
+	attempts    int
+	// delay makes each send hang for this long, unless the context ends first
+	delay time.Duration
+}
+
+func (t *stubTransport) Send(ctx context.Context, target string, event event.Event) error {
+	t.attempts += 1
+
+	select {
+	case <-time.After(t.delay):
+	case <-ctx.Done():
+		return &DeliveryError{Err: ctx.Err()}
+	}
+
+	if len(t.statusCodes) == 0 {
+		return nil
+	}
+
+	code := t.statusCodes[0]
+	t.statusCodes = t.statusCodes[1:]
+
+	return &DeliveryError{StatusCode: code, Err: fmt.Errorf("status %d", code)}
+}
+
+func (t *stubTransport) Listen(ctx context.Context, address string, handler EventHandler) (<-chan error, error) {
+	return nil, nil
+}
+
+type stubSink struct {
+	failures []DeliveryFailure
+}
+
+func (s *stubSink) DeadLetter(event event.Event, failure DeliveryFailure) error {
+	s.failures = append(s.failures, failure)
+	return nil
+}
+
+func TestProxyRetries(t *testing.T) {
+	logrus.SetOutput(io.Discard)
+
+	for _, test := range []struct {
+		name        string
+		statusCodes []int
+		policy      RetryPolicy
+		attempts    int
+		deadLetters int
+		err         error
+	}{
+		{
+			name:     "delivered",
+			policy:   RetryPolicy{Delay: time.Millisecond, MaxRetries: 3},
+			attempts: 1,
+		},
+		{
+			name:        "retried until delivered",
+			statusCodes: []int{0, 503},
+			policy:      RetryPolicy{Delay: time.Millisecond, MaxRetries: 3},
+			attempts:    3,
+		},
+		{
+			name:        "retries exhausted",
+			statusCodes: []int{503, 503, 503, 503, 503},
+			policy:      RetryPolicy{Backoff: ExponentialBackoff, Delay: time.Millisecond, Jitter: 0.5, MaxRetries: 3},
+			attempts:    4,
+			deadLetters: 1,
+		},
+		{
+			name:        "max elapsed",
+			statusCodes: []int{503, 503, 503, 503, 503},
+			policy:      RetryPolicy{Delay: 20 * time.Millisecond, MaxRetries: 10, MaxElapsed: 30 * time.Millisecond},
+			attempts:    2,
+			deadLetters: 1,
+		},
+		{
+			name:        "not retryable",
+			statusCodes: []int{400},
+			policy:      RetryPolicy{Delay: time.Millisecond, MaxRetries: 3},
+			attempts:    1,
+			deadLetters: 1,
+		},
+		{
+			name:        "unauthorized",
+			statusCodes: []int{401},
+			policy:      RetryPolicy{Delay: time.Millisecond, MaxRetries: 3},
+			attempts:    1,
+			deadLetters: 1,
+			err:         UnauthorizedError,
+		},
+	} {
+		t.Run(test.name, func(u *testing.T) {
+			transport := &stubTransport{statusCodes: test.statusCodes}
+			sink := &stubSink{}
+
+			client, err := New(EventsArgs{
+				BrokerURL:  "broker",
+				Transport:  transport,
+				Retry:      &test.policy,
+				DeadLetter: sink,
+			})
+			assert.NoError(u, err)
+
+			event := cloudevents.NewEvent()
+			event.SetType("test.event")
+			event.SetSource("unit-tests")
+
+			err = client.Proxy(event)
+			if test.deadLetters == 0 {
+				assert.NoError(u, err)
+			} else if test.err != nil {
+				assert.Equal(u, test.err, err)
+			} else {
+				assert.Error(u, err)
+			}
+
+			assert.Equal(u, test.attempts, transport.attempts)
+			assert.Equal(u, test.deadLetters, len(sink.failures))
+		})
+	}
+}
+
+func TestProxyTimeout(t *testing.T) {
+	logrus.SetOutput(io.Discard)
+
+	transport := &stubTransport{delay: time.Second}
+
+	client, err := New(EventsArgs{
+		BrokerURL: "broker",
+		Transport: transport,
+		Retry:     &RetryPolicy{Delay: time.Millisecond, MaxRetries: 1},
+		Timeout:   10 * time.Millisecond,
+	})
+	assert.NoError(t, err)
+
+	event := cloudevents.NewEvent()
+	event.SetType("test.event")
+	event.SetSource("unit-tests")
+
+	start := time.Now()
+	err = client.Proxy(event)
+
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, 2, transport.attempts)
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestProxyMetrics(t *testing.T) {
+	logrus.SetOutput(io.Discard)
+
+	transport := &stubTransport{statusCodes: []int{503, 503}}
+
+	client, err := New(EventsArgs{
+		BrokerURL: "broker",
+		Transport: transport,
+		Retry:     &RetryPolicy{Delay: time.Millisecond, MaxRetries: 3},
+	})
+	assert.NoError(t, err)
+
+	event := cloudevents.NewEvent()
+	event.SetType("test.metrics")
+	event.SetSource("unit-tests")
+
+	assert.NoError(t, client.Proxy(event))
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(sentCounter.WithLabelValues("test.metrics", "ok")))
+	assert.Equal(t, 2.0, testutil.ToFloat64(retryCounter.WithLabelValues("test.metrics")))
+	assert.Equal(t, 2.0, testutil.ToFloat64(nackCounter.WithLabelValues("test.metrics", "503")))
+}
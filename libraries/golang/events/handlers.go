@@ -0,0 +1,102 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+type Empty struct{}
+
+type Reply[T any] struct {
+	UserId string
+	Data   T
+}
+
+type Handler[Req any, Res any] func(ctx context.Context, userId string, request Req) ([]Reply[Res], error)
+
+// Validator can be implemented by request types to reject a payload after it has been decoded
+type Validator interface {
+	Validate() error
+}
+
+type Rejection struct {
+	Reason string
+	Err    error
+}
+
+func (r *Rejection) Error() string {
+	if r.Err == nil {
+		return r.Reason
+	}
+
+	return r.Err.Error()
+}
+
+func (r *Rejection) Unwrap() error { return r.Err }
+
+// Reject returns an error which is sent back to the user as a rejection.response with the given reason
+func Reject(reason string, err error) error {
+	return &Rejection{Reason: reason, Err: err}
+}
+
+type TypedRoute struct {
+	Route  EventRoute
+	Schema RouteSchema
+}
+
+type TypedRoutes map[string]TypedRoute
+
+func Handle[Req any, Res any](handler Handler[Req, Res]) TypedRoute {
+	return TypedRoute{
+		Route: func(ctx context.Context, userId string, into EventParser) ([]Response, error) {
+			var request Req
+
+			err := into(&request)
+			if err != nil {
+				return rejectionResponses(userId, "invalid payload"), fmt.Errorf("failed to parse payload data from event: %+v", err)
+			}
+
+			if validator, ok := any(&request).(Validator); ok {
+				err = validator.Validate()
+				if err != nil {
+					return rejectionResponses(userId, err.Error()), fmt.Errorf("invalid payload from user %s: %+v", userId, err)
+				}
+			}
+
+			replies, err := handler(ctx, userId, request)
+			if err != nil {
+				var rejection *Rejection
+				if errors.As(err, &rejection) {
+					return rejectionResponses(userId, rejection.Reason), err
+				}
+
+				return rejectionResponses(userId, "server error"), err
+			}
+
+			responses := []Response{}
+			for _, reply := range replies {
+				responses = append(responses, Response{
+					EventType: "response",
+					Data:      reply.Data,
+					UserId:    reply.UserId,
+				})
+			}
+
+			return responses, nil
+		},
+		Schema: RouteSchema{
+			Request:  SchemaOf(reflect.TypeOf((*Req)(nil)).Elem()),
+			Response: SchemaOf(reflect.TypeOf((*Res)(nil)).Elem()),
+		},
+	}
+}
+
+func rejectionResponses(userId string, reason string) []Response {
+	return []Response{{
+		EventType: "rejection.response",
+		Data:      map[string]interface{}{"reason": reason},
+		UserId:    userId,
+	}}
+}
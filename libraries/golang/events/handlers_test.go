@@ -0,0 +1,166 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testRequest struct {
+	Position int `json:"position"`
+}
+
+func (r *testRequest) Validate() error {
+	if r.Position < 0 {
+		return errors.New("illegal position")
+	}
+
+	return nil
+}
+
+type testResponse struct {
+	Marks string `json:"marks"`
+}
+
+func TestHandle(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		payload  string
+		handler  Handler[testRequest, testResponse]
+		expected []Response
+		err      bool
+	}{
+		{
+			name:    "replies",
+			payload: `{"position": 3}`,
+			handler: func(ctx context.Context, userId string, request testRequest) ([]Reply[testResponse], error) {
+				return []Reply[testResponse]{{UserId: userId, Data: testResponse{Marks: "---0-----"}}}, nil
+			},
+			expected: []Response{{EventType: "response", Data: testResponse{Marks: "---0-----"}, UserId: "user"}},
+		},
+		{
+			name:     "bad payload",
+			payload:  `{"position": "three"}`,
+			expected: []Response{{EventType: "rejection.response", Data: map[string]interface{}{"reason": "invalid payload"}, UserId: "user"}},
+			err:      true,
+		},
+		{
+			name:     "failed validation",
+			payload:  `{"position": -1}`,
+			expected: []Response{{EventType: "rejection.response", Data: map[string]interface{}{"reason": "illegal position"}, UserId: "user"}},
+			err:      true,
+		},
+		{
+			name:    "rejected",
+			payload: `{"position": 3}`,
+			handler: func(ctx context.Context, userId string, request testRequest) ([]Reply[testResponse], error) {
+				return nil, Reject("already played", errors.New("position 3 was already played"))
+			},
+			expected: []Response{{EventType: "rejection.response", Data: map[string]interface{}{"reason": "already played"}, UserId: "user"}},
+			err:      true,
+		},
+		{
+			name:    "server error",
+			payload: `{"position": 3}`,
+			handler: func(ctx context.Context, userId string, request testRequest) ([]Reply[testResponse], error) {
+				return nil, errors.New("database down")
+			},
+			expected: []Response{{EventType: "rejection.response", Data: map[string]interface{}{"reason": "server error"}, UserId: "user"}},
+			err:      true,
+		},
+	} {
+		t.Run(test.name, func(u *testing.T) {
+			route := Handle(test.handler)
+
+			responses, err := route.Route(context.Background(), "user", func(obj interface{}) error {
+				return json.Unmarshal([]byte(test.payload), obj)
+			})
+
+			assert.Equal(u, test.err, err != nil)
+			assert.Equal(u, test.expected, responses)
+		})
+	}
+}
+
+func TestSchemaOf(t *testing.T) {
+	route := Handle(Handler[testRequest, testResponse](nil))
+
+	assert.Equal(t, &Schema{
+		Type:       "object",
+		Properties: map[string]*Schema{"position": {Type: "integer"}},
+		Required:   []string{"position"},
+		Closed:     true,
+	}, route.Schema.Request)
+
+	assert.Equal(t, &Schema{
+		Type:       "object",
+		Properties: map[string]*Schema{"marks": {Type: "string"}},
+		Required:   []string{"marks"},
+		Closed:     true,
+	}, route.Schema.Response)
+}
+
+type testMove struct {
+	Game  string    `json:"game"`
+	Moves []testPos `json:"moves"`
+	Note  *string   `json:"note"`
+}
+
+type testPos struct {
+	X int `json:"x"`
+	Y int `json:"y,omitempty"`
+}
+
+func TestSchemaValidate(t *testing.T) {
+	schema := SchemaOf(reflect.TypeOf(testMove{}))
+
+	for _, test := range []struct {
+		name    string
+		payload string
+		err     string
+	}{
+		{name: "valid", payload: `{"game": "abc", "moves": [{"x": 1, "y": 2}], "note": null}`},
+		{name: "optional fields", payload: `{"game": "abc", "moves": [{"x": 1}]}`},
+		{name: "missing field", payload: `{"moves": []}`, err: "game: missing required property"},
+		{name: "typo", payload: `{"game": "abc", "moves": [], "mvoes": []}`, err: "mvoes: unexpected property"},
+		{name: "wrong type", payload: `{"game": "abc", "moves": [{"x": "one"}]}`, err: "moves[0].x: expected an integer"},
+		{name: "fraction", payload: `{"game": "abc", "moves": [{"x": 1.5}]}`, err: "moves[0].x: expected an integer"},
+		{name: "not an object", payload: `"abc"`, err: "expected an object"},
+	} {
+		t.Run(test.name, func(u *testing.T) {
+			var value interface{}
+			assert.NoError(u, json.Unmarshal([]byte(test.payload), &value))
+
+			err := schema.Validate(value)
+			if test.err == "" {
+				assert.NoError(u, err)
+			} else {
+				assert.EqualError(u, err, test.err)
+			}
+		})
+	}
+}
+
+func TestSchemaJSON(t *testing.T) {
+	schema := SchemaOf(reflect.TypeOf(map[string]testPos{}))
+
+	data, err := json.Marshal(schema)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{
+		"type": "object",
+		"additionalProperties": {
+			"type": "object",
+			"properties": {"x": {"type": "integer"}, "y": {"type": "integer"}},
+			"required": ["x"],
+			"additionalProperties": false
+		}
+	}`, string(data))
+
+	decoded := &Schema{}
+	assert.NoError(t, json.Unmarshal(data, decoded))
+	assert.Equal(t, schema, decoded)
+}
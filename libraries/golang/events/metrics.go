@@ -0,0 +1,72 @@
+package events
+
+import (
+	"errors"
+	nethttp "net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	sentCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "events_sent_total",
+		Help: "Events sent, by type and whether they were eventually delivered",
+	}, []string{"type", "result"})
+
+	retryCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "events_send_retries_total",
+		Help: "Delivery attempts made after the first, by event type",
+	}, []string{"type"})
+
+	nackCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "events_nacks_total",
+		Help: "Delivery attempts rejected or not delivered, by event type and status code (0 if undelivered)",
+	}, []string{"type", "status"})
+
+	deadLetterCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "events_dead_lettered_total",
+		Help: "Events handed to a dead letter sink, by type",
+	}, []string{"type"})
+
+	receivedCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "events_received_total",
+		Help: "Events received by listeners, by type",
+	}, []string{"type"})
+
+	handlerHistogram = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "events_handler_duration_seconds",
+		Help:    "Time taken by routes to handle events, by type and result",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"type", "result"})
+)
+
+func init() {
+	prometheus.MustRegister(sentCounter, retryCounter, nackCounter, deadLetterCounter, receivedCounter, handlerHistogram)
+}
+
+// MetricsHandler serves the metrics recorded by this library, and any others registered with the default prometheus registry
+func MetricsHandler() nethttp.Handler {
+	return promhttp.Handler()
+}
+
+func result(err error) string {
+	if err != nil {
+		return "failed"
+	}
+
+	return "ok"
+}
+
+func observeNack(eventType string, err error) {
+	var delivery *DeliveryError
+	if errors.As(err, &delivery) {
+		nackCounter.WithLabelValues(eventType, strconv.Itoa(delivery.StatusCode)).Inc()
+	}
+}
+
+func observeHandler(eventType string, duration time.Duration, err error) {
+	handlerHistogram.WithLabelValues(eventType, result(err)).Observe(duration.Seconds())
+}
@@ -0,0 +1,155 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/cloudevents/sdk-go/v2/event"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/time/rate"
+)
+
+// Middleware wraps the route for an event type, e.g. to add logging or reject requests before they reach it
+type Middleware func(eventType string, next EventRoute) EventRoute
+
+// Chain wraps a route in middlewares, the first middleware being the outermost
+func Chain(eventType string, route EventRoute, middlewares ...Middleware) EventRoute {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		route = middlewares[i](eventType, route)
+	}
+
+	return route
+}
+
+type eventContextKey struct{}
+
+func contextWithEvent(ctx context.Context, event event.Event) context.Context {
+	return context.WithValue(ctx, eventContextKey{}, event)
+}
+
+// EventFromContext returns the event being routed, for middlewares that need more than the user id and payload
+func EventFromContext(ctx context.Context) (event.Event, bool) {
+	event, ok := ctx.Value(eventContextKey{}).(event.Event)
+	return event, ok
+}
+
+// Recover turns a panic in a route into a "server error" rejection instead of crashing the service
+func Recover() Middleware {
+	return func(eventType string, next EventRoute) EventRoute {
+		return func(ctx context.Context, userId string, into EventParser) (responses []Response, err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					logrus.Errorf("recovered from panic in %s route: %v\n%s", eventType, r, debug.Stack())
+					responses = rejectionResponses(userId, "server error")
+					err = fmt.Errorf("panic in %s route: %v", eventType, r)
+				}
+			}()
+
+			return next(ctx, userId, into)
+		}
+	}
+}
+
+// Logging writes a structured log line for every routed event
+func Logging() Middleware {
+	return func(eventType string, next EventRoute) EventRoute {
+		return func(ctx context.Context, userId string, into EventParser) ([]Response, error) {
+			start := time.Now()
+			responses, err := next(ctx, userId, into)
+
+			fields := logrus.Fields{
+				"type":      eventType,
+				"user":      userId,
+				"duration":  time.Since(start),
+				"responses": len(responses),
+				"failed":    err != nil,
+			}
+
+			if event, ok := EventFromContext(ctx); ok {
+				fields["id"] = event.ID()
+				fields["source"] = event.Source()
+			}
+
+			logrus.WithFields(fields).Info("Handled event")
+
+			return responses, err
+		}
+	}
+}
+
+// Timing reports how long each route took to handle an event
+func Timing(observe func(eventType string, duration time.Duration, err error)) Middleware {
+	return func(eventType string, next EventRoute) EventRoute {
+		return func(ctx context.Context, userId string, into EventParser) ([]Response, error) {
+			start := time.Now()
+			responses, err := next(ctx, userId, into)
+			observe(eventType, time.Since(start), err)
+
+			return responses, err
+		}
+	}
+}
+
+// RateLimit rejects events from users sending more than the given rate, allowing bursts of up to burst events.
+// Limits are tracked per user across all routes the middleware wraps.
+func RateLimit(limit rate.Limit, burst int) Middleware {
+	limiters := &userLimiters{
+		limit:    limit,
+		burst:    burst,
+		limiters: map[string]*userLimiter{},
+	}
+
+	return func(eventType string, next EventRoute) EventRoute {
+		return func(ctx context.Context, userId string, into EventParser) ([]Response, error) {
+			if !limiters.allow(userId) {
+				return rejectionResponses(userId, "rate limited"), fmt.Errorf("user %s exceeded the rate limit for %s", userId, eventType)
+			}
+
+			return next(ctx, userId, into)
+		}
+	}
+}
+
+type userLimiter struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+type userLimiters struct {
+	lock     sync.Mutex
+	limit    rate.Limit
+	burst    int
+	limiters map[string]*userLimiter
+	pruned   time.Time
+}
+
+func (u *userLimiters) allow(userId string) bool {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+
+	now := time.Now()
+
+	// forget users who haven't sent anything for a while so the map doesn't grow forever
+	if now.Sub(u.pruned) > time.Minute {
+		for id, limiter := range u.limiters {
+			if now.Sub(limiter.lastSeen) > time.Minute {
+				delete(u.limiters, id)
+			}
+		}
+
+		u.pruned = now
+	}
+
+	limiter, ok := u.limiters[userId]
+	if !ok {
+		limiter = &userLimiter{limiter: rate.NewLimiter(u.limit, u.burst)}
+		u.limiters[userId] = limiter
+	}
+
+	limiter.lastSeen = now
+
+	return limiter.limiter.AllowN(now, 1)
+}
@@ -0,0 +1,70 @@
+package events
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func noData(obj interface{}) error { return nil }
+
+func TestChainOrder(t *testing.T) {
+	calls := []string{}
+
+	named := func(name string) Middleware {
+		return func(eventType string, next EventRoute) EventRoute {
+			return func(ctx context.Context, userId string, into EventParser) ([]Response, error) {
+				calls = append(calls, name)
+				return next(ctx, userId, into)
+			}
+		}
+	}
+
+	route := Chain("test.event", func(ctx context.Context, userId string, into EventParser) ([]Response, error) {
+		calls = append(calls, "route")
+		return nil, nil
+	}, named("first"), named("second"))
+
+	_, err := route(context.Background(), "user", noData)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"first", "second", "route"}, calls)
+}
+
+func TestRecover(t *testing.T) {
+	logrus.SetOutput(io.Discard)
+
+	route := Chain("test.event", func(ctx context.Context, userId string, into EventParser) ([]Response, error) {
+		panic("index out of range")
+	}, Recover())
+
+	responses, err := route(context.Background(), "user", noData)
+	assert.Error(t, err)
+	assert.Equal(t, rejectionResponses("user", "server error"), responses)
+}
+
+func TestRateLimit(t *testing.T) {
+	route := Chain("test.event", func(ctx context.Context, userId string, into EventParser) ([]Response, error) {
+		return nil, nil
+	}, RateLimit(0.001, 2))
+
+	for _, test := range []struct {
+		user    string
+		limited bool
+	}{
+		{user: "user", limited: false},
+		{user: "user", limited: false},
+		{user: "other", limited: false},
+		{user: "user", limited: true},
+	} {
+		responses, err := route(context.Background(), test.user, noData)
+		if test.limited {
+			assert.Error(t, err)
+			assert.Equal(t, rejectionResponses(test.user, "rate limited"), responses)
+		} else {
+			assert.NoError(t, err)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	nethttp "net/http"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Registry holds the schemas of event types, grouped by the service which declared them
+type Registry struct {
+	lock    sync.RWMutex
+	sources map[string]map[string]RouteSchema
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		sources: map[string]map[string]RouteSchema{},
+	}
+}
+
+// Set replaces the schemas declared by source
+func (r *Registry) Set(source string, schemas map[string]RouteSchema) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.sources[source] = schemas
+}
+
+func (r *Registry) Remove(source string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	delete(r.sources, source)
+}
+
+func (r *Registry) Schemas() map[string]RouteSchema {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	schemas := map[string]RouteSchema{}
+	for _, source := range r.sources {
+		for eventType, schema := range source {
+			schemas[eventType] = schema
+		}
+	}
+
+	return schemas
+}
+
+func (r *Registry) Lookup(eventType string) (RouteSchema, bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	for _, source := range r.sources {
+		if schema, ok := source[eventType]; ok {
+			return schema, true
+		}
+	}
+
+	return RouteSchema{}, false
+}
+
+// Validate checks an event payload against the request schema for its type. Event types without a schema are
+// always valid.
+func (r *Registry) Validate(eventType string, data []byte) error {
+	schema, ok := r.Lookup(eventType)
+	if !ok || schema.Request == nil {
+		return nil
+	}
+
+	var value interface{}
+	if len(data) > 0 {
+		err := json.Unmarshal(data, &value)
+		if err != nil {
+			return errors.New("malformed json")
+		}
+	}
+
+	return schema.Request.Validate(value)
+}
+
+// ServeHTTP serves every schema in the registry as a JSON object keyed by event type
+func (r *Registry) ServeHTTP(w nethttp.ResponseWriter, req *nethttp.Request) {
+	data, err := json.Marshal(r.Schemas())
+	if err != nil {
+		logrus.Errorf("failed to serialise route schemas: %+v", err)
+		w.WriteHeader(nethttp.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+// FetchSchemas loads the schemas served on GET /schemas by a service or broker
+func FetchSchemas(ctx context.Context, url string) (map[string]RouteSchema, error) {
+	req, err := nethttp.NewRequestWithContext(ctx, nethttp.MethodGet, strings.TrimSuffix(url, "/")+"/schemas", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create schema request: %+v", err)
+	}
+
+	res, err := nethttp.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch schemas: %+v", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != nethttp.StatusOK {
+		return nil, fmt.Errorf("failed to fetch schemas: status %d", res.StatusCode)
+	}
+
+	schemas := map[string]RouteSchema{}
+	err = json.NewDecoder(res.Body).Decode(&schemas)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode schemas: %+v", err)
+	}
+
+	return schemas, nil
+}
@@ -0,0 +1,130 @@
+package events
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	nethttp "net/http"
+	"time"
+
+	"github.com/cloudevents/sdk-go/v2/event"
+)
+
+type Backoff int
+
+const (
+	ConstantBackoff Backoff = iota
+	ExponentialBackoff
+)
+
+type RetryPolicy struct {
+	Backoff Backoff
+	// Delay is the constant delay, or the first delay for exponential backoff
+	Delay time.Duration
+	// MaxDelay caps exponential backoff, zero for no cap
+	MaxDelay time.Duration
+	// Jitter randomises each delay by up to this fraction of its length, e.g. 0.2 for +/-20%
+	Jitter     float64
+	MaxRetries int
+	// MaxElapsed stops retrying once the next attempt would start after this long, zero for no limit
+	MaxElapsed time.Duration
+	// Retryable decides whether a failed delivery is retried, defaults to DefaultRetryable
+	Retryable func(statusCode int) bool
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	Backoff:    ConstantBackoff,
+	Delay:      time.Second,
+	MaxRetries: 20,
+}
+
+// DefaultRetryable retries events which couldn't be delivered at all (status code 0) and status codes
+// indicating the subscriber is temporarily unavailable
+func DefaultRetryable(statusCode int) bool {
+	switch statusCode {
+	case 0, 404, 408, 425, 429, 500, 502, 503, 504:
+		return true
+	default:
+		return false
+	}
+}
+
+func (p RetryPolicy) retryable(statusCode int) bool {
+	if p.Retryable == nil {
+		return DefaultRetryable(statusCode)
+	}
+
+	return p.Retryable(statusCode)
+}
+
+func (p RetryPolicy) delay(attempt int) time.Duration {
+	delay := p.Delay
+
+	if p.Backoff == ExponentialBackoff {
+		delay = time.Duration(float64(p.Delay) * math.Pow(2, float64(attempt)))
+		if p.MaxDelay > 0 && (delay > p.MaxDelay || delay <= 0) {
+			delay = p.MaxDelay
+		}
+	}
+
+	if p.Jitter > 0 {
+		delay += time.Duration((rand.Float64()*2 - 1) * p.Jitter * float64(delay))
+	}
+
+	return delay
+}
+
+// DeliveryError is returned by transports when an event is rejected by, or can't reach, its target
+type DeliveryError struct {
+	// StatusCode is zero if the event was never delivered
+	StatusCode int
+	Err        error
+}
+
+func (e *DeliveryError) Error() string { return e.Err.Error() }
+
+func (e *DeliveryError) Unwrap() error { return e.Err }
+
+// StatusError is returned by listeners' handlers to reject an event with a particular status code, e.g. 429 to ask
+// the sender to back off
+type StatusError struct {
+	StatusCode int
+	Err        error
+}
+
+func (e *StatusError) Error() string { return e.Err.Error() }
+
+func (e *StatusError) Unwrap() error { return e.Err }
+
+// RejectionStatus returns the status code to reject an event with when its handler fails, 503 unless the handler
+// returned a StatusError
+func RejectionStatus(err error) int {
+	var status *StatusError
+	if errors.As(err, &status) {
+		return status.StatusCode
+	}
+
+	return nethttp.StatusServiceUnavailable
+}
+
+// StatusCode returns the status code of a failed delivery, or zero if it wasn't delivered at all
+func StatusCode(err error) int {
+	var delivery *DeliveryError
+	if errors.As(err, &delivery) {
+		return delivery.StatusCode
+	}
+
+	return 0
+}
+
+type DeliveryFailure struct {
+	Target     string
+	StatusCode int
+	Attempts   int
+	Err        error
+}
+
+// DeadLetterSink receives events which couldn't be delivered after exhausting the retry policy
+type DeadLetterSink interface {
+	DeadLetter(event event.Event, failure DeliveryFailure) error
+}
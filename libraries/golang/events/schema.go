@@ -0,0 +1,250 @@
+package events
+
+import (
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+type Schema struct {
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	// Closed rejects properties missing from Properties, encoded as "additionalProperties": false
+	Closed bool `json:"-"`
+}
+
+type schemaFields Schema
+
+type schemaJSON struct {
+	*schemaFields
+	AdditionalProperties json.RawMessage `json:"additionalProperties,omitempty"`
+}
+
+func (s Schema) MarshalJSON() ([]byte, error) {
+	out := schemaJSON{schemaFields: (*schemaFields)(&s)}
+
+	if s.Closed {
+		out.AdditionalProperties = json.RawMessage("false")
+	} else if s.AdditionalProperties != nil {
+		data, err := json.Marshal(s.AdditionalProperties)
+		if err != nil {
+			return nil, err
+		}
+
+		out.AdditionalProperties = data
+	}
+
+	return json.Marshal(out)
+}
+
+func (s *Schema) UnmarshalJSON(data []byte) error {
+	in := schemaJSON{schemaFields: (*schemaFields)(s)}
+
+	err := json.Unmarshal(data, &in)
+	if err != nil {
+		return err
+	}
+
+	switch string(in.AdditionalProperties) {
+	case "", "true":
+	case "false":
+		s.Closed = true
+	default:
+		s.AdditionalProperties = &Schema{}
+		return json.Unmarshal(in.AdditionalProperties, s.AdditionalProperties)
+	}
+
+	return nil
+}
+
+type RouteSchema struct {
+	Request  *Schema `json:"request"`
+	Response *Schema `json:"response"`
+}
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+)
+
+// SchemaOf derives a JSON schema from a go type, following the same field naming rules as encoding/json. Struct
+// fields are required unless they are pointers or tagged omitempty, and unknown fields are rejected.
+func SchemaOf(t reflect.Type) *Schema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case t.Implements(textMarshalerType) || reflect.PtrTo(t).Implements(textMarshalerType):
+		return &Schema{Type: "string"}
+	case t.Implements(jsonMarshalerType) || reflect.PtrTo(t).Implements(jsonMarshalerType):
+		return &Schema{}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		return &Schema{Type: "array", Items: SchemaOf(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: SchemaOf(t.Elem())}
+	case reflect.Struct:
+		schema := &Schema{Type: "object", Properties: map[string]*Schema{}, Closed: true}
+
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if field.PkgPath != "" {
+				continue
+			}
+
+			name := field.Name
+			optional := field.Type.Kind() == reflect.Ptr
+			if tag, ok := field.Tag.Lookup("json"); ok {
+				options := strings.Split(tag, ",")
+				if options[0] == "-" {
+					continue
+				}
+
+				if options[0] != "" {
+					name = options[0]
+				}
+
+				for _, option := range options[1:] {
+					optional = optional || option == "omitempty"
+				}
+			}
+
+			schema.Properties[name] = SchemaOf(field.Type)
+			if !optional {
+				schema.Required = append(schema.Required, name)
+			}
+		}
+
+		return schema
+	default:
+		return &Schema{}
+	}
+}
+
+// Validate checks a decoded JSON value against the schema, describing the first violation found
+func (s *Schema) Validate(value interface{}) error {
+	return s.validate("", value)
+}
+
+func (s *Schema) validate(path string, value interface{}) error {
+	if s == nil || (value == nil && s.Type != "object") {
+		return nil
+	}
+
+	switch s.Type {
+	case "object":
+		if value == nil {
+			value = map[string]interface{}{}
+		}
+
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return violation(path, "expected an object")
+		}
+
+		for _, name := range s.Required {
+			if _, ok := object[name]; !ok {
+				return violation(join(path, name), "missing required property")
+			}
+		}
+
+		keys := make([]string, 0, len(object))
+		for key := range object {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			property, ok := s.Properties[key]
+			if !ok {
+				property = s.AdditionalProperties
+			}
+
+			if !ok && s.Closed {
+				return violation(join(path, key), "unexpected property")
+			}
+
+			if err := property.validate(join(path, key), object[key]); err != nil {
+				return err
+			}
+		}
+	case "array":
+		array, ok := value.([]interface{})
+		if !ok {
+			return violation(path, "expected an array")
+		}
+
+		for i, item := range array {
+			if err := s.Items.validate(fmt.Sprintf("%s[%d]", path, i), item); err != nil {
+				return err
+			}
+		}
+	case "string":
+		str, ok := value.(string)
+		if !ok {
+			return violation(path, "expected a string")
+		}
+
+		if s.Format == "date-time" {
+			if _, err := time.Parse(time.RFC3339, str); err != nil {
+				return violation(path, "expected an RFC3339 date-time")
+			}
+		}
+	case "integer":
+		number, ok := value.(float64)
+		if !ok || number != math.Trunc(number) {
+			return violation(path, "expected an integer")
+		}
+	case "number":
+		if _, ok := value.(float64); !ok {
+			return violation(path, "expected a number")
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return violation(path, "expected a boolean")
+		}
+	}
+
+	return nil
+}
+
+func join(path string, name string) string {
+	if path == "" {
+		return name
+	}
+
+	return path + "." + name
+}
+
+func violation(path string, message string) error {
+	if path == "" {
+		return errors.New(message)
+	}
+
+	return fmt.Errorf("%s: %s", path, message)
+}
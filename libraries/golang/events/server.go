@@ -3,11 +3,18 @@ package events
 import (
 	"context"
 	"fmt"
+	nethttp "net/http"
 	"os"
 	"os/signal"
+	"syscall"
+	"time"
 
+	cloudevents "github.com/cloudevents/sdk-go/v2"
 	"github.com/cloudevents/sdk-go/v2/event"
+	"github.com/cloudevents/sdk-go/v2/protocol/http"
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type Response struct {
@@ -20,81 +27,188 @@ type EventParser func(obj interface{}) error
 
 type EventRoutes map[string]EventRoute
 
-type EventRoute func(userId string, into EventParser) ([]Response, error)
+type EventRoute func(ctx context.Context, userId string, into EventParser) ([]Response, error)
 
 type ServeParams struct {
 	BrokerEnv string
 	BrokerURL string
 	Source    string
 	Routes    map[string]EventRoute
+	Handlers  TypedRoutes
+	// DrainTimeout is how long in-flight events are given to finish on shutdown
+	DrainTimeout time.Duration
+	// Transport defaults to HTTP, which also serves the route schemas on GET /schemas
+	Transport Transport
+	// Address to listen on, defaults to ":80"
+	Address string
+	// Middlewares wrap every route, the first being the outermost. Defaults to Logging, and routes are
+	// always wrapped in Recover so that a panic can't take the service down.
+	Middlewares []Middleware
+	// Metrics serves prometheus metrics on GET /metrics, only supported by the default HTTP transport
+	Metrics bool
 }
 
-func Serve(params ServeParams) error {
+// Serve routes incoming events to their handlers until ctx is cancelled or the process receives SIGINT or SIGTERM
+func Serve(ctx context.Context, params ServeParams) error {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	client, err := New(EventsArgs{
 		BrokerEnv: params.BrokerEnv,
 		BrokerURL: params.BrokerURL,
 		Source:    params.Source,
+		Transport: params.Transport,
 	})
 	if err != nil {
 		return fmt.Errorf("failed to create client connection: %+v", err)
 	}
 
-	cancelFunc, err := Listen(80, func(ctx context.Context, event event.Event) {
+	routes := EventRoutes{}
+	for eventType, route := range params.Routes {
+		routes[eventType] = route
+	}
+
+	schemas := map[string]RouteSchema{}
+	for eventType, handler := range params.Handlers {
+		routes[eventType] = handler.Route
+		schemas[eventType] = handler.Schema
+	}
+
+	registry := NewRegistry()
+	registry.Set(params.Source, schemas)
+
+	middlewares := params.Middlewares
+	if middlewares == nil {
+		middlewares = []Middleware{Logging()}
+	}
+	middlewares = append([]Middleware{Recover(), Timing(observeHandler)}, middlewares...)
+
+	for eventType, route := range routes {
+		routes[eventType] = Chain(eventType, route, middlewares...)
+	}
+
+	transport := params.Transport
+	if transport == nil {
+		options := []http.Option{http.WithGetHandlerFunc(getHandler(registry, params.Metrics))}
+		if params.DrainTimeout > 0 {
+			options = append(options, http.WithShutdownTimeout(params.DrainTimeout))
+		}
+
+		transport, err = NewHTTPTransport(HTTPTransportArgs{ListenOptions: options})
+		if err != nil {
+			return fmt.Errorf("failed to create transport: %+v", err)
+		}
+	}
+
+	address := params.Address
+	if address == "" {
+		address = ":80"
+	}
+
+	done, err := transport.Listen(ctx, address, func(ctx context.Context, event event.Event) error {
+		ctx, span := StartSpan(ctx, "handle "+event.Type(), trace.WithSpanKind(trace.SpanKindConsumer), eventAttributes(event))
+		defer span.End()
+
 		var err error
 
 		userIdObj, err := event.Context.GetExtension("userid")
 		if err != nil {
 			logrus.Errorf("failed to get user id from event: %+v", err)
-			return
+			return nil
 		}
 
 		userId, ok := userIdObj.(string)
 		if !ok {
-			logrus.Errorf("expected user id to be a string, got %T", userId)
-			return
+			logrus.Errorf("expected user id to be a string, got %T", userIdObj)
+			return nil
 		}
 
-		logrus.Infof("Got event: %s", event.Type())
-
-		route, ok := params.Routes[event.Type()]
+		route, ok := routes[event.Type()]
 		if !ok {
 			logrus.Errorf("unexpected event type: %s", event.Type())
-			return
+			return nil
+		}
+
+		var responses []Response
+		if err = registry.Validate(event.Type(), event.Data()); err != nil {
+			responses = rejectionResponses(userId, fmt.Sprintf("invalid payload: %s", err.Error()))
+		} else {
+			responses, err = route(contextWithEvent(ctx, event), userId, event.DataAs)
 		}
 
-		responses, err := route(userId, event.DataAs)
 		if err != nil {
 			logrus.Errorf("error processing event %s: %+v", event.Type(), err)
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "route failed")
 		}
 
+		correlationId := CorrelationID(event)
+		partitionKey := PartitionKey(event)
+
+		batch := []cloudevents.Event{}
 		for _, response := range responses {
-			err = client.Send(
-				fmt.Sprintf("%s.%s", event.Type(), response.EventType),
-				response.Data,
-				map[string]interface{}{"userid": response.UserId},
-			)
+			extensions := map[string]interface{}{"userid": response.UserId}
+			if correlationId != "" {
+				extensions[CorrelationIDExtension] = correlationId
+			}
+
+			// responses keep the request's key, so that they're delivered in order too
+			if partitionKey != "" {
+				extensions[PartitionKeyExtension] = partitionKey
+			}
 
+			reply, err := client.NewEvent(fmt.Sprintf("%s.%s", event.Type(), response.EventType), response.Data, extensions)
 			if err != nil {
-				logrus.Errorf("failed to send \"%s\" response to event \"%s\": %+v", response.EventType, event.Type(), err)
+				logrus.Errorf("failed to create \"%s\" response to event \"%s\": %+v", response.EventType, event.Type(), err)
+				continue
 			}
+
+			batch = append(batch, reply)
+		}
+
+		if len(batch) == 0 {
+			return nil
+		}
+
+		// responses go out as a single batch, for transports which support it
+		err = client.ProxyBatch(ctx, batch)
+		if err != nil {
+			logrus.Errorf("failed to send %d responses to event \"%s\": %+v", len(batch), event.Type(), err)
 		}
+
+		return nil
 	})
 
 	if err != nil {
 		return fmt.Errorf("failed to start server: %+v", err)
 	}
 
-	defer cancelFunc()
-
 	logrus.Infof("Running...")
 
-	// Wait for interrupt signal to gracefully shutdown the server with
-	// a timeout of 5 seconds.
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, os.Interrupt)
-	<-quit
+	err = <-done
+	if err != nil {
+		return fmt.Errorf("server stopped unexpectedly: %+v", err)
+	}
 
 	logrus.Infof("Stopped")
 
 	return nil
 }
+
+func getHandler(registry *Registry, metrics bool) nethttp.HandlerFunc {
+	metricsHandler := MetricsHandler()
+
+	return func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		if metrics && r.URL.Path == "/metrics" {
+			metricsHandler.ServeHTTP(w, r)
+			return
+		}
+
+		if r.URL.Path != "/schemas" {
+			w.WriteHeader(nethttp.StatusNotFound)
+			return
+		}
+
+		registry.ServeHTTP(w, r)
+	}
+}
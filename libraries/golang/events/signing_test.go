@@ -0,0 +1,95 @@
+package events
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cloudevents/sdk-go/v2/event"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSigning(t *testing.T) {
+	logrus.SetOutput(io.Discard)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	key := []byte("shared-key")
+	transport := NewMemoryTransport()
+
+	received := make(chan event.Event, 1)
+	_, err := transport.Listen(ctx, "broker", func(ctx context.Context, event event.Event) error {
+		received <- event
+		return nil
+	})
+	assert.NoError(t, err)
+
+	client, err := New(EventsArgs{
+		BrokerURL: "broker",
+		Source:    "client",
+		Transport: transport,
+		Signer:    &Signer{Publisher: "gateway", Key: key},
+	})
+	assert.NoError(t, err)
+
+	assert.NoError(t, client.Send("test.event", map[string]string{"move": "a1"}, map[string]interface{}{"userid": "user-1"}))
+
+	event := <-received
+	assert.Equal(t, "gateway", event.Extensions()[PublisherExtension])
+	assert.True(t, VerifySignature(event, key))
+	assert.False(t, VerifySignature(event, []byte("other-key")))
+
+	forged := event.Clone()
+	forged.SetExtension("userid", "user-2")
+	assert.False(t, VerifySignature(forged, key))
+
+	forged = event.Clone()
+	assert.NoError(t, forged.SetData("application/json", map[string]string{"move": "b2"}))
+	assert.False(t, VerifySignature(forged, key))
+
+	forged = event.Clone()
+	forged.SetExtension(SignedAtExtension, time.Now().Add(time.Hour).UTC().Format(time.RFC3339Nano))
+	assert.False(t, VerifySignature(forged, key))
+
+	traced := event.Clone()
+	traced.SetExtension("traceparent", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+	assert.True(t, VerifySignature(traced, key))
+}
+
+func TestSignedWithin(t *testing.T) {
+	signer := &Signer{Publisher: "gateway", Key: []byte("shared-key")}
+
+	event := event.New()
+	assert.False(t, SignedWithin(event, time.Minute), "unsigned")
+
+	signer.Sign(&event)
+	assert.True(t, SignedWithin(event, time.Minute))
+
+	event.SetExtension(SignedAtExtension, time.Now().Add(-2*time.Minute).UTC().Format(time.RFC3339Nano))
+	assert.False(t, SignedWithin(event, time.Minute), "too old")
+
+	event.SetExtension(SignedAtExtension, time.Now().Add(2*time.Minute).UTC().Format(time.RFC3339Nano))
+	assert.False(t, SignedWithin(event, time.Minute), "too far in the future")
+}
+
+func TestSignerFromEnv(t *testing.T) {
+	os.Unsetenv("PUBLISHER_NAME")
+	signer, err := SignerFromEnv()
+	assert.NoError(t, err)
+	assert.Nil(t, signer)
+
+	keyFile := filepath.Join(t.TempDir(), "key")
+	assert.NoError(t, os.WriteFile(keyFile, []byte("shared-key\n"), 0600))
+
+	t.Setenv("PUBLISHER_NAME", "gateway")
+	t.Setenv("PUBLISHER_KEY_FILE", keyFile)
+
+	signer, err = SignerFromEnv()
+	assert.NoError(t, err)
+	assert.Equal(t, &Signer{Publisher: "gateway", Key: []byte("shared-key")}, signer)
+}
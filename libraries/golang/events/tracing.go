@@ -0,0 +1,113 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/cloudevents/sdk-go/v2/event"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Extensions from the CloudEvents distributed tracing extension, holding the W3C trace context
+const (
+	TraceParentExtension = "traceparent"
+	TraceStateExtension  = "tracestate"
+)
+
+var propagator = propagation.TraceContext{}
+
+// eventCarrier adapts an event's extensions to the otel TextMapCarrier interface
+type eventCarrier struct {
+	event *event.Event
+}
+
+func (c eventCarrier) Get(key string) string {
+	value, ok := c.event.Extensions()[key].(string)
+	if !ok {
+		return ""
+	}
+
+	return value
+}
+
+func (c eventCarrier) Set(key string, value string) {
+	c.event.SetExtension(key, value)
+}
+
+func (c eventCarrier) Keys() []string {
+	return []string{TraceParentExtension, TraceStateExtension}
+}
+
+// InjectTrace writes the span context from ctx onto the event's trace extensions
+func InjectTrace(ctx context.Context, event *event.Event) {
+	propagator.Inject(ctx, eventCarrier{event: event})
+}
+
+// ExtractTrace returns a copy of ctx continuing the trace carried by the event, if any
+func ExtractTrace(ctx context.Context, event event.Event) context.Context {
+	return propagator.Extract(ctx, eventCarrier{event: &event})
+}
+
+// StartSpan starts a span using the events library tracer, a no-op unless InitTracing has been called
+func StartSpan(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return otel.Tracer("ponglehub.co.uk/lib/events").Start(ctx, name, opts...)
+}
+
+func eventAttributes(event event.Event) trace.SpanStartOption {
+	return trace.WithAttributes(
+		attribute.String("event.type", event.Type()),
+		attribute.String("event.source", event.Source()),
+		attribute.String("event.id", event.ID()),
+		attribute.String("event.correlationid", CorrelationID(event)),
+	)
+}
+
+// InitTracing installs a tracer provider for the service, chosen by the TRACE_EXPORTER environment variable:
+// "otlp" exports to the collector set by the standard OTEL_EXPORTER_OTLP_* variables, "stdout" writes spans to
+// TRACE_FILE (or stdout if unset) for local testing, and anything else leaves tracing disabled. The returned
+// function flushes any remaining spans.
+func InitTracing(ctx context.Context, service string) (func(context.Context) error, error) {
+	var exporter sdktrace.SpanExporter
+	var err error
+
+	switch os.Getenv("TRACE_EXPORTER") {
+	case "otlp":
+		exporter, err = otlptracehttp.New(ctx)
+	case "stdout":
+		var out io.Writer = os.Stdout
+		if path, ok := os.LookupEnv("TRACE_FILE"); ok {
+			out, err = os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+			if err != nil {
+				return nil, fmt.Errorf("failed to open trace file: %+v", err)
+			}
+		}
+
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(out))
+	default:
+		return func(context.Context) error { return nil }, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to create trace exporter: %+v", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceNameKey.String(service))),
+	)
+
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagator)
+
+	return provider.Shutdown, nil
+}
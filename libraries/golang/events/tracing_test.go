@@ -0,0 +1,59 @@
+package events
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTracePropagation(t *testing.T) {
+	logrus.SetOutput(io.Discard)
+
+	recorder := tracetest.NewSpanRecorder()
+	tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("tests")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	transport := NewMemoryTransport()
+
+	retry := RetryPolicy{Delay: 10 * time.Millisecond, MaxRetries: 100}
+
+	client, err := New(EventsArgs{BrokerURL: "game", Source: "unit-tests", Transport: transport, Retry: &retry})
+	assert.NoError(t, err)
+
+	_, err = transport.Listen(ctx, "client", client.HandleReply)
+	assert.NoError(t, err)
+
+	handled := make(chan trace.SpanContext, 1)
+
+	go Serve(ctx, ServeParams{
+		BrokerURL: "client",
+		Source:    "game",
+		Transport: transport,
+		Address:   "game",
+		Handlers: TypedRoutes{
+			"test.ping": Handle(func(ctx context.Context, userId string, request Empty) ([]Reply[Empty], error) {
+				handled <- trace.SpanContextFromContext(ctx)
+				return []Reply[Empty]{{UserId: userId}}, nil
+			}),
+		},
+	})
+
+	ctx, root := tracer.Start(ctx, "root")
+	traceId := root.SpanContext().TraceID()
+
+	reply, err := client.Request(ctx, "test.ping", nil, map[string]interface{}{"userid": "user"})
+	assert.NoError(t, err)
+	root.End()
+
+	assert.Equal(t, traceId, (<-handled).TraceID())
+	assert.Equal(t, traceId, trace.SpanContextFromContext(ExtractTrace(context.Background(), reply)).TraceID())
+}
@@ -0,0 +1,306 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	nethttp "net/http"
+	"sync"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/cloudevents/sdk-go/v2/event"
+	"github.com/cloudevents/sdk-go/v2/protocol"
+	"github.com/cloudevents/sdk-go/v2/protocol/http"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// Transport moves events between services. Targets and addresses are transport specific, e.g. URLs and
+// host:port pairs for HTTP, or arbitrary names for the in-memory transport.
+type Transport interface {
+	Send(ctx context.Context, target string, event event.Event) error
+	Listen(ctx context.Context, address string, handler EventHandler) (<-chan error, error)
+}
+
+type HTTPTransport struct {
+	sender        cloudevents.Client
+	client        *nethttp.Client
+	defaults      TargetOptions
+	targets       map[string]TargetOptions
+	noGzip        sync.Map
+	noBatch       sync.Map
+	listenOptions []http.Option
+}
+
+type HTTPTransportArgs struct {
+	// Timeout for each delivery attempt, defaults to one second
+	Timeout time.Duration
+	Cookies nethttp.CookieJar
+	// MaxIdleConnsPerHost keeps up to this many connections to each target open for reuse, defaults to Go's
+	// default of two. Services sending many events at once to the same target should raise it, otherwise most
+	// connections are closed after a single request and the ephemeral ports run out.
+	MaxIdleConnsPerHost int
+	// Defaults apply to any target without its own entry in Targets
+	Defaults      TargetOptions
+	Targets       map[string]TargetOptions
+	ListenOptions []http.Option
+}
+
+func NewHTTPTransport(args HTTPTransportArgs) (*HTTPTransport, error) {
+	var roundTripper nethttp.RoundTripper = nethttp.DefaultTransport
+	if args.MaxIdleConnsPerHost > 0 {
+		pool := nethttp.DefaultTransport.(*nethttp.Transport).Clone()
+		pool.MaxIdleConnsPerHost = args.MaxIdleConnsPerHost
+		pool.MaxIdleConns = 0
+		roundTripper = pool
+	}
+
+	client := &nethttp.Client{
+		Timeout:   time.Second,
+		Jar:       args.Cookies,
+		Transport: gzipRoundTripper{next: roundTripper},
+	}
+	if args.Timeout > 0 {
+		client.Timeout = args.Timeout
+	}
+
+	p, err := cloudevents.NewHTTP(http.WithClient(*client))
+	if err != nil {
+		return nil, fmt.Errorf("error creating http protocol: %+v", err)
+	}
+
+	sender, err := cloudevents.NewClient(p, cloudevents.WithTimeNow(), cloudevents.WithUUIDs())
+	if err != nil {
+		return nil, fmt.Errorf("error creating cloudevents instance: %+v", err)
+	}
+
+	return &HTTPTransport{
+		sender:        sender,
+		client:        client,
+		defaults:      args.Defaults,
+		targets:       args.Targets,
+		listenOptions: args.ListenOptions,
+	}, nil
+}
+
+func (t *HTTPTransport) options(target string) TargetOptions {
+	options, ok := t.targets[target]
+	if !ok {
+		options = t.defaults
+	}
+
+	if _, refused := t.noGzip.Load(target); refused {
+		options.Gzip = false
+	}
+
+	return options
+}
+
+// Send makes a single attempt to deliver the event, retries are handled by the caller
+func (t *HTTPTransport) Send(ctx context.Context, target string, event event.Event) error {
+	options := t.options(target)
+
+	sendCtx := cloudevents.ContextWithTarget(ctx, target)
+	if options.Encoding == StructuredEncoding {
+		sendCtx = cloudevents.WithEncodingStructured(sendCtx)
+	}
+
+	if options.Gzip {
+		sendCtx = withGzip(sendCtx)
+	}
+
+	err := t.send(sendCtx, event)
+	if options.Gzip && StatusCode(err) == nethttp.StatusUnsupportedMediaType {
+		logrus.Warnf("%s doesn't accept compressed events, sending uncompressed", target)
+		t.noGzip.Store(target, true)
+		return t.Send(ctx, target, event)
+	}
+
+	return err
+}
+
+func (t *HTTPTransport) send(ctx context.Context, event event.Event) error {
+	res := t.sender.Send(ctx, event)
+
+	// a status code means the event reached the target, even though the client only marks it
+	// as a NACK when retrying
+	var result *http.Result
+	if !cloudevents.ResultAs(res, &result) {
+		if cloudevents.IsUndelivered(res) {
+			return &DeliveryError{Err: fmt.Errorf("failed to send event: %v", res.Error())}
+		}
+
+		return fmt.Errorf("error decoding result %T: %+v", res, res)
+	}
+
+	if result.StatusCode/100 != 2 {
+		return &DeliveryError{
+			StatusCode: result.StatusCode,
+			Err:        fmt.Errorf("event for %s not acknowledged: %d", event.Type(), result.StatusCode),
+		}
+	}
+
+	logrus.Infof("Sent %s with status: %d", event.Type(), result.StatusCode)
+
+	return nil
+}
+
+// Listen receives events on the given address until ctx is cancelled. In-flight handlers are then given the
+// protocol's shutdown timeout to finish before their context is cancelled. The returned channel yields
+// any error from the receiver and is closed once the listener has fully stopped.
+func (t *HTTPTransport) Listen(ctx context.Context, address string, handler EventHandler) (<-chan error, error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %+v", address, err)
+	}
+
+	handlerCtx, cancelHandlers := context.WithCancel(context.Background())
+	receive := func(event event.Event) error {
+		receivedCounter.WithLabelValues(event.Type()).Inc()
+		return handler(ExtractTrace(handlerCtx, event), event)
+	}
+
+	options := append([]http.Option{http.WithListener(listener)}, t.listenOptions...)
+	options = append(options, http.WithMiddleware(receiveMiddleware(receive)))
+
+	p, err := cloudevents.NewHTTP(options...)
+	if err != nil {
+		listener.Close()
+		cancelHandlers()
+		return nil, fmt.Errorf("failed to create protocol: %s", err.Error())
+	}
+
+	client, err := cloudevents.NewClient(p)
+	if err != nil {
+		listener.Close()
+		cancelHandlers()
+		return nil, fmt.Errorf("failed to create client, %v", err)
+	}
+
+	stopped := make(chan struct{})
+	done := make(chan error, 1)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			logrus.Infof("Draining event listener...")
+		case <-stopped:
+			return
+		}
+
+		select {
+		case <-time.After(p.ShutdownTimeout):
+			logrus.Warnf("Timed out draining event listener, cancelling in-flight handlers")
+			cancelHandlers()
+		case <-stopped:
+		}
+	}()
+
+	go func() {
+		defer close(done)
+		defer cancelHandlers()
+		defer close(stopped)
+
+		err := client.StartReceiver(ctx, func(_ context.Context, event event.Event) protocol.Result {
+			err := receive(event)
+			if err != nil {
+				logrus.Errorf("Rejecting %s: %+v", event.Type(), err)
+				return http.NewResult(RejectionStatus(err), "%s", err.Error())
+			}
+
+			return nil
+		})
+
+		if err != nil && ctx.Err() == nil {
+			done <- fmt.Errorf("error in event listener: %+v", err)
+		} else {
+			logrus.Infof("Stopped event listener")
+		}
+	}()
+
+	logrus.Infof("Listening on %s...", address)
+
+	return done, nil
+}
+
+// SendBatch delivers the events in a single application/cloudevents-batch+json request, falling back to
+// sending them one at a time to targets which don't accept batches
+func (t *HTTPTransport) SendBatch(ctx context.Context, target string, events []event.Event) error {
+	if _, refused := t.noBatch.Load(target); refused {
+		return t.sendEach(ctx, target, events)
+	}
+
+	for i := range events {
+		if events[i].ID() == "" {
+			events[i].SetID(uuid.New().String())
+		}
+
+		if events[i].Time().IsZero() {
+			events[i].SetTime(time.Now())
+		}
+	}
+
+	data, err := json.Marshal(events)
+	if err != nil {
+		return fmt.Errorf("failed to serialise batch: %+v", err)
+	}
+
+	options := t.options(target)
+
+	sendCtx := ctx
+	if options.Gzip {
+		sendCtx = withGzip(ctx)
+	}
+
+	req, err := nethttp.NewRequestWithContext(sendCtx, nethttp.MethodPost, target, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to create batch request: %+v", err)
+	}
+	req.Header.Set("Content-Type", event.ApplicationCloudEventsBatchJSON)
+
+	res, err := t.client.Do(req)
+	if err != nil {
+		return &DeliveryError{Err: fmt.Errorf("failed to send batch: %+v", err)}
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, res.Body)
+
+	// the compression may be what was refused rather than the batch, so try the batch uncompressed first
+	if options.Gzip && res.StatusCode == nethttp.StatusUnsupportedMediaType {
+		logrus.Warnf("%s doesn't accept compressed events, sending uncompressed", target)
+		t.noGzip.Store(target, true)
+		return t.SendBatch(ctx, target, events)
+	}
+
+	if res.StatusCode == nethttp.StatusUnsupportedMediaType {
+		logrus.Warnf("%s doesn't accept batches, sending events individually", target)
+		t.noBatch.Store(target, true)
+		return t.sendEach(ctx, target, events)
+	}
+
+	if res.StatusCode >= 300 {
+		return &DeliveryError{
+			StatusCode: res.StatusCode,
+			Err:        fmt.Errorf("batch of %d events not acknowledged: %d", len(events), res.StatusCode),
+		}
+	}
+
+	logrus.Infof("Sent batch of %d events with status: %d", len(events), res.StatusCode)
+
+	return nil
+}
+
+func (t *HTTPTransport) sendEach(ctx context.Context, target string, events []event.Event) error {
+	for _, event := range events {
+		err := t.Send(ctx, target, event)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,186 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	nethttp "net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/cloudevents/sdk-go/v2/event"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func freeAddress(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer listener.Close()
+
+	return listener.Addr().String()
+}
+
+func testEvent(eventType string) event.Event {
+	event := cloudevents.NewEvent()
+	event.SetType(eventType)
+	event.SetSource("unit-tests")
+	event.SetData(cloudevents.ApplicationJSON, map[string]string{"pieces": strings.Repeat("x", 100)})
+
+	return event
+}
+
+func TestHTTPEncodings(t *testing.T) {
+	logrus.SetOutput(io.Discard)
+
+	for _, test := range []struct {
+		name    string
+		options TargetOptions
+		batch   bool
+	}{
+		{name: "binary"},
+		{name: "structured", options: TargetOptions{Encoding: StructuredEncoding}},
+		{name: "gzip", options: TargetOptions{Gzip: true}},
+		{name: "batch", batch: true},
+		{name: "gzipped batch", options: TargetOptions{Gzip: true}, batch: true},
+	} {
+		t.Run(test.name, func(u *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			address := freeAddress(u)
+			target := "http://" + address
+
+			received := make(chan event.Event, 10)
+			listener, err := NewHTTPTransport(HTTPTransportArgs{})
+			assert.NoError(u, err)
+
+			_, err = listener.Listen(ctx, address, func(ctx context.Context, event event.Event) error {
+				received <- event
+				return nil
+			})
+			assert.NoError(u, err)
+
+			sender, err := NewHTTPTransport(HTTPTransportArgs{Targets: map[string]TargetOptions{target: test.options}})
+			assert.NoError(u, err)
+
+			sent := []event.Event{testEvent("test.first"), testEvent("test.second")}
+			if test.batch {
+				assert.NoError(u, sender.SendBatch(ctx, target, sent))
+			} else {
+				for _, event := range sent {
+					assert.NoError(u, sender.Send(ctx, target, event))
+				}
+			}
+
+			for _, expected := range sent {
+				select {
+				case actual := <-received:
+					assert.Equal(u, expected.Type(), actual.Type())
+					assert.Equal(u, expected.Data(), actual.Data())
+				case <-time.After(time.Second):
+					u.Fatalf("timed out waiting for %s", expected.Type())
+				}
+			}
+		})
+	}
+}
+
+func TestHTTPNegotiation(t *testing.T) {
+	logrus.SetOutput(io.Discard)
+
+	for _, test := range []struct {
+		name     string
+		batches  bool
+		expected []string
+	}{
+		{
+			name: "no batches or gzip",
+			expected: []string{
+				"application/cloudevents-batch+json gzip",
+				"application/cloudevents-batch+json ",
+				"application/json ",
+				"application/json ",
+				"application/json ",
+			},
+		},
+		{
+			name:    "batches without gzip",
+			batches: true,
+			expected: []string{
+				"application/cloudevents-batch+json gzip",
+				"application/cloudevents-batch+json ",
+				"application/cloudevents-batch+json ",
+			},
+		},
+	} {
+		t.Run(test.name, func(u *testing.T) {
+			lock := sync.Mutex{}
+			requests := []string{}
+
+			target := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+				lock.Lock()
+				requests = append(requests, r.Header.Get("Content-Type")+" "+r.Header.Get("Content-Encoding"))
+				lock.Unlock()
+
+				batch := r.Header.Get("Content-Type") == event.ApplicationCloudEventsBatchJSON
+				if r.Header.Get("Content-Encoding") != "" || (batch && !test.batches) {
+					w.WriteHeader(nethttp.StatusUnsupportedMediaType)
+					return
+				}
+
+				w.WriteHeader(nethttp.StatusOK)
+			}))
+			defer target.Close()
+
+			sender, err := NewHTTPTransport(HTTPTransportArgs{Defaults: TargetOptions{Gzip: true}})
+			assert.NoError(u, err)
+
+			ctx := context.Background()
+			assert.NoError(u, sender.SendBatch(ctx, target.URL, []event.Event{testEvent("test.first"), testEvent("test.second")}))
+			assert.NoError(u, sender.SendBatch(ctx, target.URL, []event.Event{testEvent("test.third")}))
+
+			assert.Equal(u, test.expected, requests)
+		})
+	}
+}
+
+func TestHTTPRejection(t *testing.T) {
+	logrus.SetOutput(io.Discard)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	address := freeAddress(t)
+
+	transport, err := NewHTTPTransport(HTTPTransportArgs{})
+	assert.NoError(t, err)
+
+	_, err = transport.Listen(ctx, address, func(ctx context.Context, event event.Event) error {
+		return errors.New("storage unavailable")
+	})
+	assert.NoError(t, err)
+
+	err = transport.Send(ctx, "http://"+address, testEvent("test.event"))
+	assert.Equal(t, nethttp.StatusServiceUnavailable, StatusCode(err))
+
+	err = transport.SendBatch(ctx, "http://"+address, []event.Event{testEvent("test.first"), testEvent("test.second")})
+	assert.Equal(t, nethttp.StatusServiceUnavailable, StatusCode(err))
+
+	busy := freeAddress(t)
+	_, err = transport.Listen(ctx, busy, func(ctx context.Context, event event.Event) error {
+		return &StatusError{StatusCode: nethttp.StatusTooManyRequests, Err: errors.New("too busy")}
+	})
+	assert.NoError(t, err)
+
+	err = transport.Send(ctx, "http://"+busy, testEvent("test.event"))
+	assert.Equal(t, nethttp.StatusTooManyRequests, StatusCode(err))
+
+	err = transport.SendBatch(ctx, "http://"+busy, []event.Event{testEvent("test.first"), testEvent("test.second")})
+	assert.Equal(t, nethttp.StatusTooManyRequests, StatusCode(err))
+}
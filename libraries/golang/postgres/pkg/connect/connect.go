@@ -6,6 +6,7 @@ import (
 	"fmt"
 
 	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
 	"github.com/sirupsen/logrus"
 )
 
@@ -37,13 +38,17 @@ func getConnection(config *pgx.ConnConfig) *pgx.Conn {
 	return <-finished
 }
 
-func Connect(config ConnectConfig) (*pgx.Conn, error) {
+func connectionString(config ConnectConfig) string {
 	dbSuffix := ""
 	if config.Database != "" {
 		dbSuffix = "/" + config.Database
 	}
 
-	connectionString := fmt.Sprintf("postgresql://%s@%s:%d%s", config.Username, config.Host, config.Port, dbSuffix)
+	return fmt.Sprintf("postgresql://%s@%s:%d%s", config.Username, config.Host, config.Port, dbSuffix)
+}
+
+func Connect(config ConnectConfig) (*pgx.Conn, error) {
+	connectionString := connectionString(config)
 
 	logrus.Infof("Connecting to postgres with connection string: %s", connectionString)
 
@@ -59,3 +64,23 @@ func Connect(config ConnectConfig) (*pgx.Conn, error) {
 
 	return conn, nil
 }
+
+// ConnectPool opens a pool of connections for long running servers, which replaces connections that break, e.g. when
+// the database restarts, rather than failing every query after
+func ConnectPool(config ConnectConfig) (*pgxpool.Pool, error) {
+	connectionString := connectionString(config)
+
+	logrus.Infof("Connecting to postgres with connection string: %s", connectionString)
+
+	pgxConfig, err := pgxpool.ParseConfig(connectionString)
+	if err != nil {
+		return nil, err
+	}
+
+	pool, err := pgxpool.ConnectConfig(context.Background(), pgxConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create connection pool: %+v", err)
+	}
+
+	return pool, nil
+}
@@ -14,7 +14,7 @@ export class PongleEvents {
         this.events = new Events(host);
     }
 
-    async start(callback: (type: string, data: any)=>void, closed: ()=>void) {
+    async start(callback: (type: string, data: any, correlationId?: string)=>void, closed: ()=>void) {
         let attempt = 0;
         while(attempt < 3) {
             try {
@@ -37,8 +37,8 @@ export class PongleEvents {
         this.auth.logIn();
     }
 
-    send(type: string, data: any) {
-        this.events.send(type, data);
+    send(type: string, data: any, partitionKey?: string, correlationId?: string): string {
+        return this.events.send(type, data, partitionKey, correlationId);
     }
 
     stop() {
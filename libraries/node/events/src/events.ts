@@ -1,14 +1,20 @@
 export class Events {
     private host: string;
     private socket: WebSocket | null;
+    private cursor: string | null;
+    private refreshing: Promise<void> | null;
 
     constructor(host: string) {
         this.host = host;
         this.socket = null;
+        this.cursor = null;
+        this.refreshing = null;
     }
 
-    start(receive: (type: string, data: any) => void, closed: () => void): Promise<void> {
-        const socket = new WebSocket(`ws://${this.host}/events`);
+    // restarting after the socket closes resumes from the last response received, so none are missed
+    start(receive: (type: string, data: any, correlationId?: string) => void, closed: () => void): Promise<void> {
+        const query = this.cursor ? `?cursor=${encodeURIComponent(this.cursor)}` : "";
+        const socket = new WebSocket(`ws://${this.host}/events${query}`);
 
         return new Promise((resolve, reject) => {
             socket.onopen = () => {
@@ -18,8 +24,17 @@ export class Events {
     
             socket.onmessage = (event: MessageEvent) => {
                 const parsed = JSON.parse(event.data);
+                if (parsed.cursor) {
+                    this.cursor = parsed.cursor;
+                }
+
+                if (parsed.type === "auth.session.expiring") {
+                    this.refresh();
+                    return;
+                }
+
                 const data = typeof(parsed.data) === "string" ? JSON.parse(parsed.data) : parsed.data;
-                receive(parsed.type, data);
+                receive(parsed.type, data, parsed.correlationId);
             }
         
             socket.onclose = () => {
@@ -40,12 +55,42 @@ export class Events {
         });
     }
 
-    send(type: string, data: any): void {
+    // swaps the refresh cookie for a new login before the gateway closes the socket. Every tab's socket is warned at
+    // about the same time, so only one tab refreshes and the others skip it, since they share its cookies
+    private refresh(): void {
+        if (this.refreshing) {
+            return;
+        }
+
+        this.refreshing = withRefreshLock(async () => {
+            if (Date.now() - lastRefreshed() < REFRESH_INTERVAL) {
+                return;
+            }
+
+            const res = await fetch(`http://${this.host}/auth/refresh`, {method: "POST", credentials: "include"});
+            if (!res.ok) {
+                console.warn(`failed to refresh login: ${res.status}`);
+                return;
+            }
+
+            setLastRefreshed(Date.now());
+        })
+            .catch(err => console.warn("failed to refresh login", err))
+            .finally(() => {
+                this.refreshing = null;
+            });
+    }
+
+    // events sharing a partition key are delivered in the order they're sent, e.g. the moves in a game. Returns the
+    // correlation id, which the responses to the event are received with
+    send(type: string, data: any, partitionKey?: string, correlationId?: string): string {
         if (!this.socket) {
             throw new Error(`Tried to send message ${type} to closed websocket`);
         }
 
-        this.socket.send(JSON.stringify({type,data}));
+        const id = correlationId || newCorrelationId();
+        this.socket.send(JSON.stringify({type,data,partitionKey,correlationId: id}));
+        return id;
     }
 
     stop(): void {
@@ -57,3 +102,42 @@ export class Events {
         }
     }
 }
+
+function newCorrelationId(): string {
+    if (typeof crypto !== "undefined" && crypto.randomUUID) {
+        return crypto.randomUUID();
+    }
+
+    return `${Date.now().toString(16)}-${Math.random().toString(16).slice(2)}`;
+}
+
+// a refresh within this long of another tab's is skipped, it being shorter than the login token lasts
+const REFRESH_INTERVAL = 60 * 1000;
+const REFRESHED_KEY = "pongle.events.refreshed";
+
+// runs the refresh in one tab at a time, where the browser supports web locks
+function withRefreshLock(refresh: () => Promise<void>): Promise<void> {
+    // not every version of the dom types has web locks
+    const locks = typeof navigator !== "undefined" ? (navigator as any).locks : undefined;
+    if (locks) {
+        return locks.request(REFRESHED_KEY, refresh);
+    }
+
+    return refresh();
+}
+
+function lastRefreshed(): number {
+    try {
+        return Number(localStorage.getItem(REFRESHED_KEY)) || 0;
+    } catch {
+        return 0;
+    }
+}
+
+function setLastRefreshed(time: number): void {
+    try {
+        localStorage.setItem(REFRESHED_KEY, time.toString());
+    } catch {
+        // without storage every tab refreshes, which the gateway allows for
+    }
+}
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"context"
+
 	"github.com/sirupsen/logrus"
 	"ponglehub.co.uk/games/draughts/pkg/database"
 	"ponglehub.co.uk/games/draughts/pkg/routes"
@@ -10,18 +12,32 @@ import (
 func main() {
 	logrus.Infof("Starting server...")
 
+	shutdownTracing, err := events.InitTracing(context.Background(), "draughts")
+	if err != nil {
+		logrus.Fatalf("failed to initialise tracing: %+v", err)
+	}
+	defer shutdownTracing(context.Background())
+
 	db, err := database.New()
 	if err != nil {
 		logrus.Fatalf("failed to create database client: %+v", err)
 	}
 
-	events.Serve(events.ServeParams{
+	err = events.Serve(context.Background(), events.ServeParams{
 		BrokerEnv: "BROKER_URL",
 		Source:    "draughts",
-		Routes: events.EventRoutes{
-			"draughts.list-games": routes.ListGames(db),
-			"draughts.new-game":   routes.NewGame(db),
-			"draughts.load-game":  routes.LoadGame(db),
+		Metrics:   true,
+		Middlewares: []events.Middleware{
+			events.Logging(),
+			events.RateLimit(10, 20),
+		},
+		Handlers: events.TypedRoutes{
+			"draughts.list-games": events.Handle(routes.ListGames(db)),
+			"draughts.new-game":   events.Handle(routes.NewGame(db)),
+			"draughts.load-game":  events.Handle(routes.LoadGame(db)),
 		},
 	})
+	if err != nil {
+		logrus.Fatal(err)
+	}
 }
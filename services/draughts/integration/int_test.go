@@ -1,6 +1,7 @@
 package integration
 
 import (
+	"context"
 	"encoding/json"
 	"io"
 	"os"
@@ -185,7 +186,7 @@ func TestNewGameEvent(t *testing.T) {
 		CreatedTime: time.Now(),
 	}, actual["game"])
 
-	pieces, err := db.LoadPieces(actual["game"].ID.String())
+	pieces, err := db.LoadPieces(context.Background(), actual["game"].ID.String())
 	noErr(t, err)
 
 	matchers.AssertEqualPieces(t, []string{
@@ -265,7 +266,7 @@ func TestLoadGameEvent(t *testing.T) {
 			noErr(u, db.Clear())
 
 			noErr(u, db.InsertGame(test.existing))
-			noErr(u, db.NewPieces(rules.ToPieces(test.existing.ID, test.pieces)))
+			noErr(u, db.NewPieces(context.Background(), rules.ToPieces(test.existing.ID, test.pieces)))
 
 			err := eventClient.Send(
 				"draughts.load-game",
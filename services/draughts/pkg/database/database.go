@@ -47,9 +47,9 @@ func (d *Database) Clear() error {
 	return nil
 }
 
-func (d *Database) ListGames(user string) ([]Game, error) {
+func (d *Database) ListGames(ctx context.Context, user string) ([]Game, error) {
 	logrus.Infof("Listing games for user %s", user)
-	rows, err := d.conn.Query(context.TODO(), "SELECT id, player1, player2, turn, created_time, finished FROM games WHERE player1=$1 OR player2=$1", user)
+	rows, err := d.conn.Query(ctx, "SELECT id, player1, player2, turn, created_time, finished FROM games WHERE player1=$1 OR player2=$1", user)
 	if err != nil {
 		return nil, fmt.Errorf("error fetching games data: %+v", err)
 	}
@@ -84,13 +84,13 @@ func (d *Database) InsertGame(game Game) error {
 	return nil
 }
 
-func (d *Database) NewGame(player1 string, player2 string) (Game, error) {
+func (d *Database) NewGame(ctx context.Context, player1 string, player2 string) (Game, error) {
 	logrus.Infof("Starting new game between %s and %s", player1, player2)
 
 	created := time.Now()
 
 	row := d.conn.QueryRow(
-		context.TODO(),
+		ctx,
 		"INSERT INTO games (player1, player2, turn, created_time, finished) VALUES ($1, $2, 0, $3, false) RETURNING id",
 		player1, player2, created,
 	)
@@ -111,7 +111,7 @@ func (d *Database) NewGame(player1 string, player2 string) (Game, error) {
 	return game, nil
 }
 
-func (d *Database) NewPieces(pieces []Piece) error {
+func (d *Database) NewPieces(ctx context.Context, pieces []Piece) error {
 	query := "INSERT INTO pieces (game, x, y, player, king) VALUES "
 	args := []interface{}{}
 	index := 1
@@ -124,7 +124,7 @@ func (d *Database) NewPieces(pieces []Piece) error {
 
 	query = strings.TrimSuffix(query, ",")
 
-	cmd, err := d.conn.Exec(context.TODO(), query, args...)
+	cmd, err := d.conn.Exec(ctx, query, args...)
 	if err != nil {
 		return fmt.Errorf("failed to insert pieces: %+v", err)
 	}
@@ -134,9 +134,9 @@ func (d *Database) NewPieces(pieces []Piece) error {
 	return nil
 }
 
-func (d *Database) LoadGame(id string) (Game, error) {
+func (d *Database) LoadGame(ctx context.Context, id string) (Game, error) {
 	row := d.conn.QueryRow(
-		context.TODO(),
+		ctx,
 		"SELECT id, player1, player2, turn, created_time, finished FROM games WHERE id = $1",
 		id,
 	)
@@ -150,8 +150,8 @@ func (d *Database) LoadGame(id string) (Game, error) {
 	return game, nil
 }
 
-func (d *Database) LoadPieces(game string) ([]Piece, error) {
-	rows, err := d.conn.Query(context.TODO(), "SELECT id, game, x, y, player, king FROM pieces WHERE game = $1", game)
+func (d *Database) LoadPieces(ctx context.Context, game string) ([]Piece, error) {
+	rows, err := d.conn.Query(ctx, "SELECT id, game, x, y, player, king FROM pieces WHERE game = $1", game)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load pieces from database: %+v", err)
 	}
@@ -172,25 +172,25 @@ func (d *Database) LoadPieces(game string) ([]Piece, error) {
 	return pieces, nil
 }
 
-func (d *Database) Move(game uuid.UUID, piece uuid.UUID, x int16, y int16, king bool, toRemove []uuid.UUID) error {
-	tx, err := d.conn.Begin(context.TODO())
+func (d *Database) Move(ctx context.Context, game uuid.UUID, piece uuid.UUID, x int16, y int16, king bool, toRemove []uuid.UUID) error {
+	tx, err := d.conn.Begin(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to create context: %+v", err)
 	}
 	defer func() {
 		if err != nil {
-			tx.Rollback(context.TODO())
+			tx.Rollback(ctx)
 		} else {
-			tx.Commit(context.TODO())
+			tx.Commit(ctx)
 		}
 	}()
 
-	err = movePiece(tx, game, piece, x, y, king)
+	err = movePiece(ctx, tx, game, piece, x, y, king)
 	if err != nil {
 		return err
 	}
 
-	err = removePieces(tx, game, toRemove)
+	err = removePieces(ctx, tx, game, toRemove)
 	if err != nil {
 		return err
 	}
@@ -198,14 +198,14 @@ func (d *Database) Move(game uuid.UUID, piece uuid.UUID, x int16, y int16, king
 	return nil
 }
 
-func movePiece(tx pgx.Tx, game uuid.UUID, piece uuid.UUID, x int16, y int16, king bool) error {
+func movePiece(ctx context.Context, tx pgx.Tx, game uuid.UUID, piece uuid.UUID, x int16, y int16, king bool) error {
 	kingQuery := ""
 
 	if king {
 		kingQuery = ", king = true"
 	}
 
-	_, err := tx.Exec(context.TODO(), fmt.Sprintf("UPDATE pieces SET x = $1, y = $2 %s WHERE id = $3", kingQuery), x, y, piece)
+	_, err := tx.Exec(ctx, fmt.Sprintf("UPDATE pieces SET x = $1, y = $2 %s WHERE id = $3", kingQuery), x, y, piece)
 	if err != nil {
 		return fmt.Errorf("failed to update piece: %+v", err)
 	}
@@ -213,7 +213,7 @@ func movePiece(tx pgx.Tx, game uuid.UUID, piece uuid.UUID, x int16, y int16, kin
 	return nil
 }
 
-func removePieces(tx pgx.Tx, game uuid.UUID, ids []uuid.UUID) error {
+func removePieces(ctx context.Context, tx pgx.Tx, game uuid.UUID, ids []uuid.UUID) error {
 	placeholders := make([]string, len(ids))
 	params := make([]interface{}, len(ids)+1)
 	params[0] = game
@@ -225,7 +225,7 @@ func removePieces(tx pgx.Tx, game uuid.UUID, ids []uuid.UUID) error {
 
 	query := "DELETE FROM pieces WHERE game = $1 AND id IN (\"" + strings.Join(placeholders, ", ") + "\")"
 
-	_, err := tx.Exec(context.TODO(), query, params...)
+	_, err := tx.Exec(ctx, query, params...)
 	if err != nil {
 		return fmt.Errorf("failed to delete pieces: %+v", err)
 	}
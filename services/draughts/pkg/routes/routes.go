@@ -1,6 +1,7 @@
 package routes
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/google/uuid"
@@ -9,160 +10,134 @@ import (
 	"ponglehub.co.uk/lib/events"
 )
 
-func ListGames(db *database.Database) events.EventRoute {
-	return func(userId string, into events.EventParser) ([]events.Response, error) {
-		games, err := db.ListGames(userId)
+type GamesResponse struct {
+	Games []database.Game `json:"games"`
+}
+
+type GameResponse struct {
+	Game database.Game `json:"game"`
+}
+
+type GameStateResponse struct {
+	Game   database.Game    `json:"game"`
+	Pieces []database.Piece `json:"pieces"`
+}
+
+type PiecesResponse struct {
+	Pieces []database.Piece `json:"pieces"`
+}
+
+type NewGameRequest struct {
+	Opponent string `json:"opponent"`
+}
+
+type LoadGameRequest struct {
+	ID string `json:"id"`
+}
+
+type MoveRequest struct {
+	Game  string       `json:"game"`
+	Moves []rules.Move `json:"moves"`
+}
+
+func ListGames(db *database.Database) events.Handler[events.Empty, GamesResponse] {
+	return func(ctx context.Context, userId string, _ events.Empty) ([]events.Reply[GamesResponse], error) {
+		games, err := db.ListGames(ctx, userId)
 		if err != nil {
 			return nil, fmt.Errorf("error listing games: %+v", err)
 		}
 
-		return []events.Response{{
-			EventType: "response",
-			Data:      map[string]interface{}{"games": games},
-			UserId:    userId,
+		return []events.Reply[GamesResponse]{{
+			Data:   GamesResponse{Games: games},
+			UserId: userId,
 		}}, nil
 	}
 }
 
-func NewGame(db *database.Database) events.EventRoute {
-	return func(userId string, into events.EventParser) ([]events.Response, error) {
-		data := struct {
-			Opponent string `json:"opponent"`
-		}{}
-
-		err := into(&data)
-		if err != nil {
-			return nil, fmt.Errorf("failed to parse new game event data: %+v", err)
-		}
-
-		game, err := db.NewGame(userId, data.Opponent)
+func NewGame(db *database.Database) events.Handler[NewGameRequest, GameResponse] {
+	return func(ctx context.Context, userId string, data NewGameRequest) ([]events.Reply[GameResponse], error) {
+		game, err := db.NewGame(ctx, userId, data.Opponent)
 		if err != nil {
 			return nil, fmt.Errorf("failed to create new game: %+v", err)
 		}
 
 		pieces := rules.NewGame(game.ID)
-		err = db.NewPieces(pieces)
+		err = db.NewPieces(ctx, pieces)
 		if err != nil {
 			return nil, fmt.Errorf("failed to create new pieces: %+v", err)
 		}
 
-		responses := []events.Response{}
+		replies := []events.Reply[GameResponse]{}
 		for _, id := range []string{userId, data.Opponent} {
-			responses = append(responses, events.Response{
-				EventType: "response",
-				Data: map[string]interface{}{
-					"game": game,
-				},
+			replies = append(replies, events.Reply[GameResponse]{
+				Data:   GameResponse{Game: game},
 				UserId: id,
 			})
 		}
 
-		return responses, nil
+		return replies, nil
 	}
 }
 
-func LoadGame(db *database.Database) events.EventRoute {
-	return func(userId string, into events.EventParser) ([]events.Response, error) {
-		data := struct {
-			ID string `json:"id"`
-		}{}
-		err := into(&data)
-		if err != nil {
-			return nil, fmt.Errorf("failed to parse load game args %s: %+v", data.ID, err)
-		}
-
-		game, err := db.LoadGame(data.ID)
+func LoadGame(db *database.Database) events.Handler[LoadGameRequest, GameStateResponse] {
+	return func(ctx context.Context, userId string, data LoadGameRequest) ([]events.Reply[GameStateResponse], error) {
+		game, err := db.LoadGame(ctx, data.ID)
 		if err != nil {
 			return nil, fmt.Errorf("failed to load game data %s: %+v", data.ID, err)
 		}
 
-		pieces, err := db.LoadPieces(data.ID)
+		pieces, err := db.LoadPieces(ctx, data.ID)
 		if err != nil {
 			return nil, fmt.Errorf("failed to load game pieces %s: %+v", data.ID, err)
 		}
 
-		return []events.Response{{
-			EventType: "response",
-			Data: map[string]interface{}{
-				"game":   game,
-				"pieces": pieces,
-			},
+		return []events.Reply[GameStateResponse]{{
+			Data:   GameStateResponse{Game: game, Pieces: pieces},
 			UserId: userId,
 		}}, nil
 	}
 }
 
-func Move(db *database.Database) events.EventRoute {
-	return func(userId string, into events.EventParser) ([]events.Response, error) {
-		data := struct {
-			Game  string       `json:"game"`
-			Moves []rules.Move `json:"moves"`
-		}{}
-
-		err := into(&data)
-		if err != nil {
-			return nil, fmt.Errorf("failed to parse move data: %+v", err)
-		}
-
-		game, err := db.LoadGame(data.Game)
+func Move(db *database.Database) events.Handler[MoveRequest, PiecesResponse] {
+	return func(ctx context.Context, userId string, data MoveRequest) ([]events.Reply[PiecesResponse], error) {
+		game, err := db.LoadGame(ctx, data.Game)
 		if err != nil {
 			return nil, fmt.Errorf("failed to load game: %+v", err)
 		}
 
 		if !rules.IsYourTurn(userId, game) {
-			return []events.Response{{
-				EventType: "rejection.response",
-				Data:      map[string]interface{}{"message": "it's not your turn"},
-				UserId:    userId,
-			}}, fmt.Errorf("user %s made a move when it wasn't their turn", userId)
+			return nil, events.Reject("it's not your turn", fmt.Errorf("user %s made a move when it wasn't their turn", userId))
 		}
 
-		pieces, err := db.LoadPieces(data.Game)
+		pieces, err := db.LoadPieces(ctx, data.Game)
 		if err != nil {
-			return []events.Response{{
-				EventType: "rejection.response",
-				Data:      map[string]interface{}{"message": "server error"},
-				UserId:    userId,
-			}}, fmt.Errorf("failed to fetch pieces before user %s move: %+v", userId, err)
+			return nil, fmt.Errorf("failed to fetch pieces before user %s move: %+v", userId, err)
 		}
 
 		result, err := rules.Process(data.Moves, pieces)
 		if err != nil {
-			return []events.Response{{
-				EventType: "rejection.response",
-				Data:      map[string]interface{}{"message": "invalid move"},
-				UserId:    userId,
-			}}, fmt.Errorf("user %s made an invalid move: %+v", userId, err)
+			return nil, events.Reject("invalid move", fmt.Errorf("user %s made an invalid move: %+v", userId, err))
 		}
 
-		err = db.Move(game.ID, result.Piece, result.NewX, result.NewY, result.King, result.ToRemove)
+		err = db.Move(ctx, game.ID, result.Piece, result.NewX, result.NewY, result.King, result.ToRemove)
 		if err != nil {
-			return []events.Response{{
-				EventType: "rejection.response",
-				Data:      map[string]interface{}{"message": "server error"},
-				UserId:    userId,
-			}}, fmt.Errorf("failed to process user %s move: %+v", userId, err)
+			return nil, fmt.Errorf("failed to process user %s move: %+v", userId, err)
 		}
 
-		pieces, err = db.LoadPieces(game.ID.String())
+		pieces, err = db.LoadPieces(ctx, game.ID.String())
 		if err != nil {
-			return []events.Response{{
-				EventType: "rejection.response",
-				Data:      map[string]interface{}{"message": "server error"},
-				UserId:    userId,
-			}}, fmt.Errorf("failed to fetch pieces after user %s move: %+v", userId, err)
+			return nil, fmt.Errorf("failed to fetch pieces after user %s move: %+v", userId, err)
 		}
 
-		responses := []events.Response{}
+		replies := []events.Reply[PiecesResponse]{}
 
 		for _, id := range []uuid.UUID{game.Player1, game.Player2} {
-			responses = append(responses, events.Response{
-				EventType: "response",
-				Data:      map[string]interface{}{"pieces": pieces},
-				UserId:    id.String(),
+			replies = append(replies, events.Reply[PiecesResponse]{
+				Data:   PiecesResponse{Pieces: pieces},
+				UserId: id.String(),
 			})
 		}
 
-		return responses, nil
+		return replies, nil
 	}
 }
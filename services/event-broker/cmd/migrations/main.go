@@ -0,0 +1,50 @@
+package main
+
+import (
+	"github.com/sirupsen/logrus"
+	"ponglehub.co.uk/lib/postgres/pkg/connect"
+	"ponglehub.co.uk/lib/postgres/pkg/migrate"
+	"ponglehub.co.uk/lib/postgres/pkg/types"
+)
+
+func main() {
+	logrus.Infof("Starting migrations...")
+
+	cfg, err := connect.ConfigFromEnv()
+	if err != nil {
+		logrus.Fatalf("Failed to get postgres config: %+v", err)
+	}
+
+	err = migrate.Migrate(
+		cfg,
+		[]types.Migration{
+			{
+				Query: `
+					BEGIN;
+
+					SAVEPOINT events_restart;
+
+					CREATE TABLE events (
+						seq SERIAL PRIMARY KEY,
+						source STRING NOT NULL,
+						id STRING NOT NULL,
+						type STRING NOT NULL,
+						received TIMESTAMPTZ NOT NULL,
+						event JSONB NOT NULL,
+						UNIQUE (source, id),
+						INDEX (received)
+					);
+
+					RELEASE SAVEPOINT events_restart;
+
+					COMMIT;
+				`,
+			},
+		},
+	)
+	if err != nil {
+		logrus.Fatalf("Migrations failed: %+v", err)
+	}
+
+	logrus.Infof("Done.")
+}
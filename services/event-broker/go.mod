@@ -3,15 +3,24 @@ module ponglehub.co.uk/events/broker
 go 1.16
 
 require (
+	github.com/alicebob/miniredis/v2 v2.23.1
 	github.com/cloudevents/sdk-go/v2 v2.7.0
+	github.com/go-redis/redis/v8 v8.11.5
+	github.com/jackc/pgx/v4 v4.13.0
+	github.com/prometheus/client_golang v1.11.0
 	github.com/sirupsen/logrus v1.8.1
 	github.com/stretchr/testify v1.7.0
+	go.opentelemetry.io/otel v1.4.1
+	go.opentelemetry.io/otel/trace v1.4.1
 	k8s.io/apimachinery v0.23.1
 	k8s.io/client-go v0.23.1
 	ponglehub.co.uk/events/recorder v1.0.0
+	ponglehub.co.uk/lib/postgres v1.0.0
 	ponglehub.co.uk/lib/events v1.0.0
 )
 
 replace ponglehub.co.uk/lib/events => ./../../libraries/golang/events
 
 replace ponglehub.co.uk/events/recorder => ./../event-recorder
+
+replace ponglehub.co.uk/lib/postgres => ./../../libraries/golang/postgres
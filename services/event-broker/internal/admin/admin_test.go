@@ -0,0 +1,209 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/cloudevents/sdk-go/v2/event"
+	"github.com/stretchr/testify/assert"
+	"ponglehub.co.uk/events/broker/internal/crds"
+	"ponglehub.co.uk/events/broker/internal/router"
+	"ponglehub.co.uk/events/broker/internal/store"
+	"ponglehub.co.uk/events/broker/internal/triggers"
+	"ponglehub.co.uk/events/broker/pkg/admin"
+	"ponglehub.co.uk/lib/events"
+)
+
+func TestAdminAPI(t *testing.T) {
+	r := router.New()
+	r.Add("naughts-and-crosses.*", "games/naughts-and-crosses")
+	r.Add("**.response", "games/responder")
+	r.Add("naughts-and-crosses.**", "games/audit")
+
+	audit, err := triggers.NewFilter([]crds.AttributeFilter{{Exact: map[string]string{"source": "client"}}})
+	assert.NoError(t, err)
+
+	tr := triggers.New()
+	tr.Set("games/naughts-and-crosses", triggers.Trigger{URL: "http://naughts-and-crosses"})
+	tr.Set("games/responder", triggers.Trigger{URL: "http://responder"})
+	tr.Set("games/audit", triggers.Trigger{URL: "http://audit", Filter: audit})
+
+	tracker := NewTracker(2)
+
+	server := httptest.NewServer(Handler(HandlerArgs{Token: "secret", Router: r, Triggers: tr, Deliveries: tracker}))
+	defer server.Close()
+
+	client := admin.NewClient(server.URL, "secret")
+
+	routes, err := client.Routes()
+	assert.NoError(t, err)
+	assert.Equal(t, []admin.Route{
+		{Filter: "**.response", Target: admin.Target{Trigger: "games/responder", URL: "http://responder"}},
+		{Filter: "naughts-and-crosses.*", Target: admin.Target{Trigger: "games/naughts-and-crosses", URL: "http://naughts-and-crosses"}},
+		{Filter: "naughts-and-crosses.**", Target: admin.Target{Trigger: "games/audit", URL: "http://audit"}},
+	}, routes)
+
+	targets, err := client.TestRoute("naughts-and-crosses.mark", nil)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []admin.Target{
+		{Trigger: "games/naughts-and-crosses", URL: "http://naughts-and-crosses"},
+	}, targets)
+
+	targets, err = client.TestRoute("naughts-and-crosses.mark", map[string]string{"source": "client"})
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []admin.Target{
+		{Trigger: "games/naughts-and-crosses", URL: "http://naughts-and-crosses"},
+		{Trigger: "games/audit", URL: "http://audit"},
+	}, targets)
+
+	event := cloudevents.NewEvent()
+	event.SetID("event-id")
+	event.SetType("naughts-and-crosses.mark")
+
+	inflight := tracker.Start("http://naughts-and-crosses", event)
+	for i := 0; i < 3; i++ {
+		tracker.Start("http://audit", event)(&events.DeliveryError{StatusCode: 503, Err: errors.New("unavailable")})
+	}
+	tracker.Start("http://responder", event)(nil)
+
+	deliveries, err := client.Deliveries()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(deliveries.InFlight))
+	assert.Equal(t, "http://naughts-and-crosses", deliveries.InFlight[0].URL)
+	assert.Equal(t, 2, len(deliveries.Failed))
+	assert.Equal(t, "http://audit", deliveries.Failed[0].URL)
+	assert.Equal(t, 503, deliveries.Failed[0].StatusCode)
+	assert.Equal(t, "unavailable", deliveries.Failed[0].Error)
+
+	inflight(nil)
+
+	deliveries, err = client.Deliveries()
+	assert.NoError(t, err)
+	assert.Empty(t, deliveries.InFlight)
+}
+
+type stubStore struct {
+	records []store.Record
+}
+
+func (s *stubStore) Events(ctx context.Context, query store.Query) ([]store.Record, error) {
+	records := []store.Record{}
+
+	for _, record := range s.records {
+		if record.Seq <= query.After || record.Received.Before(query.From) || (!query.To.IsZero() && !record.Received.Before(query.To)) {
+			continue
+		}
+
+		records = append(records, record)
+		if len(records) == query.Limit {
+			break
+		}
+	}
+
+	return records, nil
+}
+
+func TestEventStore(t *testing.T) {
+	r := router.New()
+	r.Add("naughts-and-crosses.*", "games/naughts-and-crosses")
+
+	tr := triggers.New()
+	tr.Set("games/naughts-and-crosses", triggers.Trigger{URL: "http://naughts-and-crosses"})
+
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	stored := &stubStore{}
+	for i := 0; i < 250; i++ {
+		event := cloudevents.NewEvent()
+		event.SetID(fmt.Sprintf("event-%d", i))
+		event.SetSource("client")
+		event.SetType("naughts-and-crosses.mark")
+		if i%2 == 1 {
+			event.SetType("draughts.move")
+		}
+
+		stored.records = append(stored.records, store.Record{Seq: int64(i + 1), Received: start.Add(time.Duration(i) * time.Second), Event: event})
+	}
+
+	replayed := []string{}
+	server := httptest.NewServer(Handler(HandlerArgs{
+		Token:    "secret",
+		Router:   r,
+		Triggers: tr,
+		Store:    stored,
+		Replay: func(ctx context.Context, trigger string, event event.Event) error {
+			assert.Equal(t, "games/naughts-and-crosses", trigger)
+			replayed = append(replayed, event.ID())
+			return nil
+		},
+		Replays: NewReplays(10),
+		Context: context.Background(),
+	}))
+	defer server.Close()
+
+	client := admin.NewClient(server.URL, "secret")
+
+	records, err := client.Events(admin.EventQuery{From: start.Add(10 * time.Second), Filter: "type = 'draughts.move'"}, 0, 3)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(records))
+	assert.Equal(t, "event-11", records[0].Event.ID())
+	assert.Equal(t, "event-15", records[2].Event.ID())
+
+	records, err = client.Events(admin.EventQuery{From: start}, 248, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(records))
+
+	job, err := client.Replay("games/naughts-and-crosses", admin.EventQuery{From: start, To: start.Add(240 * time.Second)})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "games/naughts-and-crosses", job.Trigger)
+
+	assert.Eventually(t, func() bool {
+		job, err = client.ReplayStatus(job.ID)
+		return err == nil && job.Status != admin.ReplayRunning
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, admin.ReplayFinished, job.Status)
+	assert.Equal(t, admin.Replay{Replayed: 120}, job.Replay)
+	assert.Equal(t, "event-0", replayed[0])
+	assert.Equal(t, "event-238", replayed[119])
+
+	_, err = client.Replay("games/unknown", admin.EventQuery{From: start})
+	assert.Error(t, err)
+
+	_, err = client.ReplayStatus("unknown")
+	assert.Error(t, err)
+
+	_, err = client.Events(admin.EventQuery{From: start, Filter: "type ="}, 0, 10)
+	assert.Error(t, err)
+}
+
+func TestAdminAuth(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		token  string
+		client string
+		err    bool
+	}{
+		{name: "valid token", token: "secret", client: "secret"},
+		{name: "wrong token", token: "secret", client: "guess", err: true},
+		{name: "no token", token: "secret", client: "", err: true},
+		{name: "not configured", token: "", client: "", err: true},
+	} {
+		t.Run(test.name, func(u *testing.T) {
+			server := httptest.NewServer(Handler(HandlerArgs{Token: test.token, Router: router.New(), Triggers: triggers.New(), Deliveries: NewTracker(1)}))
+			defer server.Close()
+
+			_, err := admin.NewClient(server.URL, test.client).Routes()
+			if test.err {
+				assert.Error(u, err)
+			} else {
+				assert.NoError(u, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,336 @@
+package admin
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/cloudevents/sdk-go/v2/event"
+	"github.com/sirupsen/logrus"
+	"ponglehub.co.uk/events/broker/internal/crds"
+	"ponglehub.co.uk/events/broker/internal/router"
+	"ponglehub.co.uk/events/broker/internal/store"
+	"ponglehub.co.uk/events/broker/internal/triggers"
+	"ponglehub.co.uk/events/broker/pkg/admin"
+)
+
+// EventStore reads the events the broker has accepted, see the store package
+type EventStore interface {
+	Events(ctx context.Context, query store.Query) ([]store.Record, error)
+}
+
+type HandlerArgs struct {
+	// Token must be sent as a bearer token on every request, without it every request is refused
+	Token      string
+	Router     *router.Router
+	Triggers   *triggers.Triggers
+	Deliveries *Tracker
+	// Store optionally serves stored events, without it the events and replay endpoints aren't available
+	Store EventStore
+	// Replay delivers a stored event to a trigger, by its key
+	Replay func(ctx context.Context, trigger string, event event.Event) error
+	// Replays runs replays in the background until Context is cancelled, e.g. when the broker stops
+	Replays *Replays
+	Context context.Context
+}
+
+// pageSize is how many stored events are read at a time
+const pageSize = 100
+
+// Handler serves the broker's routing table, deliveries and event store under /admin, see the pkg/admin client
+func Handler(args HandlerArgs) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !authorised(args.Token, r) {
+			http.Error(w, "unauthorised", http.StatusUnauthorized)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/admin/routes":
+			respond(w, http.StatusOK, routes(args))
+		case "/admin/routes/test":
+			eventType := r.URL.Query().Get("type")
+			if eventType == "" {
+				http.Error(w, "missing type parameter", http.StatusBadRequest)
+				return
+			}
+
+			respond(w, http.StatusOK, testRoute(args, eventType, r.URL.Query()))
+		case "/admin/deliveries":
+			respond(w, http.StatusOK, args.Deliveries.Deliveries())
+		case "/admin/events":
+			if args.Store == nil {
+				http.Error(w, "event store not enabled", http.StatusNotImplemented)
+				return
+			}
+
+			query, filter, err := parseQuery(r.URL.Query())
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			records, err := storedEvents(r.Context(), args, query, filter)
+			if err != nil {
+				logrus.Errorf("Failed to read stored events: %+v", err)
+				http.Error(w, "failed to read stored events", http.StatusInternalServerError)
+				return
+			}
+
+			respond(w, http.StatusOK, records)
+		case "/admin/replay":
+			if args.Store == nil {
+				http.Error(w, "event store not enabled", http.StatusNotImplemented)
+				return
+			}
+
+			if r.Method == http.MethodGet {
+				job, ok := args.Replays.Get(r.URL.Query().Get("id"))
+				if !ok {
+					http.Error(w, "unknown replay", http.StatusNotFound)
+					return
+				}
+
+				respond(w, http.StatusOK, job)
+				return
+			}
+
+			if r.Method != http.MethodPost {
+				http.Error(w, "replays are started with a POST", http.StatusMethodNotAllowed)
+				return
+			}
+
+			key := r.URL.Query().Get("trigger")
+			trigger, ok := args.Triggers.Lookup(key)
+			if key == "" || !ok {
+				http.Error(w, "unknown trigger", http.StatusNotFound)
+				return
+			}
+
+			query, filter, err := parseQuery(r.URL.Query())
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			job, err := args.Replays.Start(args.Context, key, func(ctx context.Context, progress func(admin.Replay)) error {
+				err := replay(ctx, args, key, trigger, query, filter, progress)
+				if err != nil {
+					logrus.Errorf("Failed to replay events to %s: %+v", key, err)
+				}
+
+				return err
+			})
+			if err != nil {
+				logrus.Errorf("Failed to start replay to %s: %+v", key, err)
+				http.Error(w, "failed to start replay", http.StatusInternalServerError)
+				return
+			}
+
+			respond(w, http.StatusAccepted, job)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}
+}
+
+func authorised(token string, r *http.Request) bool {
+	if token == "" {
+		return false
+	}
+
+	given := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(given), []byte(token)) == 1
+}
+
+// parseQuery reads the time range and CESQL filter for the event store endpoints
+func parseQuery(values url.Values) (store.Query, triggers.Filter, error) {
+	query := store.Query{Limit: pageSize}
+
+	from := values.Get("from")
+	if from == "" {
+		return query, nil, errors.New("missing from parameter")
+	}
+
+	var err error
+	query.From, err = time.Parse(time.RFC3339Nano, from)
+	if err != nil {
+		return query, nil, fmt.Errorf("invalid from parameter: %+v", err)
+	}
+
+	if to := values.Get("to"); to != "" {
+		query.To, err = time.Parse(time.RFC3339Nano, to)
+		if err != nil {
+			return query, nil, fmt.Errorf("invalid to parameter: %+v", err)
+		}
+	}
+
+	if after := values.Get("after"); after != "" {
+		query.After, err = strconv.ParseInt(after, 10, 64)
+		if err != nil {
+			return query, nil, fmt.Errorf("invalid after parameter: %+v", err)
+		}
+	}
+
+	if limit := values.Get("limit"); limit != "" {
+		query.Limit, err = strconv.Atoi(limit)
+		if err != nil || query.Limit <= 0 {
+			return query, nil, fmt.Errorf("invalid limit parameter: %s", limit)
+		}
+	}
+
+	filter, err := triggers.NewFilter([]crds.AttributeFilter{{CESQL: values.Get("filter")}})
+	if err != nil {
+		return query, nil, err
+	}
+
+	return query, filter, nil
+}
+
+// page calls each for every stored event matching the query and filter, reading them a page at a time until each
+// returns false or there aren't any more
+func page(ctx context.Context, args HandlerArgs, query store.Query, filter triggers.Filter, each func(record store.Record) bool) error {
+	query.Limit = pageSize
+
+	for {
+		records, err := args.Store.Events(ctx, query)
+		if err != nil {
+			return err
+		}
+
+		for _, record := range records {
+			if filter.Matches(record.Event) && !each(record) {
+				return nil
+			}
+		}
+
+		if len(records) < query.Limit {
+			return nil
+		}
+
+		query.After = records[len(records)-1].Seq
+	}
+}
+
+func storedEvents(ctx context.Context, args HandlerArgs, query store.Query, filter triggers.Filter) ([]admin.Record, error) {
+	limit := query.Limit
+	records := []admin.Record{}
+
+	err := page(ctx, args, query, filter, func(record store.Record) bool {
+		records = append(records, admin.Record{Seq: record.Seq, Received: record.Received, Event: record.Event})
+		return len(records) < limit
+	})
+
+	return records, err
+}
+
+// replay re-delivers the stored events to a trigger, one at a time in the order they were received, skipping any
+// that the trigger wouldn't be sent now, and reporting its progress after each one
+func replay(ctx context.Context, args HandlerArgs, key string, trigger triggers.Trigger, query store.Query, filter triggers.Filter, progress func(admin.Replay)) error {
+	result := admin.Replay{}
+
+	err := page(ctx, args, query, filter, func(record store.Record) bool {
+		if !routed(args.Router, key, record.Event.Type()) || !trigger.Filter.Matches(record.Event) {
+			return true
+		}
+
+		err := args.Replay(ctx, key, record.Event)
+		if err != nil {
+			logrus.Errorf("Failed to replay event %s to %s: %+v", record.Event.ID(), key, err)
+			result.Failed += 1
+		} else {
+			result.Replayed += 1
+		}
+		progress(result)
+
+		return ctx.Err() == nil
+	})
+	if err == nil {
+		err = ctx.Err()
+	}
+
+	return err
+}
+
+func routed(r *router.Router, key string, eventType string) bool {
+	for _, target := range r.GetURLs(eventType) {
+		if target == key {
+			return true
+		}
+	}
+
+	return false
+}
+
+// respond writes the body as json, headers have to be set before the status code for them to be sent
+func respond(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	err := json.NewEncoder(w).Encode(body)
+	if err != nil {
+		logrus.Errorf("Failed to write admin response: %+v", err)
+	}
+}
+
+func routes(args HandlerArgs) []admin.Route {
+	routes := []admin.Route{}
+
+	for _, route := range args.Router.Routes() {
+		trigger, ok := args.Triggers.Lookup(route.Target)
+		if !ok {
+			continue
+		}
+
+		for i := 0; i < route.Count; i++ {
+			routes = append(routes, admin.Route{
+				Filter: route.Filter,
+				Target: admin.Target{Trigger: route.Target, URL: trigger.URL},
+			})
+		}
+	}
+
+	return routes
+}
+
+// testRoute builds an event from the query, setting the other parameters as attributes or extensions so that they
+// can be matched by attribute filters, and resolves it as if the broker had received it
+func testRoute(args HandlerArgs, eventType string, query map[string][]string) []admin.Target {
+	event := cloudevents.NewEvent()
+	event.SetType(eventType)
+
+	for name, values := range query {
+		name = strings.ToLower(name)
+		value := values[0]
+
+		switch name {
+		case "type":
+		case "id":
+			event.SetID(value)
+		case "source":
+			event.SetSource(value)
+		case "subject":
+			event.SetSubject(value)
+		default:
+			event.SetExtension(name, value)
+		}
+	}
+
+	targets := []admin.Target{}
+	for _, target := range args.Router.GetURLs(eventType) {
+		url, ok := args.Triggers.Resolve(target, event)
+		if ok {
+			targets = append(targets, admin.Target{Trigger: target, URL: url})
+		}
+	}
+
+	return targets
+}
@@ -0,0 +1,88 @@
+package admin
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"ponglehub.co.uk/events/broker/pkg/admin"
+)
+
+// Replays runs replays in the background, so that they aren't cut short by the request that started them, keeping
+// the most recent ones for their progress to be polled
+type Replays struct {
+	lock  sync.Mutex
+	jobs  map[string]*admin.ReplayJob
+	order []string
+	limit int
+}
+
+// NewReplays creates a Replays remembering up to limit replays
+func NewReplays(limit int) *Replays {
+	return &Replays{
+		jobs:  map[string]*admin.ReplayJob{},
+		order: []string{},
+		limit: limit,
+	}
+}
+
+// Start runs the replay until it finishes or ctx is cancelled, passing it a function to report its progress with
+func (r *Replays) Start(ctx context.Context, trigger string, run func(ctx context.Context, progress func(admin.Replay)) error) (admin.ReplayJob, error) {
+	random := make([]byte, 8)
+	_, err := rand.Read(random)
+	if err != nil {
+		return admin.ReplayJob{}, err
+	}
+
+	job := &admin.ReplayJob{
+		ID:      hex.EncodeToString(random),
+		Trigger: trigger,
+		Status:  admin.ReplayRunning,
+		Started: time.Now(),
+	}
+
+	r.lock.Lock()
+	r.jobs[job.ID] = job
+	r.order = append(r.order, job.ID)
+	if len(r.order) > r.limit {
+		delete(r.jobs, r.order[0])
+		r.order = r.order[1:]
+	}
+	started := *job
+	r.lock.Unlock()
+
+	go func() {
+		err := run(ctx, func(progress admin.Replay) {
+			r.lock.Lock()
+			defer r.lock.Unlock()
+
+			job.Replay = progress
+		})
+
+		r.lock.Lock()
+		defer r.lock.Unlock()
+
+		job.Status = admin.ReplayFinished
+		if err != nil {
+			job.Status = admin.ReplayFailed
+			job.Error = err.Error()
+		}
+	}()
+
+	return started, nil
+}
+
+// Get returns the replay's progress, or false if it's unknown or has been forgotten
+func (r *Replays) Get(id string) (admin.ReplayJob, bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	job, ok := r.jobs[id]
+	if !ok {
+		return admin.ReplayJob{}, false
+	}
+
+	return *job, true
+}
@@ -0,0 +1,94 @@
+package admin
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/cloudevents/sdk-go/v2/event"
+	"ponglehub.co.uk/events/broker/pkg/admin"
+	"ponglehub.co.uk/lib/events"
+)
+
+// Tracker keeps the deliveries in flight and the most recent failures, for the admin endpoints
+type Tracker struct {
+	lock     sync.Mutex
+	next     uint64
+	inflight map[uint64]admin.Delivery
+	failed   []admin.Failure
+	limit    int
+}
+
+// NewTracker creates a tracker remembering up to limit failed deliveries
+func NewTracker(limit int) *Tracker {
+	return &Tracker{
+		inflight: map[uint64]admin.Delivery{},
+		failed:   []admin.Failure{},
+		limit:    limit,
+	}
+}
+
+// Start records a delivery of the event to url, returning a function to call with the result once it's finished
+func (t *Tracker) Start(url string, event event.Event) func(err error) {
+	if t == nil {
+		return func(error) {}
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	id := t.next
+	t.next += 1
+
+	delivery := admin.Delivery{
+		EventID:   event.ID(),
+		EventType: event.Type(),
+		URL:       url,
+		Started:   time.Now(),
+	}
+	t.inflight[id] = delivery
+
+	return func(err error) {
+		t.lock.Lock()
+		defer t.lock.Unlock()
+
+		delete(t.inflight, id)
+
+		if err == nil {
+			return
+		}
+
+		t.failed = append(t.failed, admin.Failure{
+			Delivery:   delivery,
+			Finished:   time.Now(),
+			StatusCode: events.StatusCode(err),
+			Error:      err.Error(),
+		})
+
+		if len(t.failed) > t.limit {
+			t.failed = t.failed[len(t.failed)-t.limit:]
+		}
+	}
+}
+
+func (t *Tracker) Deliveries() admin.Deliveries {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	deliveries := admin.Deliveries{
+		InFlight: make([]admin.Delivery, 0, len(t.inflight)),
+		Failed:   make([]admin.Failure, len(t.failed)),
+	}
+
+	for _, delivery := range t.inflight {
+		deliveries.InFlight = append(deliveries.InFlight, delivery)
+	}
+
+	sort.Slice(deliveries.InFlight, func(i, j int) bool {
+		return deliveries.InFlight[i].Started.Before(deliveries.InFlight[j].Started)
+	})
+
+	copy(deliveries.Failed, t.failed)
+
+	return deliveries
+}
@@ -2,12 +2,15 @@ package crds
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"os"
+	"reflect"
 
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/rest"
@@ -101,7 +104,8 @@ func (c *Client) Listen(handler ChangedHandler) (cache.Store, chan<- struct{}) {
 				oldTrigger := oldObj.(*EventTrigger)
 				newTrigger := newObj.(*EventTrigger)
 
-				if oldTrigger.ResourceVersion != newTrigger.ResourceVersion {
+				// status updates change the resource version too, but don't affect routing
+				if !reflect.DeepEqual(oldTrigger.Spec, newTrigger.Spec) {
 					handler(oldTrigger, newTrigger)
 				}
 			},
@@ -118,6 +122,60 @@ func (c *Client) Listen(handler ChangedHandler) (cache.Store, chan<- struct{}) {
 	return clientStore, stopper
 }
 
+func (c *Client) listPublishers(opts v1.ListOptions) (*EventPublisherList, error) {
+	result := EventPublisherList{}
+	err := c.restClient.
+		Get().
+		Resource("eventpublishers").
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Do(context.TODO()).
+		Into(&result)
+
+	return &result, err
+}
+
+func (c *Client) watchPublishers(opts v1.ListOptions) (watch.Interface, error) {
+	opts.Watch = true
+	return c.restClient.
+		Get().
+		Resource("eventpublishers").
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Watch(context.TODO())
+}
+
+type PublisherChangedHandler func(oldPublisher *EventPublisher, newPublisher *EventPublisher)
+
+func (c *Client) ListenPublishers(handler PublisherChangedHandler) chan<- struct{} {
+	_, clientController := cache.NewInformer(
+		&cache.ListWatch{
+			ListFunc: func(lo v1.ListOptions) (result runtime.Object, err error) {
+				return c.listPublishers(lo)
+			},
+			WatchFunc: func(lo v1.ListOptions) (watch.Interface, error) {
+				return c.watchPublishers(lo)
+			},
+		},
+		&EventPublisher{},
+		0,
+		cache.ResourceEventHandlerFuncs{
+			AddFunc: func(obj interface{}) {
+				handler(nil, obj.(*EventPublisher))
+			},
+			UpdateFunc: func(oldObj interface{}, newObj interface{}) {
+				handler(oldObj.(*EventPublisher), newObj.(*EventPublisher))
+			},
+			DeleteFunc: func(obj interface{}) {
+				handler(obj.(*EventPublisher), nil)
+			},
+		},
+	)
+
+	stopper := make(chan struct{})
+	go clientController.Run(stopper)
+
+	return stopper
+}
+
 func (c *Client) Create(name string, namespace string, filters []string, url string) error {
 	trigger := EventTrigger{
 		ObjectMeta: v1.ObjectMeta{
@@ -156,3 +214,21 @@ func (c *Client) Delete(name string, namespace string) error {
 		Do(context.TODO()).
 		Error()
 }
+
+func (c *Client) UpdateStatus(name string, namespace string, status EventTriggerStatus) error {
+	patch, err := json.Marshal(map[string]interface{}{"status": status})
+	if err != nil {
+		return fmt.Errorf("failed to serialise status: %+v", err)
+	}
+
+	return c.restClient.
+		Patch(types.MergePatchType).
+		Namespace(namespace).
+		Resource("eventtriggers").
+		Name(name).
+		SubResource("status").
+		VersionedParams(&v1.PatchOptions{}, scheme.ParameterCodec).
+		Body(patch).
+		Do(context.TODO()).
+		Error()
+}
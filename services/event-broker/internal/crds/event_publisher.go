@@ -0,0 +1,27 @@
+package crds
+
+import metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+// EventPublisherSpec is what a publisher may send to the broker, the publisher signs its events with the key of the
+// same name in the broker's publisher keys
+type EventPublisherSpec struct {
+	// Sources are the values the publisher may set as the events' source, e.g. "client" for the gateway
+	Sources []string `json:"sources"`
+	// Types are the event types the publisher may send, as router filters e.g. "naughts-and-crosses.*"
+	Types []string `json:"types"`
+}
+
+// EventPublisher is cluster scoped, its name identifies the publisher
+type EventPublisher struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec EventPublisherSpec `json:"spec"`
+}
+
+type EventPublisherList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+
+	Items []EventPublisher `json:"items"`
+}
@@ -0,0 +1,40 @@
+package crds
+
+import "k8s.io/apimachinery/pkg/runtime"
+
+// DeepCopyInto copies all properties of this object into another object of the
+// same type that is provided as a pointer.
+func (in *EventPublisher) DeepCopyInto(out *EventPublisher) {
+	out.TypeMeta = in.TypeMeta
+	out.ObjectMeta = in.ObjectMeta
+
+	out.Spec.Sources = make([]string, len(in.Spec.Sources))
+	copy(out.Spec.Sources, in.Spec.Sources)
+
+	out.Spec.Types = make([]string, len(in.Spec.Types))
+	copy(out.Spec.Types, in.Spec.Types)
+}
+
+// DeepCopyObject returns a generically typed copy of an object
+func (in *EventPublisher) DeepCopyObject() runtime.Object {
+	out := EventPublisher{}
+	in.DeepCopyInto(&out)
+
+	return &out
+}
+
+// DeepCopyObject returns a generically typed copy of an object
+func (in *EventPublisherList) DeepCopyObject() runtime.Object {
+	out := EventPublisherList{}
+	out.TypeMeta = in.TypeMeta
+	out.ListMeta = in.ListMeta
+
+	if in.Items != nil {
+		out.Items = make([]EventPublisher, len(in.Items))
+		for i := range in.Items {
+			in.Items[i].DeepCopyInto(&out.Items[i])
+		}
+	}
+
+	return &out
+}
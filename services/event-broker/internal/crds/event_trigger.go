@@ -2,16 +2,72 @@ package crds
 
 import metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
+const (
+	UnorderedDelivery = "unordered"
+	// KeyOrderedDelivery delivers events with the same ordering key one at a time, in the order received
+	KeyOrderedDelivery = "key"
+)
+
 type EventTriggerSpec struct {
 	URL     string   `json:"url"`
 	Filters []string `json:"filters"`
+	// Attributes narrows down the events matched by Filters, every attribute filter has to match
+	Attributes []AttributeFilter `json:"attributes,omitempty"`
+	// Timeout limits each delivery attempt, as a duration string e.g. "5s"
+	Timeout string `json:"timeout,omitempty"`
+	// Retry overrides the broker's default retry policy
+	Retry *RetrySpec `json:"retry,omitempty"`
+	// MaxConcurrency limits the deliveries in flight to the subscriber, zero for the broker's default of 100
+	MaxConcurrency int `json:"maxConcurrency,omitempty"`
+	// MaxPending limits the events waiting for the subscriber before the broker rejects new ones with a 429, zero
+	// for the broker's default of 1000
+	MaxPending int `json:"maxPending,omitempty"`
+	// Ordering is KeyOrderedDelivery (the default) or UnorderedDelivery
+	Ordering string `json:"ordering,omitempty"`
+	// OrderingKey is the attribute or extension holding the ordering key, defaults to the partitionkey extension
+	OrderingKey string `json:"orderingKey,omitempty"`
+	// DeadLetterURL receives the events which couldn't be delivered, instead of the broker's dead letter sink
+	DeadLetterURL string `json:"deadLetterUrl,omitempty"`
+	// Paused stops deliveries to the subscriber, queued events are delivered once it is resumed. Brokers without a
+	// queue refuse its events with a 503 instead, for their senders to retry.
+	Paused bool `json:"paused,omitempty"`
+	// Brokers opts in to events from the brokers in other namespaces, or "*" for every broker. Namespaced brokers
+	// otherwise only route events to the triggers in their own namespace.
+	Brokers []string `json:"brokers,omitempty"`
+}
+
+// AttributeFilter matches events on their CloudEvents attributes and extensions, an event has to satisfy every
+// condition set, e.g. {"exact": {"source": "client"}} or {"cesql": "source = 'client' AND userid LIKE 'bot-%'"}
+type AttributeFilter struct {
+	Exact  map[string]string `json:"exact,omitempty"`
+	Prefix map[string]string `json:"prefix,omitempty"`
+	Suffix map[string]string `json:"suffix,omitempty"`
+	CESQL  string            `json:"cesql,omitempty"`
+}
+
+type RetrySpec struct {
+	// Backoff is "constant" or "exponential"
+	Backoff    string `json:"backoff,omitempty"`
+	Delay      string `json:"delay,omitempty"`
+	MaxDelay   string `json:"maxDelay,omitempty"`
+	MaxRetries int    `json:"maxRetries"`
+	MaxElapsed string `json:"maxElapsed,omitempty"`
+}
+
+// EventTriggerStatus reports how deliveries to the subscriber are going, counted since the broker started
+type EventTriggerStatus struct {
+	Delivered     int64        `json:"delivered"`
+	Failed        int64        `json:"failed"`
+	LastError     string       `json:"lastError,omitempty"`
+	LastErrorTime *metav1.Time `json:"lastErrorTime,omitempty"`
 }
 
 type EventTrigger struct {
 	metav1.TypeMeta   `json:",inline"`
 	metav1.ObjectMeta `json:"metadata,omitempty"`
 
-	Spec EventTriggerSpec `json:"spec"`
+	Spec   EventTriggerSpec   `json:"spec"`
+	Status EventTriggerStatus `json:"status,omitempty"`
 }
 
 type EventTriggerList struct {
@@ -8,12 +8,49 @@ func (in *EventTrigger) DeepCopyInto(out *EventTrigger) {
 	out.TypeMeta = in.TypeMeta
 	out.ObjectMeta = in.ObjectMeta
 
-	out.Spec = EventTriggerSpec{
-		Filters: make([]string, len(in.Spec.Filters)),
-		URL:     in.Spec.URL,
+	out.Spec = in.Spec
+	out.Spec.Filters = make([]string, len(in.Spec.Filters))
+	copy(out.Spec.Filters, in.Spec.Filters)
+
+	if in.Spec.Attributes != nil {
+		out.Spec.Attributes = make([]AttributeFilter, len(in.Spec.Attributes))
+		for i, filter := range in.Spec.Attributes {
+			out.Spec.Attributes[i] = AttributeFilter{
+				Exact:  copyMap(filter.Exact),
+				Prefix: copyMap(filter.Prefix),
+				Suffix: copyMap(filter.Suffix),
+				CESQL:  filter.CESQL,
+			}
+		}
 	}
 
-	copy(out.Spec.Filters, in.Spec.Filters)
+	if in.Spec.Brokers != nil {
+		out.Spec.Brokers = make([]string, len(in.Spec.Brokers))
+		copy(out.Spec.Brokers, in.Spec.Brokers)
+	}
+
+	if in.Spec.Retry != nil {
+		retry := *in.Spec.Retry
+		out.Spec.Retry = &retry
+	}
+
+	out.Status = in.Status
+	if in.Status.LastErrorTime != nil {
+		out.Status.LastErrorTime = in.Status.LastErrorTime.DeepCopy()
+	}
+}
+
+func copyMap(in map[string]string) map[string]string {
+	if in == nil {
+		return nil
+	}
+
+	out := make(map[string]string, len(in))
+	for key, value := range in {
+		out[key] = value
+	}
+
+	return out
 }
 
 // DeepCopyObject returns a generically typed copy of an object
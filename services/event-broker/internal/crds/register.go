@@ -20,6 +20,8 @@ func addKnownTypes(scheme *runtime.Scheme) error {
 	scheme.AddKnownTypes(SchemeGroupVersion,
 		&EventTrigger{},
 		&EventTriggerList{},
+		&EventPublisher{},
+		&EventPublisherList{},
 	)
 
 	metav1.AddToGroupVersion(scheme, SchemeGroupVersion)
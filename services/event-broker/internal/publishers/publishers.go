@@ -0,0 +1,152 @@
+package publishers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudevents/sdk-go/v2/event"
+	"ponglehub.co.uk/events/broker/internal/crds"
+	"ponglehub.co.uk/events/broker/internal/router"
+	"ponglehub.co.uk/lib/events"
+)
+
+// MaxSignatureAge is how long a signed event is accepted for, so that captured events can't be replayed later on.
+// It also allows for clock skew between the publisher and the broker.
+const MaxSignatureAge = 5 * time.Minute
+
+// Publishers authenticates the events sent to the broker, checking that they're signed by a known publisher and that
+// its EventPublisher allows it to send them
+type Publishers struct {
+	lock    sync.RWMutex
+	keys    map[string][]byte
+	sources map[string][]string
+	types   *router.Router
+	filters map[string][]string
+}
+
+// New creates publishers with a key for each publisher's name, none of which may send anything until their
+// EventPublisher is set
+func New(keys map[string][]byte) *Publishers {
+	return &Publishers{
+		keys:    keys,
+		sources: map[string][]string{},
+		types:   router.New(),
+		filters: map[string][]string{},
+	}
+}
+
+// LoadKeys reads each publisher's key from the file of the same name in dir, e.g. a mounted secret
+func LoadKeys(dir string) (map[string][]byte, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list publisher keys: %+v", err)
+	}
+
+	keys := map[string][]byte{}
+	for _, entry := range entries {
+		// mounted secrets keep their files in hidden directories behind symlinks
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+
+		key, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read key for %s: %+v", entry.Name(), err)
+		}
+
+		keys[entry.Name()] = []byte(strings.TrimSpace(string(key)))
+	}
+
+	return keys, nil
+}
+
+// Set replaces what the named publisher may send
+func (p *Publishers) Set(name string, spec crds.EventPublisherSpec) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.remove(name)
+
+	p.sources[name] = spec.Sources
+	p.filters[name] = spec.Types
+	for _, filter := range spec.Types {
+		p.types.Add(filter, name)
+	}
+}
+
+func (p *Publishers) Remove(name string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.remove(name)
+}
+
+func (p *Publishers) remove(name string) {
+	for _, filter := range p.filters[name] {
+		p.types.Remove(filter, name)
+	}
+
+	delete(p.sources, name)
+	delete(p.filters, name)
+}
+
+// Check returns a 401 error for events which aren't signed recently by a known publisher, and a 403 error for events
+// their publisher isn't allowed to send
+func (p *Publishers) Check(event event.Event) error {
+	name, _ := event.Extensions()[events.PublisherExtension].(string)
+
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	key, ok := p.keys[name]
+	if !ok || !events.VerifySignature(event, key) {
+		return &events.StatusError{
+			StatusCode: http.StatusUnauthorized,
+			Err:        errors.New("event isn't signed by a known publisher"),
+		}
+	}
+
+	if !events.SignedWithin(event, MaxSignatureAge) {
+		return &events.StatusError{
+			StatusCode: http.StatusUnauthorized,
+			Err:        fmt.Errorf("event wasn't signed within the last %s", MaxSignatureAge),
+		}
+	}
+
+	if !p.allowed(name, event) {
+		return &events.StatusError{
+			StatusCode: http.StatusForbidden,
+			Err:        fmt.Errorf("%s may not send %s events from %s", name, event.Type(), event.Source()),
+		}
+	}
+
+	return nil
+}
+
+func (p *Publishers) allowed(name string, event event.Event) bool {
+	source := false
+	for _, allowed := range p.sources[name] {
+		if allowed == event.Source() {
+			source = true
+			break
+		}
+	}
+
+	if !source {
+		return false
+	}
+
+	for _, target := range p.types.GetURLs(event.Type()) {
+		if target == name {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,87 @@
+package publishers
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/cloudevents/sdk-go/v2/event"
+	"github.com/stretchr/testify/assert"
+	"ponglehub.co.uk/events/broker/internal/crds"
+	"ponglehub.co.uk/lib/events"
+)
+
+func signedEvent(signer *events.Signer, source string, eventType string) event.Event {
+	event := cloudevents.NewEvent()
+	event.SetID("event-id")
+	event.SetSource(source)
+	event.SetType(eventType)
+	event.SetExtension("userid", "user-1")
+	signer.Sign(&event)
+
+	return event
+}
+
+// staleEvent is correctly signed, but long enough ago to be a replay
+func staleEvent(signer *events.Signer, source string, eventType string) event.Event {
+	event := signedEvent(signer, source, eventType)
+	event.SetExtension(events.SignedAtExtension, time.Now().Add(-time.Hour).UTC().Format(time.RFC3339Nano))
+	event.SetExtension(events.SignatureExtension, events.Signature(event, signer.Key))
+
+	return event
+}
+
+func TestCheck(t *testing.T) {
+	gateway := &events.Signer{Publisher: "gateway", Key: []byte("gateway-key")}
+	game := &events.Signer{Publisher: "naughts-and-crosses", Key: []byte("game-key")}
+	unknown := &events.Signer{Publisher: "unknown", Key: []byte("unknown-key")}
+	impostor := &events.Signer{Publisher: "gateway", Key: []byte("game-key")}
+
+	p := New(map[string][]byte{"gateway": gateway.Key, "naughts-and-crosses": game.Key})
+	p.Set("gateway", crds.EventPublisherSpec{Sources: []string{"client"}, Types: []string{"**"}})
+	p.Set("naughts-and-crosses", crds.EventPublisherSpec{Sources: []string{"naughts-and-crosses"}, Types: []string{"naughts-and-crosses.**.response"}})
+
+	for _, test := range []struct {
+		name   string
+		event  event.Event
+		status int
+	}{
+		{name: "client event", event: signedEvent(gateway, "client", "naughts-and-crosses.mark")},
+		{name: "response", event: signedEvent(game, "naughts-and-crosses", "naughts-and-crosses.mark.response")},
+		{name: "forged client event", event: signedEvent(game, "client", "naughts-and-crosses.mark"), status: http.StatusForbidden},
+		{name: "type not allowed", event: signedEvent(game, "naughts-and-crosses", "draughts.move.response"), status: http.StatusForbidden},
+		{name: "unsigned", event: signedEvent(nil, "client", "naughts-and-crosses.mark"), status: http.StatusUnauthorized},
+		{name: "unknown publisher", event: signedEvent(unknown, "client", "naughts-and-crosses.mark"), status: http.StatusUnauthorized},
+		{name: "wrong key", event: signedEvent(impostor, "client", "naughts-and-crosses.mark"), status: http.StatusUnauthorized},
+		{name: "replayed", event: staleEvent(gateway, "client", "naughts-and-crosses.mark"), status: http.StatusUnauthorized},
+	} {
+		t.Run(test.name, func(u *testing.T) {
+			err := p.Check(test.event)
+			if test.status == 0 {
+				assert.NoError(u, err)
+				return
+			}
+
+			assert.Equal(u, test.status, events.RejectionStatus(err))
+		})
+	}
+
+	p.Set("gateway", crds.EventPublisherSpec{Sources: []string{"client"}, Types: []string{"draughts.*"}})
+	assert.Equal(t, http.StatusForbidden, events.RejectionStatus(p.Check(signedEvent(gateway, "client", "naughts-and-crosses.mark"))))
+
+	p.Remove("gateway")
+	assert.Equal(t, http.StatusForbidden, events.RejectionStatus(p.Check(signedEvent(gateway, "client", "draughts.move"))))
+}
+
+func TestLoadKeys(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "gateway"), []byte("gateway-key\n"), 0600))
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, "..data"), 0700))
+
+	keys, err := LoadKeys(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]byte{"gateway": []byte("gateway-key")}, keys)
+}
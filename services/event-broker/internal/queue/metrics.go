@@ -0,0 +1,19 @@
+package queue
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var (
+	backlogGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "broker_queue_backlog",
+		Help: "Events queued for a trigger and not yet acknowledged",
+	}, []string{"trigger"})
+
+	pendingGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "broker_queue_pending",
+		Help: "Events read for a trigger but not yet acknowledged, either in flight or awaiting redelivery",
+	}, []string{"trigger"})
+)
+
+func init() {
+	prometheus.MustRegister(backlogGauge, pendingGauge)
+}
@@ -0,0 +1,438 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudevents/sdk-go/v2/event"
+	"github.com/go-redis/redis/v8"
+	"github.com/sirupsen/logrus"
+	"ponglehub.co.uk/lib/events"
+)
+
+const group = "broker"
+
+// reserveRetry is how often to check for room with a subscriber which has too many events pending
+const reserveRetry = 10 * time.Millisecond
+
+// Deliver sends a queued event to its subscriber, returning an error if it should be redelivered later
+type Deliver func(ctx context.Context, event event.Event) error
+
+// Dispatcher limits the deliveries in flight for a trigger and orders those sharing an ordering key, see
+// subscribers.Subscriber
+type Dispatcher interface {
+	Reserve() bool
+	Dispatch(event event.Event, deliver func())
+}
+
+// Queue persists the events for each trigger in a redis stream until they've been delivered. Each trigger has its
+// own stream and consumer group, keyed by the trigger's namespace/name, so its cursor and pending deliveries survive
+// broker restarts and changes to its url.
+type Queue struct {
+	redis    *redis.Client
+	consumer string
+	args     QueueArgs
+	groups   sync.Map
+
+	lock      sync.Mutex
+	consumers map[string]*consumer
+}
+
+type QueueArgs struct {
+	// Consumer identifies this broker within each consumer group, e.g. the pod name
+	Consumer string
+	// ClaimAfter is how long to wait before retrying a failed delivery, and how long an event can go without being
+	// claimed again before another broker takes it over
+	ClaimAfter time.Duration
+	// MaxDeliveries gives up on an event after this many failed deliveries, zero to keep trying forever
+	MaxDeliveries int64
+	// Retryable decides whether a failed delivery is retried or given up on, defaults to events.DefaultRetryable
+	Retryable func(statusCode int) bool
+	// DeadLetter optionally receives the events given up on
+	DeadLetter events.DeadLetterSink
+}
+
+type consumer struct {
+	cancel context.CancelFunc
+}
+
+// claims holds the ids of the events a consumer has read and not yet finished with
+type claims struct {
+	lock sync.Mutex
+	ids  map[string]struct{}
+}
+
+func (c *claims) add(id string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.ids[id] = struct{}{}
+}
+
+func (c *claims) remove(id string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	delete(c.ids, id)
+}
+
+func (c *claims) has(id string) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	_, ok := c.ids[id]
+	return ok
+}
+
+func (c *claims) list() []string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	ids := []string{}
+	for id := range c.ids {
+		ids = append(ids, id)
+	}
+
+	return ids
+}
+
+type Backlog struct {
+	// Queued counts the events not yet acknowledged by the subscriber, including pending ones
+	Queued int64
+	// Pending counts the events which have been read but not acknowledged, i.e. in flight or failed
+	Pending int64
+}
+
+func New(client *redis.Client, args QueueArgs) *Queue {
+	if args.ClaimAfter == 0 {
+		args.ClaimAfter = 30 * time.Second
+	}
+
+	if args.Retryable == nil {
+		args.Retryable = events.DefaultRetryable
+	}
+
+	return &Queue{
+		redis:     client,
+		consumer:  args.Consumer,
+		args:      args,
+		consumers: map[string]*consumer{},
+	}
+}
+
+func key(target string) string {
+	return "broker.queue." + target
+}
+
+func (q *Queue) ensureGroup(ctx context.Context, target string) error {
+	if _, ok := q.groups.Load(target); ok {
+		return nil
+	}
+
+	err := q.redis.XGroupCreateMkStream(ctx, key(target), group, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return fmt.Errorf("failed to create consumer group for %s: %+v", target, err)
+	}
+
+	q.groups.Store(target, true)
+
+	return nil
+}
+
+// Enqueue stores the event for delivery to the target trigger, it's safe to acknowledge the event once this returns
+func (q *Queue) Enqueue(ctx context.Context, target string, event event.Event) error {
+	err := q.ensureGroup(ctx, target)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to serialise event: %+v", err)
+	}
+
+	err = q.redis.XAdd(ctx, &redis.XAddArgs{
+		Stream: key(target),
+		Values: map[string]interface{}{"event": data},
+	}).Err()
+	if err != nil {
+		return fmt.Errorf("failed to queue event for %s: %+v", target, err)
+	}
+
+	return nil
+}
+
+// Subscribe starts consuming the events queued for the target trigger, unless it's already being consumed
+func (q *Queue) Subscribe(ctx context.Context, target string, dispatcher Dispatcher, deliver Deliver) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if _, ok := q.consumers[target]; ok {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	q.consumers[target] = &consumer{cancel: cancel}
+
+	go q.Consume(ctx, target, dispatcher, deliver)
+}
+
+// Unsubscribe stops consuming events for the target trigger. Queued events are kept, and delivered if the trigger
+// is subscribed again.
+func (q *Queue) Unsubscribe(target string) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	c, ok := q.consumers[target]
+	if !ok {
+		return
+	}
+
+	c.cancel()
+	delete(q.consumers, target)
+	backlogGauge.DeleteLabelValues(target)
+	pendingGauge.DeleteLabelValues(target)
+}
+
+// Consume delivers the events queued for target until ctx is cancelled. Events are read in the order they were
+// queued and handed to the dispatcher, so that they're held to the trigger's concurrency and ordering limits, and
+// acknowledged once delivered. Failed deliveries are retried after ClaimAfter, holding back later events with the
+// same ordering key, and events the subscriber rejects outright are given up on straight away.
+func (q *Queue) Consume(ctx context.Context, target string, dispatcher Dispatcher, deliver Deliver) {
+	logrus.Infof("Consuming queued events for %s", target)
+
+	held := &claims{ids: map[string]struct{}{}}
+	go q.heartbeat(ctx, target, held)
+
+	for ctx.Err() == nil {
+		err := q.poll(ctx, target, held, dispatcher, deliver)
+		if err != nil && ctx.Err() == nil {
+			logrus.Errorf("Failed to read queue for %s: %+v", target, err)
+
+			select {
+			case <-ctx.Done():
+			case <-time.After(time.Second):
+			}
+		}
+	}
+
+	logrus.Infof("Stopped consuming queued events for %s", target)
+}
+
+func (q *Queue) poll(ctx context.Context, target string, held *claims, dispatcher Dispatcher, deliver Deliver) error {
+	err := q.ensureGroup(ctx, target)
+	if err != nil {
+		return err
+	}
+
+	claimed, _, err := q.redis.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+		Stream:   key(target),
+		Group:    group,
+		Consumer: q.consumer,
+		MinIdle:  q.args.ClaimAfter,
+		Start:    "0-0",
+		Count:    10,
+	}).Result()
+	if err != nil {
+		return fmt.Errorf("failed to claim pending events: %+v", err)
+	}
+
+	for _, message := range claimed {
+		if !held.has(message.ID) {
+			q.dispatch(ctx, target, message, held, dispatcher, deliver)
+		}
+	}
+
+	streams, err := q.redis.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    group,
+		Consumer: q.consumer,
+		Streams:  []string{key(target), ">"},
+		Count:    10,
+		Block:    time.Second,
+	}).Result()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return fmt.Errorf("failed to read events: %+v", err)
+	}
+
+	for _, stream := range streams {
+		for _, message := range stream.Messages {
+			q.dispatch(ctx, target, message, held, dispatcher, deliver)
+		}
+	}
+
+	backlog, err := q.Backlog(ctx, target)
+	if err == nil {
+		backlogGauge.WithLabelValues(target).Set(float64(backlog.Queued))
+		pendingGauge.WithLabelValues(target).Set(float64(backlog.Pending))
+	}
+
+	return nil
+}
+
+// dispatch waits for room with the trigger's subscriber, so that a backlog isn't read faster than it's delivered,
+// then delivers the event in the background
+func (q *Queue) dispatch(ctx context.Context, target string, message redis.XMessage, held *claims, dispatcher Dispatcher, deliver Deliver) {
+	data, _ := message.Values["event"].(string)
+
+	queued := event.New()
+	err := json.Unmarshal([]byte(data), &queued)
+	if err != nil {
+		logrus.Errorf("Dropping malformed event %s queued for %s: %+v", message.ID, target, err)
+		q.ack(ctx, target, message.ID)
+		return
+	}
+
+	for !dispatcher.Reserve() {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(reserveRetry):
+		}
+	}
+
+	held.add(message.ID)
+	dispatcher.Dispatch(queued, func() {
+		defer held.remove(message.ID)
+		q.deliver(ctx, target, message.ID, queued, deliver)
+	})
+}
+
+// deliver retries the event until it's delivered or given up on, rather than leaving it for XAutoClaim, so that the
+// dispatcher keeps later events with the same ordering key behind it
+func (q *Queue) deliver(ctx context.Context, target string, id string, queued event.Event, deliver Deliver) {
+	for ctx.Err() == nil {
+		err := deliver(ctx, queued)
+		if err == nil {
+			q.ack(ctx, target, id)
+			return
+		}
+
+		if ctx.Err() != nil {
+			// left pending, to be claimed once the trigger is consumed again
+			return
+		}
+
+		pending, pendingErr := q.redis.XPendingExt(ctx, &redis.XPendingExtArgs{
+			Stream: key(target),
+			Group:  group,
+			Start:  id,
+			End:    id,
+			Count:  1,
+		}).Result()
+		if pendingErr != nil || len(pending) == 0 {
+			logrus.Errorf("Failed to check deliveries of %s for %s, leaving it to be claimed: %+v", queued.Type(), target, pendingErr)
+			return
+		}
+		attempts := pending[0].RetryCount
+
+		if !q.args.Retryable(events.StatusCode(err)) {
+			logrus.Errorf("Giving up on %s for %s, rejected with status %d: %+v", queued.Type(), target, events.StatusCode(err), err)
+			q.giveUp(ctx, target, id, queued, attempts, err)
+			return
+		}
+
+		if q.args.MaxDeliveries > 0 && attempts >= q.args.MaxDeliveries {
+			logrus.Errorf("Giving up on %s for %s after %d deliveries", queued.Type(), target, attempts)
+			q.giveUp(ctx, target, id, queued, attempts, err)
+			return
+		}
+
+		logrus.Warnf("Failed to deliver queued %s to %s, will retry: %+v", queued.Type(), target, err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(q.args.ClaimAfter):
+		}
+
+		// claiming the event again counts the next delivery, and checks another broker hasn't taken it over
+		claimed, err := q.redis.XClaim(ctx, &redis.XClaimArgs{
+			Stream:   key(target),
+			Group:    group,
+			Consumer: q.consumer,
+			Messages: []string{id},
+		}).Result()
+		if err != nil || len(claimed) == 0 {
+			logrus.Warnf("Lost claim on %s for %s: %+v", queued.Type(), target, err)
+			return
+		}
+	}
+}
+
+// giveUp dead-letters the event and acknowledges it, or leaves it pending to try again if it can't be dead-lettered
+func (q *Queue) giveUp(ctx context.Context, target string, id string, queued event.Event, attempts int64, err error) {
+	if q.args.DeadLetter != nil {
+		dlErr := q.args.DeadLetter.DeadLetter(queued, events.DeliveryFailure{
+			Target:     target,
+			StatusCode: events.StatusCode(err),
+			Attempts:   int(attempts),
+			Err:        err,
+		})
+		if dlErr != nil {
+			logrus.Errorf("Failed to dead-letter %s for %s: %+v", queued.Type(), target, dlErr)
+			return
+		}
+	}
+
+	q.ack(ctx, target, id)
+}
+
+// heartbeat keeps claiming the events this consumer is holding, so that other brokers don't take over the events
+// waiting behind a retry or for a free slot
+func (q *Queue) heartbeat(ctx context.Context, target string, held *claims) {
+	ticker := time.NewTicker(q.args.ClaimAfter / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		ids := held.list()
+		if len(ids) == 0 {
+			continue
+		}
+
+		err := q.redis.XClaimJustID(ctx, &redis.XClaimArgs{
+			Stream:   key(target),
+			Group:    group,
+			Consumer: q.consumer,
+			Messages: ids,
+		}).Err()
+		if err != nil && ctx.Err() == nil {
+			logrus.Errorf("Failed to renew claims for %s: %+v", target, err)
+		}
+	}
+}
+
+func (q *Queue) ack(ctx context.Context, target string, id string) {
+	pipe := q.redis.TxPipeline()
+	pipe.XAck(ctx, key(target), group, id)
+	pipe.XDel(ctx, key(target), id)
+
+	_, err := pipe.Exec(ctx)
+	if err != nil {
+		logrus.Errorf("Failed to acknowledge %s for %s: %+v", id, target, err)
+	}
+}
+
+func (q *Queue) Backlog(ctx context.Context, target string) (Backlog, error) {
+	queued, err := q.redis.XLen(ctx, key(target)).Result()
+	if err != nil {
+		return Backlog{}, fmt.Errorf("failed to get queue length: %+v", err)
+	}
+
+	pending, err := q.redis.XPending(ctx, key(target), group).Result()
+	if err != nil {
+		return Backlog{}, fmt.Errorf("failed to get pending events: %+v", err)
+	}
+
+	return Backlog{Queued: queued, Pending: pending.Count}, nil
+}
@@ -0,0 +1,331 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/cloudevents/sdk-go/v2/event"
+	"github.com/go-redis/redis/v8"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"ponglehub.co.uk/events/broker/internal/server"
+	"ponglehub.co.uk/events/broker/internal/subscribers"
+	"ponglehub.co.uk/events/broker/internal/triggers"
+	"ponglehub.co.uk/lib/events"
+)
+
+type recorder struct {
+	lock      sync.Mutex
+	failures  map[string]int
+	delivered []string
+}
+
+func (r *recorder) deliver(ctx context.Context, event event.Event) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.failures[event.Type()] > 0 {
+		r.failures[event.Type()] -= 1
+		return errors.New("subscriber unavailable")
+	}
+
+	r.delivered = append(r.delivered, event.Type())
+	return nil
+}
+
+func (r *recorder) count() int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return len(r.delivered)
+}
+
+type stubSink struct {
+	failures []events.DeliveryFailure
+}
+
+func (s *stubSink) DeadLetter(event event.Event, failure events.DeliveryFailure) error {
+	s.failures = append(s.failures, failure)
+	return nil
+}
+
+func testEvent(eventType string) event.Event {
+	event := cloudevents.NewEvent()
+	event.SetID(eventType)
+	event.SetType(eventType)
+	event.SetSource("unit-tests")
+
+	return event
+}
+
+func newSubscriber(options subscribers.Options) *subscribers.Subscriber {
+	subs := subscribers.New()
+	subs.Set("games/game", options)
+
+	return subs.Get("games/game")
+}
+
+func newQueue(t *testing.T, args QueueArgs) *Queue {
+	server := miniredis.RunT(t)
+	return New(redis.NewClient(&redis.Options{Addr: server.Addr()}), args)
+}
+
+func TestRedelivery(t *testing.T) {
+	logrus.SetOutput(io.Discard)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	q := newQueue(t, QueueArgs{Consumer: "broker-1", ClaimAfter: 20 * time.Millisecond})
+
+	for _, eventType := range []string{"game.first", "game.second", "game.third"} {
+		assert.NoError(t, q.Enqueue(ctx, "games/game", testEvent(eventType)))
+	}
+
+	r := &recorder{failures: map[string]int{"game.second": 2}}
+	q.Subscribe(ctx, "games/game", newSubscriber(subscribers.DefaultOptions), r.deliver)
+
+	assert.Eventually(t, func() bool { return r.count() == 3 }, 5*time.Second, 10*time.Millisecond)
+	assert.ElementsMatch(t, []string{"game.first", "game.second", "game.third"}, r.delivered)
+
+	backlog, err := q.Backlog(ctx, "games/game")
+	assert.NoError(t, err)
+	assert.Equal(t, Backlog{}, backlog)
+}
+
+func TestCrashRecovery(t *testing.T) {
+	logrus.SetOutput(io.Discard)
+
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+
+	crashed, crash := context.WithCancel(context.Background())
+	first := New(client, QueueArgs{Consumer: "broker-1", ClaimAfter: 20 * time.Millisecond})
+	assert.NoError(t, first.Enqueue(crashed, "games/game", testEvent("game.move")))
+
+	// the first broker reads the event and stops before delivering it
+	reading := make(chan struct{})
+	go first.Consume(crashed, "games/game", newSubscriber(subscribers.DefaultOptions), func(ctx context.Context, event event.Event) error {
+		close(reading)
+		crash()
+		return errors.New("broker stopped")
+	})
+	<-reading
+
+	backlog, err := first.Backlog(context.Background(), "games/game")
+	assert.NoError(t, err)
+	assert.Equal(t, Backlog{Queued: 1, Pending: 1}, backlog)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	r := &recorder{}
+	second := New(client, QueueArgs{Consumer: "broker-2", ClaimAfter: 20 * time.Millisecond})
+	second.Subscribe(ctx, "games/game", newSubscriber(subscribers.DefaultOptions), r.deliver)
+
+	assert.Eventually(t, func() bool { return r.count() == 1 }, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestMaxDeliveries(t *testing.T) {
+	logrus.SetOutput(io.Discard)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sink := &stubSink{}
+	q := newQueue(t, QueueArgs{Consumer: "broker-1", ClaimAfter: 10 * time.Millisecond, MaxDeliveries: 3, DeadLetter: sink})
+	assert.NoError(t, q.Enqueue(ctx, "games/game", testEvent("game.move")))
+
+	r := &recorder{failures: map[string]int{"game.move": 100}}
+	q.Subscribe(ctx, "games/game", newSubscriber(subscribers.DefaultOptions), r.deliver)
+
+	assert.Eventually(t, func() bool {
+		backlog, err := q.Backlog(ctx, "games/game")
+		return err == nil && backlog.Queued == 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	q.Unsubscribe("games/game")
+
+	assert.Equal(t, 1, len(sink.failures))
+	assert.Equal(t, "games/game", sink.failures[0].Target)
+	assert.Equal(t, 0, r.count())
+}
+
+func keyedEvent(eventType string, key string) event.Event {
+	event := testEvent(eventType)
+	event.SetExtension(events.PartitionKeyExtension, key)
+
+	return event
+}
+
+func TestOrderingKeyHeldBehindRetry(t *testing.T) {
+	logrus.SetOutput(io.Discard)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	q := newQueue(t, QueueArgs{Consumer: "broker-1", ClaimAfter: 20 * time.Millisecond})
+
+	assert.NoError(t, q.Enqueue(ctx, "games/game", keyedEvent("game.first", "game-1")))
+	assert.NoError(t, q.Enqueue(ctx, "games/game", keyedEvent("game.second", "game-1")))
+	assert.NoError(t, q.Enqueue(ctx, "games/game", keyedEvent("game.other", "game-2")))
+
+	r := &recorder{failures: map[string]int{"game.first": 2}}
+	q.Subscribe(ctx, "games/game", newSubscriber(subscribers.DefaultOptions), r.deliver)
+
+	assert.Eventually(t, func() bool { return r.count() == 3 }, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, []string{"game.other", "game.first", "game.second"}, r.delivered)
+}
+
+func TestRejectedEvents(t *testing.T) {
+	logrus.SetOutput(io.Discard)
+
+	for _, test := range []struct {
+		name         string
+		status       int
+		deadLettered bool
+	}{
+		{name: "bad request", status: 400, deadLettered: true},
+		{name: "unprocessable", status: 422, deadLettered: true},
+		{name: "too many requests", status: 429},
+		{name: "unavailable", status: 503},
+	} {
+		t.Run(test.name, func(u *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			sink := &stubSink{}
+			q := newQueue(u, QueueArgs{Consumer: "broker-1", ClaimAfter: 10 * time.Millisecond, MaxDeliveries: 100, DeadLetter: sink})
+			assert.NoError(u, q.Enqueue(ctx, "games/game", testEvent("game.move")))
+
+			var lock sync.Mutex
+			attempts := 0
+			q.Subscribe(ctx, "games/game", newSubscriber(subscribers.DefaultOptions), func(ctx context.Context, event event.Event) error {
+				lock.Lock()
+				defer lock.Unlock()
+
+				attempts += 1
+				if attempts == 1 {
+					return &events.DeliveryError{StatusCode: test.status, Err: errors.New("rejected")}
+				}
+
+				return nil
+			})
+
+			assert.Eventually(u, func() bool {
+				backlog, err := q.Backlog(ctx, "games/game")
+				return err == nil && backlog.Queued == 0
+			}, 5*time.Second, 10*time.Millisecond)
+
+			q.Unsubscribe("games/game")
+
+			lock.Lock()
+			defer lock.Unlock()
+
+			if test.deadLettered {
+				assert.Equal(u, 1, attempts)
+				assert.Equal(u, 1, len(sink.failures))
+				assert.Equal(u, test.status, sink.failures[0].StatusCode)
+			} else {
+				assert.Equal(u, 2, attempts)
+				assert.Empty(u, sink.failures)
+			}
+		})
+	}
+}
+
+func TestQueuedConcurrency(t *testing.T) {
+	logrus.SetOutput(io.Discard)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	q := newQueue(t, QueueArgs{Consumer: "broker-1"})
+	for i := 0; i < 6; i++ {
+		assert.NoError(t, q.Enqueue(ctx, "games/game", testEvent("game.move")))
+	}
+
+	var lock sync.Mutex
+	running := 0
+	most := 0
+	delivered := 0
+
+	q.Subscribe(ctx, "games/game", newSubscriber(subscribers.Options{MaxConcurrency: 2, MaxPending: 3}), func(ctx context.Context, event event.Event) error {
+		lock.Lock()
+		running += 1
+		if running > most {
+			most = running
+		}
+		lock.Unlock()
+
+		time.Sleep(20 * time.Millisecond)
+
+		lock.Lock()
+		defer lock.Unlock()
+
+		running -= 1
+		delivered += 1
+		return nil
+	})
+
+	assert.Eventually(t, func() bool {
+		lock.Lock()
+		defer lock.Unlock()
+
+		return delivered == 6
+	}, 5*time.Second, 10*time.Millisecond)
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	assert.Equal(t, 2, most)
+}
+
+func TestQueuedDeadLetters(t *testing.T) {
+	logrus.SetOutput(io.Discard)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	transport := events.NewMemoryTransport()
+	_, err := transport.Listen(ctx, "subscriber", func(ctx context.Context, event event.Event) error {
+		return &events.StatusError{StatusCode: 503, Err: errors.New("unavailable")}
+	})
+	assert.NoError(t, err)
+
+	tr := triggers.New()
+	tr.Set("games/game", triggers.Trigger{URL: "subscriber"})
+
+	own := &stubSink{}
+	fallback := &stubSink{}
+
+	subs := subscribers.New()
+	subs.Set("games/game", subscribers.Options{
+		Retry:      &events.RetryPolicy{Delay: time.Millisecond, MaxRetries: 1},
+		DeadLetter: own,
+	})
+
+	q := newQueue(t, QueueArgs{Consumer: "broker-1", ClaimAfter: 10 * time.Millisecond, MaxDeliveries: 3, DeadLetter: subs.DeadLetterSink(fallback)})
+	assert.NoError(t, q.Enqueue(ctx, "games/game", testEvent("game.move")))
+
+	q.Subscribe(ctx, "games/game", subs.Get("games/game"), func(ctx context.Context, event event.Event) error {
+		return server.Deliver(ctx, server.StartArgs{Transport: transport, Triggers: tr, Subscribers: subs, SkipDeadLetter: true}, "games/game", event)
+	})
+
+	assert.Eventually(t, func() bool {
+		backlog, err := q.Backlog(ctx, "games/game")
+		return err == nil && backlog.Queued == 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	q.Unsubscribe("games/game")
+
+	assert.Equal(t, 1, len(own.failures))
+	assert.Equal(t, 503, own.failures[0].StatusCode)
+	assert.Empty(t, fallback.failures)
+}
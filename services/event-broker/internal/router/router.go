@@ -2,91 +2,178 @@ package router
 
 import (
 	"fmt"
+	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 )
 
-type Route struct {
-	Filter string
-	Parts  []string
-	URL    string
+// Router matches event types against filters of "."-separated segments, where "*" matches any single segment and
+// "**" matches one or more. Its trie is replaced rather than modified, so lookups don't need a lock.
+type Router struct {
+	lock sync.Mutex
+	root atomic.Value
 }
 
-type Router struct {
-	routes []Route
+type node struct {
+	children map[string]*node
+	// urls counts the triggers ending at this node, a url can be added more than once
+	urls map[string]int
 }
 
-func New() Router {
-	return Router{
-		routes: []Route{},
-	}
+func New() *Router {
+	r := &Router{}
+	r.root.Store(&node{})
+
+	return r
+}
+
+func (r *Router) snapshot() *node {
+	return r.root.Load().(*node)
 }
 
 func (r *Router) Add(filter string, url string) {
-	r.routes = append(r.routes, Route{
-		Filter: filter,
-		Parts:  strings.Split(filter, "."),
-		URL:    url,
-	})
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	root, _ := r.snapshot().update(strings.Split(filter, "."), url, 1)
+	r.root.Store(root)
 }
 
 func (r *Router) Remove(filter string, url string) error {
-	for idx, route := range r.routes {
-		if route.Filter == filter && route.URL == url {
-			r.routes[idx] = r.routes[len(r.routes)-1]
-			r.routes = r.routes[:len(r.routes)-1]
-			return nil
-		}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	root, ok := r.snapshot().update(strings.Split(filter, "."), url, -1)
+	if !ok {
+		return fmt.Errorf("failed to remove %s: %s, not found", filter, url)
 	}
 
-	return fmt.Errorf("failed to remove %s: %s, not found", filter, url)
+	if root == nil {
+		root = &node{}
+	}
+
+	r.root.Store(root)
+
+	return nil
 }
 
 func (r *Router) GetURLs(eventType string) []string {
+	matches := map[*node]bool{}
+	r.snapshot().match(strings.Split(eventType, "."), matches)
+
 	urls := []string{}
-	typeParts := strings.Split(eventType, ".")
-
-	for _, route := range r.routes {
-		lenFilterParts := len(route.Parts)
-
-		matchIndex := 0
-		doubleWild := false
-		mismatch := false
-
-		for _, part := range typeParts {
-			if matchIndex < lenFilterParts {
-				if route.Parts[matchIndex] == "*" {
-					matchIndex += 1
-					doubleWild = false
-					continue
-				}
-
-				if route.Parts[matchIndex] == "**" {
-					matchIndex += 1
-					doubleWild = true
-					continue
-				}
-
-				if route.Parts[matchIndex] == part {
-					matchIndex += 1
-					doubleWild = false
-					continue
-				}
+	for n := range matches {
+		for url, count := range n.urls {
+			for i := 0; i < count; i++ {
+				urls = append(urls, url)
 			}
+		}
+	}
 
-			if doubleWild {
-				continue
-			}
+	return urls
+}
+
+// Route is a filter and a target added for it, Count times
+type Route struct {
+	Filter string
+	Target string
+	Count  int
+}
+
+// Routes lists the routing table, sorted by filter and target
+func (r *Router) Routes() []Route {
+	routes := []Route{}
+	r.snapshot().walk(nil, &routes)
+
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Filter != routes[j].Filter {
+			return routes[i].Filter < routes[j].Filter
+		}
+
+		return routes[i].Target < routes[j].Target
+	})
 
-			mismatch = true
-			break
+	return routes
+}
+
+func (n *node) walk(path []string, routes *[]Route) {
+	for target, count := range n.urls {
+		*routes = append(*routes, Route{Filter: strings.Join(path, "."), Target: target, Count: count})
+	}
+
+	for segment, child := range n.children {
+		child.walk(append(path[:len(path):len(path)], segment), routes)
+	}
+}
+
+// update returns a copy of the node with the url count at the end of the path changed by delta, or false if
+// that would remove a url which isn't there. Nodes left empty are pruned, returning nil.
+func (n *node) update(parts []string, url string, delta int) (*node, bool) {
+	updated := &node{
+		children: map[string]*node{},
+		urls:     map[string]int{},
+	}
+
+	if n != nil {
+		for key, child := range n.children {
+			updated.children[key] = child
+		}
+
+		for key, count := range n.urls {
+			updated.urls[key] = count
+		}
+	}
+
+	if len(parts) == 0 {
+		if updated.urls[url]+delta < 0 {
+			return nil, false
+		}
+
+		updated.urls[url] += delta
+		if updated.urls[url] == 0 {
+			delete(updated.urls, url)
+		}
+	} else {
+		child, ok := updated.children[parts[0]].update(parts[1:], url, delta)
+		if !ok {
+			return nil, false
 		}
 
-		if mismatch || matchIndex != lenFilterParts {
-			continue
+		if child == nil {
+			delete(updated.children, parts[0])
+		} else {
+			updated.children[parts[0]] = child
 		}
+	}
 
-		urls = append(urls, route.URL)
+	if len(updated.children) == 0 && len(updated.urls) == 0 {
+		return nil, true
 	}
 
-	return urls
+	return updated, true
+}
+
+// match collects the nodes reached by the event type, a set so that overlapping "**" matches are only counted once
+func (n *node) match(parts []string, matches map[*node]bool) {
+	if len(parts) == 0 {
+		matches[n] = true
+		return
+	}
+
+	if parts[0] != "*" && parts[0] != "**" {
+		if child, ok := n.children[parts[0]]; ok {
+			child.match(parts[1:], matches)
+		}
+	}
+
+	if child, ok := n.children["*"]; ok {
+		child.match(parts[1:], matches)
+	}
+
+	if child, ok := n.children["**"]; ok {
+		for i := 1; i <= len(parts); i++ {
+			child.match(parts[i:], matches)
+		}
+	}
 }
@@ -0,0 +1,155 @@
+package router
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetURLs(t *testing.T) {
+	r := New()
+	r.Add("game.move", "exact")
+	r.Add("game.*", "single")
+	r.Add("game.**", "double")
+	r.Add("**.response", "responses")
+	r.Add("game.*.response", "middle")
+	r.Add("game.**.b.c", "backtrack")
+	r.Add("game.move", "exact")
+
+	for _, test := range []struct {
+		eventType string
+		expected  []string
+	}{
+		{eventType: "game.move", expected: []string{"double", "exact", "exact", "single"}},
+		{eventType: "game", expected: []string{}},
+		{eventType: "game.move.response", expected: []string{"double", "middle", "responses"}},
+		{eventType: "game.list.games.response", expected: []string{"double", "responses"}},
+		{eventType: "other.response", expected: []string{"responses"}},
+		{eventType: "response", expected: []string{}},
+		{eventType: "game.x.b.b.c", expected: []string{"backtrack", "double"}},
+	} {
+		t.Run(test.eventType, func(u *testing.T) {
+			actual := r.GetURLs(test.eventType)
+			sort.Strings(actual)
+			assert.Equal(u, test.expected, actual)
+		})
+	}
+}
+
+func TestRemove(t *testing.T) {
+	r := New()
+	r.Add("game.*", "first")
+	r.Add("game.*", "first")
+	r.Add("game.move", "second")
+
+	assert.Equal(t, []Route{
+		{Filter: "game.*", Target: "first", Count: 2},
+		{Filter: "game.move", Target: "second", Count: 1},
+	}, r.Routes())
+
+	assert.NoError(t, r.Remove("game.*", "first"))
+	assert.Equal(t, []string{"first"}, r.GetURLs("game.list"))
+
+	assert.NoError(t, r.Remove("game.*", "first"))
+	assert.Equal(t, []string{}, r.GetURLs("game.list"))
+	assert.Equal(t, []string{"second"}, r.GetURLs("game.move"))
+
+	assert.Error(t, r.Remove("game.*", "first"))
+	assert.Error(t, r.Remove("game.move", "first"))
+
+	assert.Equal(t, []Route{{Filter: "game.move", Target: "second", Count: 1}}, r.Routes())
+
+	assert.NoError(t, r.Remove("game.move", "second"))
+	assert.Equal(t, []Route{}, r.Routes())
+	assert.Empty(t, r.snapshot().children)
+}
+
+// TestMatchesLinear checks the trie agrees with the original router, apart from "**" now backtracking
+func TestMatchesLinear(t *testing.T) {
+	filters := []string{"a", "a.b", "a.*", "a.**", "*.b", "**.b", "a.*.c", "a.**.c", "*", "**", "a.b.c.d"}
+	types := []string{"a", "b", "a.b", "a.c", "a.b.c", "x.b", "x.y.b", "a.b.c.d", "a.x.c"}
+
+	trie := New()
+	linear := &linearRouter{}
+
+	for i, filter := range filters {
+		trie.Add(filter, fmt.Sprintf("url-%d", i))
+		linear.Add(filter, fmt.Sprintf("url-%d", i))
+	}
+
+	for _, eventType := range types {
+		expected := linear.GetURLs(eventType)
+		actual := trie.GetURLs(eventType)
+
+		sort.Strings(expected)
+		sort.Strings(actual)
+		assert.Equal(t, expected, actual, eventType)
+	}
+}
+
+func TestConcurrentUpdates(t *testing.T) {
+	r := New()
+	r.Add("game.*", "stable")
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			for j := 0; j < 200; j++ {
+				filter := fmt.Sprintf("game.%d.%d", i, j)
+				r.Add(filter, "temporary")
+				assert.NoError(t, r.Remove(filter, "temporary"))
+			}
+		}(i)
+	}
+
+	for i := 0; i < 1000; i++ {
+		assert.Equal(t, []string{"stable"}, r.GetURLs("game.move"))
+	}
+
+	wg.Wait()
+	assert.Equal(t, []string{"stable"}, r.GetURLs("game.move"))
+}
+
+type router interface {
+	Add(filter string, url string)
+	GetURLs(eventType string) []string
+}
+
+func benchmarkGetURLs(b *testing.B, r router, triggers int) {
+	for i := 0; i < triggers; i++ {
+		switch i % 4 {
+		case 0:
+			r.Add(fmt.Sprintf("game-%d.move", i), "exact")
+		case 1:
+			r.Add(fmt.Sprintf("game-%d.*", i), "single")
+		case 2:
+			r.Add(fmt.Sprintf("game-%d.**.response", i), "double")
+		case 3:
+			r.Add(fmt.Sprintf("game-%d.*.load-game", i), "middle")
+		}
+	}
+	r.Add("**.response", "responses")
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r.GetURLs(fmt.Sprintf("game-%d.list-games.response", i%triggers))
+	}
+}
+
+func BenchmarkGetURLs(b *testing.B) {
+	for _, triggers := range []int{100, 1000, 5000} {
+		b.Run(fmt.Sprintf("trie-%d", triggers), func(b *testing.B) {
+			benchmarkGetURLs(b, New(), triggers)
+		})
+
+		b.Run(fmt.Sprintf("linear-%d", triggers), func(b *testing.B) {
+			benchmarkGetURLs(b, &linearRouter{}, triggers)
+		})
+	}
+}
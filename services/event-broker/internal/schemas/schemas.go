@@ -0,0 +1,88 @@
+package schemas
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"ponglehub.co.uk/lib/events"
+)
+
+// Collector keeps a schema registry in step with the subscribers the broker routes to, by fetching GET /schemas
+// from each of them. Subscribers which don't serve schemas are simply left out of the registry.
+type Collector struct {
+	Registry *events.Registry
+	lock     sync.Mutex
+	urls     map[string]int
+}
+
+func New() *Collector {
+	return &Collector{
+		Registry: events.NewRegistry(),
+		urls:     map[string]int{},
+	}
+}
+
+// Add starts collecting schemas from url, which may be shared by several triggers
+func (c *Collector) Add(ctx context.Context, url string) {
+	c.lock.Lock()
+	c.urls[url] += 1
+	c.lock.Unlock()
+
+	go c.fetch(ctx, url)
+}
+
+func (c *Collector) Remove(url string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.urls[url] -= 1
+	if c.urls[url] <= 0 {
+		delete(c.urls, url)
+		c.Registry.Remove(url)
+	}
+}
+
+// Run refetches every subscriber's schemas on the given interval until ctx is cancelled, picking up
+// subscribers which weren't ready when their trigger was added
+func (c *Collector) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.lock.Lock()
+			urls := make([]string, 0, len(c.urls))
+			for url := range c.urls {
+				urls = append(urls, url)
+			}
+			c.lock.Unlock()
+
+			for _, url := range urls {
+				c.fetch(ctx, url)
+			}
+		}
+	}
+}
+
+func (c *Collector) fetch(ctx context.Context, url string) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	schemas, err := events.FetchSchemas(ctx, url)
+	if err != nil {
+		logrus.Debugf("No schemas from %s: %+v", url, err)
+		return
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if _, ok := c.urls[url]; ok {
+		c.Registry.Set(url, schemas)
+	}
+}
@@ -0,0 +1,44 @@
+package schemas
+
+import (
+	"context"
+	"io"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"ponglehub.co.uk/lib/events"
+)
+
+func TestCollector(t *testing.T) {
+	logrus.SetOutput(io.Discard)
+
+	registry := events.NewRegistry()
+	registry.Set("game", map[string]events.RouteSchema{
+		"game.move": {Request: &events.Schema{Type: "object", Required: []string{"position"}}},
+	})
+
+	subscriber := httptest.NewServer(registry)
+	defer subscriber.Close()
+
+	collector := New()
+	collector.Add(context.Background(), subscriber.URL)
+	collector.Add(context.Background(), subscriber.URL)
+
+	assert.Eventually(t, func() bool {
+		_, ok := collector.Registry.Lookup("game.move")
+		return ok
+	}, time.Second, 10*time.Millisecond)
+
+	assert.EqualError(t, collector.Registry.Validate("game.move", []byte(`{}`)), "position: missing required property")
+
+	collector.Remove(subscriber.URL)
+	_, ok := collector.Registry.Lookup("game.move")
+	assert.True(t, ok, "schemas should be kept while another trigger uses the url")
+
+	collector.Remove(subscriber.URL)
+	_, ok = collector.Registry.Lookup("game.move")
+	assert.False(t, ok)
+}
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"sync"
+
+	"ponglehub.co.uk/events/broker/internal/subscribers"
+	"ponglehub.co.uk/lib/events"
+)
+
+// Clients caches the client for each trigger, so that deliveries reuse the same client until the trigger's url,
+// options or dead letter sink change
+type Clients struct {
+	lock    sync.Mutex
+	clients map[string]cachedClient
+}
+
+type cachedClient struct {
+	url        string
+	options    subscribers.Options
+	deadLetter events.DeadLetterSink
+	client     *events.Events
+}
+
+func NewClients() *Clients {
+	return &Clients{
+		clients: map[string]cachedClient{},
+	}
+}
+
+// Get returns the trigger's cached client if it was created with the same url, options and dead letter sink,
+// otherwise creates a new one. A nil Clients creates a new client every time.
+func (c *Clients) Get(trigger string, url string, options subscribers.Options, deadLetter events.DeadLetterSink, create func() (*events.Events, error)) (*events.Events, error) {
+	if c == nil {
+		return create()
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	cached, ok := c.clients[trigger]
+	if ok && cached.url == url && cached.options == options && cached.deadLetter == deadLetter {
+		return cached.client, nil
+	}
+
+	client, err := create()
+	if err != nil {
+		return nil, err
+	}
+
+	c.clients[trigger] = cachedClient{url: url, options: options, deadLetter: deadLetter, client: client}
+
+	return client, nil
+}
+
+// Remove forgets the trigger's client, e.g. once the trigger is deleted
+func (c *Clients) Remove(trigger string) {
+	if c == nil {
+		return
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	delete(c.clients, trigger)
+}
@@ -0,0 +1,35 @@
+package server
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var (
+	routedCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "broker_events_routed_total",
+		Help: "Events received by the broker, by type",
+	}, []string{"type"})
+
+	matchesHistogram = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "broker_route_matches",
+		Help:    "Number of subscribers matched by each event",
+		Buckets: []float64{0, 1, 2, 5, 10, 20},
+	})
+
+	fanOutFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "broker_fanout_failures_total",
+		Help: "Events which couldn't be proxied to a subscriber, by type and trigger",
+	}, []string{"type", "trigger"})
+
+	refusedCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "broker_events_refused_total",
+		Help: "Events refused because a subscriber had too many pending, by trigger",
+	}, []string{"trigger"})
+
+	rejectedCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "broker_events_rejected_total",
+		Help: "Events rejected because they weren't sent by a known publisher, or their publisher wasn't allowed to send them, by type",
+	}, []string{"type"})
+)
+
+func init() {
+	prometheus.MustRegister(routedCounter, matchesHistogram, fanOutFailures, refusedCounter, rejectedCounter)
+}
@@ -2,42 +2,230 @@ package server
 
 import (
 	"context"
+	"fmt"
+	"net/http"
+	"time"
 
 	"github.com/cloudevents/sdk-go/v2/event"
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"ponglehub.co.uk/events/broker/internal/admin"
 	"ponglehub.co.uk/events/broker/internal/router"
+	"ponglehub.co.uk/events/broker/internal/subscribers"
+	"ponglehub.co.uk/events/broker/internal/triggers"
 	"ponglehub.co.uk/lib/events"
 )
 
-func Start(router *router.Router) (context.CancelFunc, error) {
-	cancelFunc, err := events.Listen(80, func(ctx context.Context, event event.Event) {
+// DefaultRetryPolicy gives up on a subscriber after ten seconds, so that a slow subscriber doesn't hold on to
+// fan-out goroutines for long
+var DefaultRetryPolicy = events.RetryPolicy{
+	Backoff:    events.ExponentialBackoff,
+	Delay:      100 * time.Millisecond,
+	MaxDelay:   2 * time.Second,
+	Jitter:     0.2,
+	MaxRetries: 10,
+	MaxElapsed: 10 * time.Second,
+}
+
+// Queue persists events for each trigger, see the queue package
+type Queue interface {
+	Enqueue(ctx context.Context, target string, event event.Event) error
+}
+
+// Publishers authenticates the events sent to the broker, see the publishers package
+type Publishers interface {
+	Check(event event.Event) error
+}
+
+// Store keeps every event the broker accepts, see the store package
+type Store interface {
+	Append(ctx context.Context, event event.Event) error
+}
+
+type StartArgs struct {
+	Transport events.Transport
+	Address   string
+	// Publishers optionally rejects events which weren't sent by a known publisher, or which it isn't allowed to send
+	Publishers Publishers
+	Router     *router.Router
+	// Triggers resolves the router's targets to urls, without it the targets are taken to be urls
+	Triggers *triggers.Triggers
+	// Deliveries optionally tracks the deliveries in flight and recent failures, for the admin endpoints
+	Deliveries *admin.Tracker
+	// Subscribers optionally holds the delivery options for each trigger
+	Subscribers *subscribers.Subscribers
+	// Clients optionally caches the client for each trigger, without it each delivery creates its own
+	Clients *Clients
+	// Retry defaults to DefaultRetryPolicy, for subscribers without their own retry policy
+	Retry *events.RetryPolicy
+	// DeadLetter optionally receives events that couldn't be delivered to a subscriber without its own sink
+	DeadLetter events.DeadLetterSink
+	// SkipDeadLetter delivers without any dead letter sink, for callers like the queue which retry failed
+	// deliveries and dead-letter the event themselves once they give up on it
+	SkipDeadLetter bool
+	// Queue optionally stores events for each trigger before they're acknowledged, leaving delivery to the
+	// queue's consumers. Without it events are proxied straight to subscribers and lost if the broker stops.
+	Queue Queue
+	// Store optionally keeps every event before it's routed, so that it can be replayed later. Events which can't
+	// be stored are rejected, so that the sender retries them.
+	Store Store
+}
+
+func Start(ctx context.Context, args StartArgs) (<-chan error, error) {
+	done, err := args.Transport.Listen(ctx, args.Address, func(ctx context.Context, event event.Event) error {
 		logrus.Infof("received event %s from %s", event.Type(), event.Source())
-		urls := router.GetURLs(event.Type())
 
-		for _, url := range urls {
-			go func(url string) {
-				logrus.Infof("proxying %s, %s -> %s", event.Type(), event.Source(), url)
-				client, err := events.New(events.EventsArgs{
-					BrokerURL: url,
-					Source:    event.Source(),
-				})
+		ctx, span := events.StartSpan(ctx, "route "+event.Type(), trace.WithSpanKind(trace.SpanKindConsumer))
+		defer span.End()
+
+		if args.Publishers != nil {
+			err := args.Publishers.Check(event)
+			if err != nil {
+				rejectedCounter.WithLabelValues(event.Type()).Inc()
+				return err
+			}
+		}
+
+		if args.Store != nil {
+			err := args.Store.Append(ctx, event)
+			if err != nil {
+				return fmt.Errorf("failed to store %s: %+v", event.Type(), err)
+			}
+		}
+
+		targets := []string{}
+		for _, target := range args.Router.GetURLs(event.Type()) {
+			if _, ok := args.Triggers.Resolve(target, event); ok {
+				targets = append(targets, target)
+			}
+		}
+
+		routedCounter.WithLabelValues(event.Type()).Inc()
+		matchesHistogram.Observe(float64(len(targets)))
+		span.SetAttributes(attribute.Int("broker.matches", len(targets)))
+
+		if args.Queue != nil {
+			queued := event.Clone()
+			events.InjectTrace(ctx, &queued)
 
+			for _, target := range targets {
+				err := args.Queue.Enqueue(ctx, target, queued)
 				if err != nil {
-					logrus.Errorf("Failed to create client for %s: %+v", url, err)
-					return
+					fanOutFailures.WithLabelValues(event.Type(), target).Inc()
+					return fmt.Errorf("failed to queue %s for %s: %+v", event.Type(), target, err)
+				}
+			}
+
+			return nil
+		}
+
+		// reserve room with every subscriber first, so that a sender retrying a refused event doesn't deliver it
+		// twice to the subscribers which had room the first time
+		reserved := []*subscribers.Subscriber{}
+		for _, target := range targets {
+			subscriber := args.Subscribers.Get(target)
+
+			// without a queue there's nowhere to keep a paused subscriber's events, so refuse them for the sender
+			// to retry rather than dropping them
+			paused := subscriber.Options().Paused
+			if paused || !subscriber.Reserve() {
+				for _, subscriber := range reserved {
+					subscriber.Cancel()
+				}
+
+				if paused {
+					logrus.Warnf("refusing %s for paused subscriber %s, there's no queue to hold it", event.Type(), target)
+					return &events.StatusError{
+						StatusCode: http.StatusServiceUnavailable,
+						Err:        fmt.Errorf("%s is paused", target),
+					}
+				}
+
+				refusedCounter.WithLabelValues(target).Inc()
+				return &events.StatusError{
+					StatusCode: http.StatusTooManyRequests,
+					Err:        fmt.Errorf("too many events pending for %s", target),
 				}
+			}
 
-				err = client.Proxy(event)
+			reserved = append(reserved, subscriber)
+		}
+
+		for _, subscriber := range reserved {
+			target := subscriber.Trigger
+			subscriber.Dispatch(event, func() {
+				err := Deliver(ctx, args, target, event)
 				if err != nil {
-					logrus.Errorf("Failed to send event %s %s -> %s: %+v", event.Type(), event.Source(), url, err)
+					logrus.Errorf("Failed to send event %s %s -> %s: %+v", event.Type(), event.Source(), target, err)
 				}
-			}(url)
+			})
 		}
+
+		return nil
 	})
 
 	if err != nil {
 		return nil, err
 	}
 
-	return cancelFunc, nil
+	return done, nil
+}
+
+// Deliver proxies an event to a router target's url, using its trigger's delivery options and falling back to those
+// in args
+func Deliver(ctx context.Context, args StartArgs, target string, event event.Event) error {
+	trigger, ok := args.Triggers.Lookup(target)
+	if !ok {
+		return fmt.Errorf("unknown trigger %s", target)
+	}
+	url := trigger.URL
+
+	subscriber := args.Subscribers.Get(target)
+	options := subscriber.Options()
+
+	retry := DefaultRetryPolicy
+	if options.Retry != nil {
+		retry = *options.Retry
+	} else if args.Retry != nil {
+		retry = *args.Retry
+	}
+
+	deadLetter := args.DeadLetter
+	if options.DeadLetter != nil {
+		deadLetter = options.DeadLetter
+	}
+	if args.SkipDeadLetter {
+		deadLetter = nil
+	}
+
+	logrus.Infof("proxying %s, %s -> %s", event.Type(), event.Source(), url)
+	done := args.Deliveries.Start(url, event)
+
+	client, err := args.Clients.Get(target, url, options, deadLetter, func() (*events.Events, error) {
+		return events.New(events.EventsArgs{
+			BrokerURL:  url,
+			Source:     "event-broker",
+			Transport:  args.Transport,
+			Retry:      &retry,
+			Timeout:    options.Timeout,
+			DeadLetter: deadLetter,
+		})
+	})
+	if err != nil {
+		fanOutFailures.WithLabelValues(event.Type(), target).Inc()
+		err = fmt.Errorf("failed to create client for %s: %+v", url, err)
+		done(err)
+		return err
+	}
+
+	err = client.ProxyContext(ctx, event)
+	subscriber.Record(err)
+	done(err)
+	if err != nil {
+		fanOutFailures.WithLabelValues(event.Type(), target).Inc()
+		return err
+	}
+
+	return nil
 }
@@ -0,0 +1,465 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cloudevents/sdk-go/v2/event"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"ponglehub.co.uk/events/broker/internal/router"
+	"ponglehub.co.uk/events/broker/internal/subscribers"
+	"ponglehub.co.uk/events/broker/internal/triggers"
+	"ponglehub.co.uk/lib/events"
+)
+
+func TestFanOut(t *testing.T) {
+	logrus.SetOutput(io.Discard)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	transport := events.NewMemoryTransport()
+
+	received := make(chan string, 10)
+	_, err := transport.Listen(ctx, "recorder", func(ctx context.Context, event event.Event) error {
+		received <- event.Type()
+		return nil
+	})
+	assert.NoError(t, err)
+
+	r := router.New()
+	r.Add("test.*", "recorder")
+
+	_, err = Start(ctx, StartArgs{
+		Transport: transport,
+		Address:   "broker",
+		Router:    r,
+	})
+	assert.NoError(t, err)
+
+	sender, err := events.New(events.EventsArgs{
+		BrokerURL: "broker",
+		Source:    "unit-tests",
+		Transport: transport,
+	})
+	assert.NoError(t, err)
+
+	for _, eventType := range []string{"test", "test.event", "other.event", "test.random"} {
+		assert.NoError(t, sender.Send(eventType, "some event data"))
+	}
+
+	batch := []event.Event{}
+	for _, eventType := range []string{"test.first", "other.second", "test.third"} {
+		event, err := sender.NewEvent(eventType, "some event data")
+		assert.NoError(t, err)
+		batch = append(batch, event)
+	}
+	assert.NoError(t, sender.ProxyBatch(ctx, batch))
+
+	actual := []string{}
+	for len(actual) < 4 {
+		select {
+		case eventType := <-received:
+			actual = append(actual, eventType)
+		case <-time.After(time.Second):
+			t.Fatalf("timed out waiting for events, got %v", actual)
+		}
+	}
+
+	sort.Strings(actual)
+	assert.Equal(t, []string{"test.event", "test.first", "test.random", "test.third"}, actual)
+	assert.Equal(t, 1.0, testutil.ToFloat64(routedCounter.WithLabelValues("other.event")))
+}
+
+func TestSubscriberOptions(t *testing.T) {
+	logrus.SetOutput(io.Discard)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	transport := events.NewMemoryTransport()
+
+	received := make(chan string, 10)
+	for _, address := range []string{"active", "paused"} {
+		address := address
+		_, err := transport.Listen(ctx, address, func(ctx context.Context, event event.Event) error {
+			received <- address
+			return nil
+		})
+		assert.NoError(t, err)
+	}
+
+	r := router.New()
+	r.Add("test.*", "active")
+	r.Add("test.*", "paused")
+
+	subs := subscribers.New()
+	subs.Set("active", subscribers.DefaultOptions)
+	subs.Set("paused", subscribers.Options{Paused: true})
+
+	_, err := Start(ctx, StartArgs{
+		Transport:   transport,
+		Address:     "broker",
+		Router:      r,
+		Subscribers: subs,
+	})
+	assert.NoError(t, err)
+
+	sender, err := events.New(events.EventsArgs{
+		BrokerURL: "broker",
+		Source:    "unit-tests",
+		Transport: transport,
+		Retry:     &events.RetryPolicy{},
+	})
+	assert.NoError(t, err)
+
+	// without a queue, events for a paused subscriber are refused for the sender to retry
+	err = sender.Send("test.first", "some event data")
+	assert.Equal(t, http.StatusServiceUnavailable, events.StatusCode(err))
+
+	select {
+	case address := <-received:
+		t.Fatalf("unexpected event for %s", address)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	subs.Set("paused", subscribers.DefaultOptions)
+	assert.NoError(t, sender.Send("test.first", "some event data"))
+
+	addresses := []string{}
+	for i := 0; i < 2; i++ {
+		select {
+		case address := <-received:
+			addresses = append(addresses, address)
+		case <-time.After(time.Second):
+			t.Fatalf("timed out waiting for events")
+		}
+	}
+	assert.ElementsMatch(t, []string{"active", "paused"}, addresses)
+
+	assert.Eventually(t, func() bool {
+		return subs.Get("active").Stats().Delivered == 1
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestTriggersSharingURL(t *testing.T) {
+	logrus.SetOutput(io.Discard)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	transport := events.NewMemoryTransport()
+
+	received := make(chan string, 10)
+	_, err := transport.Listen(ctx, "subscriber", func(ctx context.Context, event event.Event) error {
+		received <- event.Type()
+		return nil
+	})
+	assert.NoError(t, err)
+
+	r := router.New()
+	r.Add("test.*", "games/active")
+	r.Add("test.*", "games/limited")
+
+	tr := triggers.New()
+	tr.Set("games/active", triggers.Trigger{URL: "subscriber"})
+	tr.Set("games/limited", triggers.Trigger{URL: "subscriber"})
+
+	subs := subscribers.New()
+	subs.Set("games/active", subscribers.DefaultOptions)
+	subs.Set("games/limited", subscribers.Options{MaxConcurrency: 1})
+
+	_, err = Start(ctx, StartArgs{
+		Transport:   transport,
+		Address:     "broker",
+		Router:      r,
+		Triggers:    tr,
+		Subscribers: subs,
+		Clients:     NewClients(),
+	})
+	assert.NoError(t, err)
+
+	sender, err := events.New(events.EventsArgs{
+		BrokerURL: "broker",
+		Source:    "unit-tests",
+		Transport: transport,
+	})
+	assert.NoError(t, err)
+
+	assert.NoError(t, sender.Send("test.first", "some event data"))
+	assert.NoError(t, sender.Send("test.second", "some event data"))
+
+	// each trigger gets its own copy of every event
+	for i := 0; i < 4; i++ {
+		select {
+		case <-received:
+		case <-time.After(time.Second):
+			t.Fatalf("timed out waiting for events")
+		}
+	}
+
+	assert.Eventually(t, func() bool {
+		return subs.Get("games/active").Stats().Delivered == 2 && subs.Get("games/limited").Stats().Delivered == 2
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, 100, subs.Get("games/active").Options().MaxConcurrency)
+	assert.Equal(t, 1, subs.Get("games/limited").Options().MaxConcurrency)
+}
+
+type stubStore struct {
+	lock   sync.Mutex
+	types  []string
+	failed bool
+}
+
+func (s *stubStore) Append(ctx context.Context, event event.Event) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.failed {
+		return errors.New("store unavailable")
+	}
+
+	s.types = append(s.types, event.Type())
+	return nil
+}
+
+func TestStore(t *testing.T) {
+	logrus.SetOutput(io.Discard)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	transport := events.NewMemoryTransport()
+
+	received := make(chan string, 10)
+	_, err := transport.Listen(ctx, "recorder", func(ctx context.Context, event event.Event) error {
+		received <- event.Type()
+		return nil
+	})
+	assert.NoError(t, err)
+
+	r := router.New()
+	r.Add("test.*", "recorder")
+
+	store := &stubStore{}
+
+	_, err = Start(ctx, StartArgs{
+		Transport: transport,
+		Address:   "broker",
+		Router:    r,
+		Store:     store,
+	})
+	assert.NoError(t, err)
+
+	sender, err := events.New(events.EventsArgs{
+		BrokerURL: "broker",
+		Source:    "unit-tests",
+		Transport: transport,
+		Retry:     &events.RetryPolicy{Delay: time.Millisecond, MaxRetries: 1},
+	})
+	assert.NoError(t, err)
+
+	assert.NoError(t, sender.Send("test.event", "some event data"))
+	assert.NoError(t, sender.Send("other.event", "some event data"))
+
+	select {
+	case eventType := <-received:
+		assert.Equal(t, "test.event", eventType)
+	case <-time.After(time.Second):
+		t.Fatalf("timed out waiting for events")
+	}
+
+	store.lock.Lock()
+	assert.Equal(t, []string{"test.event", "other.event"}, store.types)
+	store.failed = true
+	store.lock.Unlock()
+
+	assert.Error(t, sender.Send("test.rejected", "some event data"))
+
+	select {
+	case eventType := <-received:
+		t.Fatalf("unexpected event %s", eventType)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestBackpressure(t *testing.T) {
+	logrus.SetOutput(io.Discard)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	transport := events.NewMemoryTransport()
+
+	release := make(chan struct{})
+	received := make(chan string, 10)
+	for _, address := range []string{"fast", "slow"} {
+		address := address
+		_, err := transport.Listen(ctx, address, func(ctx context.Context, event event.Event) error {
+			if address == "slow" {
+				<-release
+			}
+
+			received <- address
+			return nil
+		})
+		assert.NoError(t, err)
+	}
+
+	r := router.New()
+	r.Add("test.*", "fast")
+	r.Add("test.*", "slow")
+
+	subs := subscribers.New()
+	subs.Set("fast", subscribers.DefaultOptions)
+	subs.Set("slow", subscribers.Options{MaxPending: 1})
+
+	_, err := Start(ctx, StartArgs{
+		Transport:   transport,
+		Address:     "broker",
+		Router:      r,
+		Subscribers: subs,
+		Clients:     NewClients(),
+	})
+	assert.NoError(t, err)
+
+	sender, err := events.New(events.EventsArgs{
+		BrokerURL: "broker",
+		Source:    "unit-tests",
+		Transport: transport,
+		Retry:     &events.RetryPolicy{Delay: time.Millisecond, MaxRetries: 0},
+	})
+	assert.NoError(t, err)
+
+	assert.NoError(t, sender.Send("test.first", "some event data"))
+
+	err = sender.Send("test.second", "some event data")
+	assert.Equal(t, http.StatusTooManyRequests, events.StatusCode(err))
+
+	close(release)
+
+	actual := []string{}
+	for len(actual) < 2 {
+		select {
+		case address := <-received:
+			actual = append(actual, address)
+		case <-time.After(time.Second):
+			t.Fatalf("timed out waiting for events, got %v", actual)
+		}
+	}
+
+	sort.Strings(actual)
+	assert.Equal(t, []string{"fast", "slow"}, actual)
+
+	select {
+	case address := <-received:
+		t.Fatalf("unexpected event for %s", address)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(refusedCounter.WithLabelValues("slow")))
+}
+
+func TestClients(t *testing.T) {
+	clients := NewClients()
+
+	created := 0
+	create := func() (*events.Events, error) {
+		created += 1
+		return events.New(events.EventsArgs{BrokerURL: "subscriber", Transport: events.NewMemoryTransport()})
+	}
+
+	first, err := clients.Get("games/subscriber", "subscriber", subscribers.DefaultOptions, nil, create)
+	assert.NoError(t, err)
+
+	second, err := clients.Get("games/subscriber", "subscriber", subscribers.DefaultOptions, nil, create)
+	assert.NoError(t, err)
+	assert.Same(t, first, second)
+
+	_, err = clients.Get("games/subscriber", "subscriber", subscribers.Options{Timeout: time.Second}, nil, create)
+	assert.NoError(t, err)
+
+	clients.Remove("games/subscriber")
+	_, err = clients.Get("games/subscriber", "subscriber", subscribers.Options{Timeout: time.Second}, nil, create)
+	assert.NoError(t, err)
+
+	_, err = clients.Get("games/subscriber", "moved", subscribers.Options{Timeout: time.Second}, nil, create)
+	assert.NoError(t, err)
+
+	assert.Equal(t, 4, created)
+}
+
+type stubPublishers struct{}
+
+func (s stubPublishers) Check(event event.Event) error {
+	if event.Source() != "client" {
+		return &events.StatusError{StatusCode: http.StatusForbidden, Err: errors.New("forbidden")}
+	}
+
+	return nil
+}
+
+func TestPublishers(t *testing.T) {
+	logrus.SetOutput(io.Discard)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	transport := events.NewMemoryTransport()
+
+	received := make(chan string, 10)
+	_, err := transport.Listen(ctx, "recorder", func(ctx context.Context, event event.Event) error {
+		received <- event.Source()
+		return nil
+	})
+	assert.NoError(t, err)
+
+	r := router.New()
+	r.Add("test.*", "recorder")
+
+	_, err = Start(ctx, StartArgs{
+		Transport:  transport,
+		Address:    "broker",
+		Router:     r,
+		Publishers: stubPublishers{},
+	})
+	assert.NoError(t, err)
+
+	for _, source := range []string{"server", "client"} {
+		sender, err := events.New(events.EventsArgs{
+			BrokerURL: "broker",
+			Source:    source,
+			Transport: transport,
+			Retry:     &events.RetryPolicy{MaxRetries: 0},
+		})
+		assert.NoError(t, err)
+
+		err = sender.Send("test.event", "some event data")
+		if source == "client" {
+			assert.NoError(t, err)
+		} else {
+			assert.Equal(t, http.StatusForbidden, events.StatusCode(err))
+		}
+	}
+
+	select {
+	case source := <-received:
+		assert.Equal(t, "client", source)
+	case <-time.After(time.Second):
+		t.Fatalf("timed out waiting for events")
+	}
+
+	select {
+	case source := <-received:
+		t.Fatalf("unexpected event from %s", source)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -0,0 +1,109 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/cloudevents/sdk-go/v2/event"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"ponglehub.co.uk/lib/postgres/pkg/connect"
+)
+
+// Record is an event as the broker accepted it
+type Record struct {
+	Seq      int64
+	Received time.Time
+	Event    event.Event
+}
+
+// Query selects the events received in [From, To), after the record with sequence number After. A zero To means
+// up until now.
+type Query struct {
+	From  time.Time
+	To    time.Time
+	After int64
+	Limit int
+}
+
+// Store appends every event the broker accepts to the events table, see cmd/migrations, so that they can be
+// replayed to subscribers and kept as an audit history
+type Store struct {
+	pool *pgxpool.Pool
+}
+
+func New(cfg connect.ConnectConfig) (*Store, error) {
+	pool, err := connect.ConnectPool(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %+v", err)
+	}
+
+	return &Store{pool: pool}, nil
+}
+
+func (s *Store) Stop() {
+	s.pool.Close()
+}
+
+// Append stores the event, ignoring events with the same source and id that it has already stored, e.g. from
+// senders retrying
+func (s *Store) Append(ctx context.Context, event event.Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %+v", err)
+	}
+
+	_, err = s.pool.Exec(
+		ctx,
+		"INSERT INTO events (source, id, type, received, event) VALUES ($1, $2, $3, $4, $5) ON CONFLICT (source, id) DO NOTHING",
+		event.Source(), event.ID(), event.Type(), time.Now(), data,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to store event: %+v", err)
+	}
+
+	return nil
+}
+
+// Events returns the stored events matching the query, in the order they were received
+func (s *Store) Events(ctx context.Context, query Query) ([]Record, error) {
+	to := query.To
+	if to.IsZero() {
+		to = time.Now()
+	}
+
+	rows, err := s.pool.Query(
+		ctx,
+		"SELECT seq, received, event FROM events WHERE received >= $1 AND received < $2 AND seq > $3 ORDER BY seq LIMIT $4",
+		query.From, to, query.After, query.Limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query events: %+v", err)
+	}
+	defer rows.Close()
+
+	records := []Record{}
+	for rows.Next() {
+		var record Record
+		var data []byte
+
+		err = rows.Scan(&record.Seq, &record.Received, &data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read event: %+v", err)
+		}
+
+		err = json.Unmarshal(data, &record.Event)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode event %d: %+v", record.Seq, err)
+		}
+
+		records = append(records, record)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read events: %+v", err)
+	}
+
+	return records, nil
+}
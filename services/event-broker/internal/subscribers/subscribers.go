@@ -0,0 +1,380 @@
+package subscribers
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudevents/sdk-go/v2/event"
+	"github.com/sirupsen/logrus"
+	"ponglehub.co.uk/events/broker/internal/crds"
+	"ponglehub.co.uk/events/broker/internal/triggers"
+	"ponglehub.co.uk/lib/events"
+)
+
+// Options controls deliveries to a subscriber, set from its EventTrigger
+type Options struct {
+	// Timeout limits each delivery attempt, zero for the transport's default
+	Timeout time.Duration
+	// Retry overrides the broker's retry policy
+	Retry *events.RetryPolicy
+	// MaxConcurrency limits the deliveries in flight, zero for no limit
+	MaxConcurrency int
+	// MaxPending limits the events waiting for or in delivery, further events are refused until there's room,
+	// zero for no limit
+	MaxPending int
+	// Ordered delivers events with the same ordering key one at a time, events without a key aren't held back
+	Ordered bool
+	// OrderingKey is the attribute holding the ordering key, defaults to the partitionkey extension
+	OrderingKey string
+	// DeadLetter overrides the broker's dead letter sink
+	DeadLetter events.DeadLetterSink
+	Paused     bool
+}
+
+// DefaultOptions delivers the events sharing a partitionkey extension in order, a hundred at a time, and refuses
+// events once a thousand are pending
+var DefaultOptions = Options{
+	MaxConcurrency: 100,
+	MaxPending:     1000,
+	Ordered:        true,
+	OrderingKey:    events.PartitionKeyExtension,
+}
+
+// Stats counts the deliveries to a subscriber since the broker started
+type Stats struct {
+	Delivered     int64
+	Failed        int64
+	LastError     string
+	LastErrorTime time.Time
+}
+
+// Subscriber tracks the deliveries for a single trigger
+type Subscriber struct {
+	// Trigger is the trigger's key, see triggers.Key
+	Trigger string
+
+	lock    sync.Mutex
+	options Options
+	slots   chan struct{}
+	keys    map[string][]func()
+	pending int
+	stats   Stats
+}
+
+// Subscribers holds the subscriber for each trigger, keyed by namespace/name. Triggers sharing a url each have their
+// own options, limits and stats.
+type Subscribers struct {
+	lock        sync.RWMutex
+	subscribers map[string]*Subscriber
+}
+
+func New() *Subscribers {
+	return &Subscribers{
+		subscribers: map[string]*Subscriber{},
+	}
+}
+
+func newSubscriber(trigger string, options Options) *Subscriber {
+	subscriber := &Subscriber{
+		Trigger: trigger,
+		keys:    map[string][]func(){},
+	}
+	subscriber.setOptions(options)
+
+	return subscriber
+}
+
+// Set creates or updates the trigger's subscriber, keeping its pending deliveries and stats
+func (s *Subscribers) Set(trigger string, options Options) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	subscriber, ok := s.subscribers[trigger]
+	if !ok {
+		s.subscribers[trigger] = newSubscriber(trigger, options)
+		return
+	}
+
+	subscriber.setOptions(options)
+}
+
+// Remove forgets the trigger's subscriber
+func (s *Subscribers) Remove(trigger string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	delete(s.subscribers, trigger)
+}
+
+// Get returns the trigger's subscriber, or one with default options if it hasn't set any
+func (s *Subscribers) Get(trigger string) *Subscriber {
+	if s == nil {
+		return newSubscriber(trigger, DefaultOptions)
+	}
+
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	subscriber, ok := s.subscribers[trigger]
+	if !ok {
+		return newSubscriber(trigger, DefaultOptions)
+	}
+
+	return subscriber
+}
+
+// DeadLetterSink passes each failure on to the dead letter sink of the subscriber it was for, taking the failure's
+// target to be a trigger key, or fallback if the subscriber doesn't have one. Failures are dropped if neither does.
+func (s *Subscribers) DeadLetterSink(fallback events.DeadLetterSink) events.DeadLetterSink {
+	return deadLetterSink{subscribers: s, fallback: fallback}
+}
+
+type deadLetterSink struct {
+	subscribers *Subscribers
+	fallback    events.DeadLetterSink
+}
+
+func (d deadLetterSink) DeadLetter(event event.Event, failure events.DeliveryFailure) error {
+	sink := d.subscribers.Get(failure.Target).Options().DeadLetter
+	if sink == nil {
+		sink = d.fallback
+	}
+
+	if sink == nil {
+		logrus.Warnf("Dropping undeliverable %s for %s", event.Type(), failure.Target)
+		return nil
+	}
+
+	return sink.DeadLetter(event, failure)
+}
+
+func (s *Subscriber) setOptions(options Options) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if options.MaxConcurrency != s.options.MaxConcurrency {
+		s.slots = nil
+		if options.MaxConcurrency > 0 {
+			s.slots = make(chan struct{}, options.MaxConcurrency)
+		}
+	}
+
+	s.options = options
+}
+
+func (s *Subscriber) Options() Options {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.options
+}
+
+func (s *Subscriber) Stats() Stats {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.stats
+}
+
+// Record counts the result of a delivery
+func (s *Subscriber) Record(err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if err == nil {
+		s.stats.Delivered += 1
+		return
+	}
+
+	s.stats.Failed += 1
+	s.stats.LastError = err.Error()
+	s.stats.LastErrorTime = time.Now()
+}
+
+// Reserve makes room for an event to be dispatched, or returns false if the subscriber already has MaxPending
+// events. Each reservation is released by dispatching the event, or by Cancel.
+func (s *Subscriber) Reserve() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.options.MaxPending > 0 && s.pending >= s.options.MaxPending {
+		return false
+	}
+
+	s.pending += 1
+	return true
+}
+
+// Cancel releases a reservation without dispatching an event
+func (s *Subscriber) Cancel() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.pending -= 1
+}
+
+// Dispatch calls deliver in the background once the subscriber has capacity for it, releasing the event's
+// reservation once it's delivered. For ordered subscribers, events with the same ordering key wait for the previous
+// one to be delivered, while events with other keys carry on.
+func (s *Subscriber) Dispatch(event event.Event, deliver func()) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	next := deliver
+	deliver = func() {
+		defer s.Cancel()
+		next()
+	}
+
+	key := ""
+	if s.options.Ordered {
+		key, _ = triggers.Attribute(event, s.options.OrderingKey)
+	}
+
+	if key == "" {
+		go s.run(deliver)
+		return
+	}
+
+	queued, busy := s.keys[key]
+	s.keys[key] = append(queued, deliver)
+
+	if !busy {
+		go s.drain(key)
+	}
+}
+
+func (s *Subscriber) drain(key string) {
+	for {
+		s.lock.Lock()
+		queued := s.keys[key]
+		if len(queued) == 0 {
+			delete(s.keys, key)
+			s.lock.Unlock()
+			return
+		}
+
+		s.keys[key] = queued[1:]
+		s.lock.Unlock()
+
+		s.run(queued[0])
+	}
+}
+
+func (s *Subscriber) run(deliver func()) {
+	s.lock.Lock()
+	slots := s.slots
+	s.lock.Unlock()
+
+	if slots != nil {
+		slots <- struct{}{}
+		defer func() { <-slots }()
+	}
+
+	deliver()
+}
+
+// FromSpec reads the delivery options from an EventTrigger
+func FromSpec(spec crds.EventTriggerSpec, transport events.Transport) (Options, error) {
+	options := DefaultOptions
+	options.Paused = spec.Paused
+
+	if spec.MaxConcurrency > 0 {
+		options.MaxConcurrency = spec.MaxConcurrency
+	}
+
+	if spec.MaxPending > 0 {
+		options.MaxPending = spec.MaxPending
+	}
+
+	if spec.OrderingKey != "" {
+		options.OrderingKey = strings.ToLower(spec.OrderingKey)
+	}
+
+	switch spec.Ordering {
+	case "", crds.KeyOrderedDelivery:
+	case crds.UnorderedDelivery:
+		options.Ordered = false
+	default:
+		return Options{}, fmt.Errorf("unknown ordering %s", spec.Ordering)
+	}
+
+	var err error
+	options.Timeout, err = duration("timeout", spec.Timeout)
+	if err != nil {
+		return Options{}, err
+	}
+
+	if spec.Retry != nil {
+		retry, err := retryPolicy(*spec.Retry)
+		if err != nil {
+			return Options{}, err
+		}
+
+		options.Retry = &retry
+	}
+
+	if spec.DeadLetterURL != "" {
+		options.DeadLetter, err = events.New(events.EventsArgs{
+			BrokerURL: spec.DeadLetterURL,
+			Source:    "event-broker",
+			Transport: transport,
+		})
+		if err != nil {
+			return Options{}, fmt.Errorf("failed to create dead letter client: %+v", err)
+		}
+	}
+
+	return options, nil
+}
+
+func retryPolicy(spec crds.RetrySpec) (events.RetryPolicy, error) {
+	policy := events.RetryPolicy{MaxRetries: spec.MaxRetries}
+
+	switch spec.Backoff {
+	case "", "constant":
+		policy.Backoff = events.ConstantBackoff
+	case "exponential":
+		policy.Backoff = events.ExponentialBackoff
+	default:
+		return events.RetryPolicy{}, fmt.Errorf("unknown backoff %s", spec.Backoff)
+	}
+
+	var err error
+	for _, field := range []struct {
+		name  string
+		value string
+		out   *time.Duration
+	}{
+		{name: "retry delay", value: spec.Delay, out: &policy.Delay},
+		{name: "retry max delay", value: spec.MaxDelay, out: &policy.MaxDelay},
+		{name: "retry max elapsed", value: spec.MaxElapsed, out: &policy.MaxElapsed},
+	} {
+		*field.out, err = duration(field.name, field.value)
+		if err != nil {
+			return events.RetryPolicy{}, err
+		}
+	}
+
+	// without a delay every retry would be sent straight away to a subscriber that's already failing
+	if policy.Delay == 0 {
+		policy.Delay = events.DefaultRetryPolicy.Delay
+	}
+
+	return policy, nil
+}
+
+func duration(name string, value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %s: %+v", name, value, err)
+	}
+
+	return d, nil
+}
@@ -0,0 +1,288 @@
+package subscribers
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/cloudevents/sdk-go/v2/event"
+	"github.com/stretchr/testify/assert"
+	"ponglehub.co.uk/events/broker/internal/crds"
+	"ponglehub.co.uk/lib/events"
+)
+
+func TestFromSpec(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		spec     crds.EventTriggerSpec
+		expected Options
+		err      string
+	}{
+		{
+			name:     "defaults",
+			spec:     crds.EventTriggerSpec{},
+			expected: DefaultOptions,
+		},
+		{
+			name:     "unordered",
+			spec:     crds.EventTriggerSpec{Ordering: "unordered"},
+			expected: Options{MaxConcurrency: 100, MaxPending: 1000, OrderingKey: "partitionkey"},
+		},
+		{
+			name: "everything",
+			spec: crds.EventTriggerSpec{
+				Timeout:        "5s",
+				MaxConcurrency: 4,
+				MaxPending:     10,
+				Ordering:       "key",
+				OrderingKey:    "Subject",
+				Paused:         true,
+				Retry: &crds.RetrySpec{
+					Backoff:    "exponential",
+					Delay:      "100ms",
+					MaxDelay:   "2s",
+					MaxRetries: 5,
+					MaxElapsed: "1m",
+				},
+			},
+			expected: Options{
+				Timeout:        5 * time.Second,
+				MaxConcurrency: 4,
+				MaxPending:     10,
+				Ordered:        true,
+				OrderingKey:    "subject",
+				Paused:         true,
+				Retry: &events.RetryPolicy{
+					Backoff:    events.ExponentialBackoff,
+					Delay:      100 * time.Millisecond,
+					MaxDelay:   2 * time.Second,
+					MaxRetries: 5,
+					MaxElapsed: time.Minute,
+				},
+			},
+		},
+		{
+			name: "retry without delay",
+			spec: crds.EventTriggerSpec{Retry: &crds.RetrySpec{MaxRetries: 3}},
+			expected: Options{
+				MaxConcurrency: 100,
+				MaxPending:     1000,
+				Ordered:        true,
+				OrderingKey:    "partitionkey",
+				Retry: &events.RetryPolicy{
+					Backoff:    events.ConstantBackoff,
+					Delay:      time.Second,
+					MaxRetries: 3,
+				},
+			},
+		},
+		{
+			name: "bad timeout",
+			spec: crds.EventTriggerSpec{Timeout: "soon"},
+			err:  "invalid timeout soon",
+		},
+		{
+			name: "bad ordering",
+			spec: crds.EventTriggerSpec{Ordering: "alphabetical"},
+			err:  "unknown ordering alphabetical",
+		},
+		{
+			name: "bad backoff",
+			spec: crds.EventTriggerSpec{Retry: &crds.RetrySpec{Backoff: "fibonacci"}},
+			err:  "unknown backoff fibonacci",
+		},
+		{
+			name: "bad retry delay",
+			spec: crds.EventTriggerSpec{Retry: &crds.RetrySpec{Delay: "1 second"}},
+			err:  "invalid retry delay 1 second",
+		},
+	} {
+		t.Run(test.name, func(u *testing.T) {
+			options, err := FromSpec(test.spec, events.NewMemoryTransport())
+
+			if test.err != "" {
+				if assert.Error(u, err) {
+					assert.Contains(u, err.Error(), test.err)
+				}
+				return
+			}
+
+			assert.NoError(u, err)
+			assert.Equal(u, test.expected, options)
+		})
+	}
+}
+
+func keyedEvent(key string, id string) event.Event {
+	event := cloudevents.NewEvent()
+	event.SetID(id)
+	event.SetType("test.event")
+	event.SetSource("unit-tests")
+
+	if key != "" {
+		event.SetExtension(events.PartitionKeyExtension, key)
+	}
+
+	return event
+}
+
+func TestOrderedDispatch(t *testing.T) {
+	subs := New()
+	subs.Set("games/game", DefaultOptions)
+	subscriber := subs.Get("games/game")
+
+	var lock sync.Mutex
+	delivered := map[string][]string{}
+	wg := sync.WaitGroup{}
+
+	for i := 0; i < 20; i++ {
+		for _, key := range []string{"game-1", "game-2"} {
+			key := key
+			event := keyedEvent(key, string(rune('a'+i)))
+
+			wg.Add(1)
+			assert.True(t, subscriber.Reserve())
+			subscriber.Dispatch(event, func() {
+				defer wg.Done()
+
+				// give later events every chance to overtake this one
+				time.Sleep(time.Millisecond)
+
+				lock.Lock()
+				delivered[key] = append(delivered[key], event.ID())
+				lock.Unlock()
+			})
+		}
+	}
+
+	wg.Wait()
+
+	expected := []string{}
+	for i := 0; i < 20; i++ {
+		expected = append(expected, string(rune('a'+i)))
+	}
+
+	assert.Equal(t, expected, delivered["game-1"])
+	assert.Equal(t, expected, delivered["game-2"])
+}
+
+func TestMaxConcurrency(t *testing.T) {
+	subs := New()
+	subs.Set("games/game", Options{MaxConcurrency: 2})
+	subscriber := subs.Get("games/game")
+
+	var inflight, peak int32
+	wg := sync.WaitGroup{}
+
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		assert.True(t, subscriber.Reserve())
+		subscriber.Dispatch(keyedEvent("", "id"), func() {
+			defer wg.Done()
+
+			current := atomic.AddInt32(&inflight, 1)
+			for {
+				previous := atomic.LoadInt32(&peak)
+				if current <= previous || atomic.CompareAndSwapInt32(&peak, previous, current) {
+					break
+				}
+			}
+
+			time.Sleep(5 * time.Millisecond)
+			atomic.AddInt32(&inflight, -1)
+		})
+	}
+
+	wg.Wait()
+
+	assert.Equal(t, int32(2), peak)
+}
+
+func TestMaxPending(t *testing.T) {
+	subs := New()
+	subs.Set("games/game", Options{MaxConcurrency: 1, MaxPending: 2})
+	subscriber := subs.Get("games/game")
+
+	release := make(chan struct{})
+	delivered := make(chan struct{}, 2)
+
+	for i := 0; i < 2; i++ {
+		assert.True(t, subscriber.Reserve())
+		subscriber.Dispatch(keyedEvent("", "id"), func() {
+			<-release
+			delivered <- struct{}{}
+		})
+	}
+
+	assert.False(t, subscriber.Reserve())
+
+	close(release)
+	<-delivered
+	<-delivered
+
+	assert.Eventually(t, subscriber.Reserve, time.Second, time.Millisecond)
+	assert.True(t, subscriber.Reserve())
+	assert.False(t, subscriber.Reserve())
+
+	subscriber.Cancel()
+	assert.True(t, subscriber.Reserve())
+}
+
+func TestStats(t *testing.T) {
+	subs := New()
+	subs.Set("games/game", Options{})
+
+	subscriber := subs.Get("games/game")
+	subscriber.Record(nil)
+	subscriber.Record(nil)
+	subscriber.Record(errors.New("connection refused"))
+
+	stats := subs.Get("games/game").Stats()
+	assert.Equal(t, int64(2), stats.Delivered)
+	assert.Equal(t, int64(1), stats.Failed)
+	assert.Equal(t, "connection refused", stats.LastError)
+	assert.False(t, stats.LastErrorTime.IsZero())
+
+	subs.Remove("games/game")
+	assert.Equal(t, Stats{}, subs.Get("games/game").Stats())
+}
+
+func TestGetUnknown(t *testing.T) {
+	subs := New()
+	subs.Set("games/game", Options{MaxConcurrency: 1})
+
+	assert.Equal(t, 1, subs.Get("games/game").Options().MaxConcurrency)
+	assert.Equal(t, DefaultOptions, subs.Get("games/other").Options())
+
+	var missing *Subscribers
+	assert.Equal(t, DefaultOptions, missing.Get("games/game").Options())
+}
+
+type stubSink struct {
+	failures []events.DeliveryFailure
+}
+
+func (s *stubSink) DeadLetter(event event.Event, failure events.DeliveryFailure) error {
+	s.failures = append(s.failures, failure)
+	return nil
+}
+
+func TestDeadLetterSink(t *testing.T) {
+	fallback := &stubSink{}
+	own := &stubSink{}
+
+	subs := New()
+	subs.Set("games/game", Options{DeadLetter: own})
+	subs.Set("games/other", Options{})
+
+	sink := subs.DeadLetterSink(fallback)
+	assert.NoError(t, sink.DeadLetter(keyedEvent("", "1"), events.DeliveryFailure{Target: "games/game"}))
+	assert.NoError(t, sink.DeadLetter(keyedEvent("", "2"), events.DeliveryFailure{Target: "games/other"}))
+	assert.NoError(t, sink.DeadLetter(keyedEvent("", "3"), events.DeliveryFailure{Target: "games/unknown"}))
+
+	assert.Equal(t, 1, len(own.failures))
+	assert.Equal(t, 2, len(fallback.failures))
+}
@@ -0,0 +1,596 @@
+package triggers
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/cloudevents/sdk-go/v2/event"
+)
+
+// A subset of CloudEvents SQL: AND, OR, NOT and parentheses, the comparisons = != <> < <= > >=, LIKE, IN and
+// EXISTS, with string, integer and boolean literals. Attributes are read as strings and cast for comparisons. As in
+// SQL, a test on a missing attribute is unknown rather than false: NOT leaves it unknown, OR can still be true and
+// AND still false on the other side, and an expression that's unknown doesn't match.
+
+// errMissing is the unknown result of a test on a missing attribute
+var errMissing = errors.New("missing attribute")
+
+type expression interface {
+	eval(event event.Event) (interface{}, error)
+}
+
+// ParseCESQL compiles a CESQL expression into a condition on events
+func ParseCESQL(source string) (func(event event.Event) bool, error) {
+	tokens, err := tokenise(source)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+
+	expr, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %s at position %d", p.tokens[p.pos].text, p.tokens[p.pos].offset)
+	}
+
+	return func(event event.Event) bool {
+		value, err := expr.eval(event)
+		if err != nil {
+			return false
+		}
+
+		matched, ok := value.(bool)
+		return ok && matched
+	}, nil
+}
+
+type tokenKind int
+
+const (
+	identToken tokenKind = iota
+	stringToken
+	numberToken
+	symbolToken
+)
+
+type token struct {
+	kind   tokenKind
+	text   string
+	offset int
+}
+
+func (t token) keyword(word string) bool {
+	return t.kind == identToken && strings.EqualFold(t.text, word)
+}
+
+func (t token) symbol(symbol string) bool {
+	return t.kind == symbolToken && t.text == symbol
+}
+
+func tokenise(source string) ([]token, error) {
+	tokens := []token{}
+	runes := []rune(source)
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '\'' || r == '"':
+			text := strings.Builder{}
+			j := i + 1
+			for ; j < len(runes); j++ {
+				if runes[j] == r {
+					// quotes are escaped by doubling them
+					if j+1 < len(runes) && runes[j+1] == r {
+						text.WriteRune(r)
+						j++
+						continue
+					}
+					break
+				}
+				text.WriteRune(runes[j])
+			}
+
+			if j >= len(runes) {
+				return nil, fmt.Errorf("unterminated string at position %d", i)
+			}
+
+			tokens = append(tokens, token{kind: stringToken, text: text.String(), offset: i})
+			i = j + 1
+		case unicode.IsDigit(r) || (r == '-' && i+1 < len(runes) && unicode.IsDigit(runes[i+1])):
+			j := i + 1
+			for j < len(runes) && unicode.IsDigit(runes[j]) {
+				j++
+			}
+
+			tokens = append(tokens, token{kind: numberToken, text: string(runes[i:j]), offset: i})
+			i = j
+		case unicode.IsLetter(r) || r == '_':
+			j := i + 1
+			for j < len(runes) && (unicode.IsLetter(runes[j]) || unicode.IsDigit(runes[j]) || runes[j] == '_') {
+				j++
+			}
+
+			tokens = append(tokens, token{kind: identToken, text: string(runes[i:j]), offset: i})
+			i = j
+		default:
+			symbol := string(r)
+			if i+1 < len(runes) {
+				switch pair := string(runes[i : i+2]); pair {
+				case "!=", "<>", "<=", ">=":
+					symbol = pair
+				}
+			}
+
+			if !strings.Contains("()=,<>!", string(r)) || symbol == "!" {
+				return nil, fmt.Errorf("unexpected %s at position %d", symbol, i)
+			}
+
+			tokens = append(tokens, token{kind: symbolToken, text: symbol, offset: i})
+			i += len(symbol)
+		}
+	}
+
+	return tokens, nil
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() (token, bool) {
+	if p.pos >= len(p.tokens) {
+		return token{}, false
+	}
+
+	return p.tokens[p.pos], true
+}
+
+func (p *parser) keyword(word string) bool {
+	next, ok := p.peek()
+	if ok && next.keyword(word) {
+		p.pos++
+		return true
+	}
+
+	return false
+}
+
+func (p *parser) symbol(symbol string) bool {
+	next, ok := p.peek()
+	if ok && next.symbol(symbol) {
+		p.pos++
+		return true
+	}
+
+	return false
+}
+
+func (p *parser) or() (expression, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.keyword("OR") {
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+
+		left = logical{op: "OR", left: left, right: right}
+	}
+
+	return left, nil
+}
+
+func (p *parser) and() (expression, error) {
+	left, err := p.not()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.keyword("AND") {
+		right, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+
+		left = logical{op: "AND", left: left, right: right}
+	}
+
+	return left, nil
+}
+
+func (p *parser) not() (expression, error) {
+	if p.keyword("NOT") {
+		operand, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+
+		return negation{operand: operand}, nil
+	}
+
+	return p.comparison()
+}
+
+func (p *parser) comparison() (expression, error) {
+	left, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, op := range []string{"=", "!=", "<>", "<=", ">=", "<", ">"} {
+		if p.symbol(op) {
+			right, err := p.primary()
+			if err != nil {
+				return nil, err
+			}
+
+			return comparison{op: op, left: left, right: right}, nil
+		}
+	}
+
+	start := p.pos
+	negated := p.keyword("NOT")
+
+	switch {
+	case p.keyword("LIKE"):
+		next, ok := p.peek()
+		if !ok || next.kind != stringToken {
+			return nil, errors.New("expected a string pattern after LIKE")
+		}
+		p.pos++
+
+		var expr expression = like{value: left, pattern: likePattern(next.text)}
+		if negated {
+			expr = negation{operand: expr}
+		}
+
+		return expr, nil
+	case p.keyword("IN"):
+		if !p.symbol("(") {
+			return nil, errors.New("expected ( after IN")
+		}
+
+		set := []expression{}
+		for {
+			item, err := p.primary()
+			if err != nil {
+				return nil, err
+			}
+			set = append(set, item)
+
+			if p.symbol(")") {
+				break
+			}
+
+			if !p.symbol(",") {
+				return nil, errors.New("expected , or ) in IN list")
+			}
+		}
+
+		var expr expression = in{value: left, set: set}
+		if negated {
+			expr = negation{operand: expr}
+		}
+
+		return expr, nil
+	}
+
+	p.pos = start
+
+	return left, nil
+}
+
+func (p *parser) primary() (expression, error) {
+	next, ok := p.peek()
+	if !ok {
+		return nil, errors.New("unexpected end of expression")
+	}
+	p.pos++
+
+	switch {
+	case next.symbol("("):
+		expr, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+
+		if !p.symbol(")") {
+			return nil, fmt.Errorf("missing ) for ( at position %d", next.offset)
+		}
+
+		return expr, nil
+	case next.kind == stringToken:
+		return literal{value: next.text}, nil
+	case next.kind == numberToken:
+		value, err := strconv.ParseInt(next.text, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid integer %s: %+v", next.text, err)
+		}
+
+		return literal{value: value}, nil
+	case next.keyword("TRUE"):
+		return literal{value: true}, nil
+	case next.keyword("FALSE"):
+		return literal{value: false}, nil
+	case next.keyword("EXISTS"):
+		name, ok := p.peek()
+		if !ok || name.kind != identToken {
+			return nil, errors.New("expected an attribute after EXISTS")
+		}
+		p.pos++
+
+		return exists{name: strings.ToLower(name.text)}, nil
+	case next.kind == identToken:
+		return attribute{name: strings.ToLower(next.text)}, nil
+	}
+
+	return nil, fmt.Errorf("unexpected %s at position %d", next.text, next.offset)
+}
+
+type literal struct {
+	value interface{}
+}
+
+func (l literal) eval(event event.Event) (interface{}, error) {
+	return l.value, nil
+}
+
+type attribute struct {
+	name string
+}
+
+func (a attribute) eval(event event.Event) (interface{}, error) {
+	value, ok := Attribute(event, a.name)
+	if !ok {
+		return nil, errMissing
+	}
+
+	return value, nil
+}
+
+type exists struct {
+	name string
+}
+
+func (e exists) eval(event event.Event) (interface{}, error) {
+	_, ok := Attribute(event, e.name)
+	return ok, nil
+}
+
+type logical struct {
+	op    string
+	left  expression
+	right expression
+}
+
+func (l logical) eval(event event.Event) (interface{}, error) {
+	left, leftErr := evalBool(l.left, event)
+	if leftErr != nil && !errors.Is(leftErr, errMissing) {
+		return nil, leftErr
+	}
+
+	if leftErr == nil && l.decides(left) {
+		return left, nil
+	}
+
+	right, rightErr := evalBool(l.right, event)
+	if rightErr != nil && !errors.Is(rightErr, errMissing) {
+		return nil, rightErr
+	}
+
+	if rightErr == nil && l.decides(right) {
+		return right, nil
+	}
+
+	// neither side decided it, so it's unknown if either side is
+	if leftErr != nil {
+		return nil, leftErr
+	}
+
+	return right, rightErr
+}
+
+// decides is whether one side's value is the result whatever the other side is
+func (l logical) decides(value bool) bool {
+	if l.op == "AND" {
+		return !value
+	}
+
+	return value
+}
+
+type negation struct {
+	operand expression
+}
+
+func (n negation) eval(event event.Event) (interface{}, error) {
+	value, err := evalBool(n.operand, event)
+	if err != nil {
+		return nil, err
+	}
+
+	return !value, nil
+}
+
+type comparison struct {
+	op    string
+	left  expression
+	right expression
+}
+
+func (c comparison) eval(event event.Event) (interface{}, error) {
+	left, err := c.left.eval(event)
+	if err != nil {
+		return nil, err
+	}
+
+	right, err := c.right.eval(event)
+	if err != nil {
+		return nil, err
+	}
+
+	switch c.op {
+	case "=":
+		return equal(left, right), nil
+	case "!=", "<>":
+		return !equal(left, right), nil
+	}
+
+	l, lerr := toInt(left)
+	r, rerr := toInt(right)
+	if lerr != nil || rerr != nil {
+		return nil, fmt.Errorf("%s needs integers", c.op)
+	}
+
+	switch c.op {
+	case "<":
+		return l < r, nil
+	case "<=":
+		return l <= r, nil
+	case ">":
+		return l > r, nil
+	default:
+		return l >= r, nil
+	}
+}
+
+type like struct {
+	value   expression
+	pattern *regexp.Regexp
+}
+
+func (l like) eval(event event.Event) (interface{}, error) {
+	value, err := l.value.eval(event)
+	if err != nil {
+		return nil, err
+	}
+
+	return l.pattern.MatchString(toString(value)), nil
+}
+
+type in struct {
+	value expression
+	set   []expression
+}
+
+func (i in) eval(event event.Event) (interface{}, error) {
+	value, err := i.value.eval(event)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, item := range i.set {
+		candidate, err := item.eval(event)
+		if err != nil {
+			return nil, err
+		}
+
+		if equal(value, candidate) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func evalBool(expr expression, event event.Event) (bool, error) {
+	value, err := expr.eval(event)
+	if err != nil {
+		return false, err
+	}
+
+	switch v := value.(type) {
+	case bool:
+		return v, nil
+	case string:
+		return strconv.ParseBool(v)
+	}
+
+	return false, fmt.Errorf("expected a boolean, got %v", value)
+}
+
+// equal compares the values as the type of the literal side, attributes being strings
+func equal(left interface{}, right interface{}) bool {
+	switch r := right.(type) {
+	case int64:
+		l, err := toInt(left)
+		return err == nil && l == r
+	case bool:
+		l, err := strconv.ParseBool(toString(left))
+		return err == nil && l == r
+	}
+
+	switch l := left.(type) {
+	case int64, bool:
+		return equal(right, l)
+	}
+
+	return toString(left) == toString(right)
+}
+
+func toInt(value interface{}) (int64, error) {
+	if i, ok := value.(int64); ok {
+		return i, nil
+	}
+
+	return strconv.ParseInt(toString(value), 10, 64)
+}
+
+func toString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case bool:
+		if v {
+			return "true"
+		}
+		return "false"
+	}
+
+	return fmt.Sprint(value)
+}
+
+// likePattern converts a LIKE pattern to a regexp, % matching any run of characters and _ any single one, with \
+// escaping either
+func likePattern(pattern string) *regexp.Regexp {
+	expr := strings.Builder{}
+	expr.WriteString("^(?s:")
+
+	runes := []rune(pattern)
+	for i := 0; i < len(runes); i++ {
+		switch runes[i] {
+		case '%':
+			expr.WriteString(".*")
+		case '_':
+			expr.WriteString(".")
+		case '\\':
+			if i+1 < len(runes) {
+				i++
+			}
+			expr.WriteString(regexp.QuoteMeta(string(runes[i])))
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(runes[i])))
+		}
+	}
+
+	expr.WriteString(")$")
+
+	return regexp.MustCompile(expr.String())
+}
@@ -0,0 +1,30 @@
+package triggers
+
+import "ponglehub.co.uk/events/broker/internal/crds"
+
+// AnyBroker in a trigger's brokers opts it in to events from every namespaced broker
+const AnyBroker = "*"
+
+// Scope is the namespace a broker routes events within, or empty for a broker routing to every trigger in the
+// cluster. A namespaced broker routes to the triggers in its own namespace, and to triggers in other namespaces
+// which opt in by listing it in their brokers.
+type Scope string
+
+// Includes reports whether the broker routes events to the trigger
+func (s Scope) Includes(trigger *crds.EventTrigger) bool {
+	if trigger == nil {
+		return false
+	}
+
+	if s == "" || trigger.Namespace == string(s) {
+		return true
+	}
+
+	for _, broker := range trigger.Spec.Brokers {
+		if broker == string(s) || broker == AnyBroker {
+			return true
+		}
+	}
+
+	return false
+}
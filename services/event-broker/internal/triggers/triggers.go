@@ -0,0 +1,168 @@
+package triggers
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudevents/sdk-go/v2/event"
+	"github.com/cloudevents/sdk-go/v2/types"
+	"ponglehub.co.uk/events/broker/internal/crds"
+)
+
+// Trigger is where the events routed to a trigger go, if they match its attribute filter
+type Trigger struct {
+	URL    string
+	Filter Filter
+}
+
+// Triggers resolves the targets the router returns to urls. The broker routes events to triggers rather than
+// straight to urls, so that triggers sharing a url can filter on different attributes.
+type Triggers struct {
+	lock     sync.RWMutex
+	triggers map[string]Trigger
+}
+
+func New() *Triggers {
+	return &Triggers{
+		triggers: map[string]Trigger{},
+	}
+}
+
+// Key identifies a trigger as a router target
+func Key(namespace string, name string) string {
+	return namespace + "/" + name
+}
+
+func (t *Triggers) Set(key string, trigger Trigger) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.triggers[key] = trigger
+}
+
+func (t *Triggers) Remove(key string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	delete(t.triggers, key)
+}
+
+// Lookup returns the trigger for a router target, which is just a url when there aren't any triggers
+func (t *Triggers) Lookup(target string) (Trigger, bool) {
+	if t == nil {
+		return Trigger{URL: target}, true
+	}
+
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	trigger, ok := t.triggers[target]
+	return trigger, ok
+}
+
+// Resolve returns the url to send the event to for a router target, or false if the target is unknown or its
+// filter doesn't match. Without any triggers, targets are taken to be urls.
+func (t *Triggers) Resolve(target string, event event.Event) (string, bool) {
+	trigger, ok := t.Lookup(target)
+	if !ok || !trigger.Filter.Matches(event) {
+		return "", false
+	}
+
+	return trigger.URL, true
+}
+
+type condition func(event event.Event) bool
+
+// Filter matches events on their attributes, an empty filter matches every event
+type Filter []condition
+
+func (f Filter) Matches(event event.Event) bool {
+	for _, condition := range f {
+		if !condition(event) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// NewFilter compiles a trigger's attribute filters into a single filter, matching events which satisfy all of them
+func NewFilter(specs []crds.AttributeFilter) (Filter, error) {
+	filter := Filter{}
+
+	for _, spec := range specs {
+		for name, value := range spec.Exact {
+			filter = append(filter, attributeCondition(name, value, func(actual, value string) bool { return actual == value }))
+		}
+
+		for name, value := range spec.Prefix {
+			filter = append(filter, attributeCondition(name, value, strings.HasPrefix))
+		}
+
+		for name, value := range spec.Suffix {
+			filter = append(filter, attributeCondition(name, value, strings.HasSuffix))
+		}
+
+		if spec.CESQL != "" {
+			condition, err := ParseCESQL(spec.CESQL)
+			if err != nil {
+				return nil, fmt.Errorf("invalid cesql expression %q: %+v", spec.CESQL, err)
+			}
+
+			filter = append(filter, condition)
+		}
+	}
+
+	return filter, nil
+}
+
+func attributeCondition(name string, value string, match func(actual string, value string) bool) condition {
+	name = strings.ToLower(name)
+
+	return func(event event.Event) bool {
+		actual, ok := Attribute(event, name)
+		return ok && match(actual, value)
+	}
+}
+
+// Attribute reads a context attribute or extension from the event as a string, or false if it isn't set
+func Attribute(event event.Event, name string) (string, bool) {
+	var value string
+
+	switch name {
+	case "specversion":
+		value = event.SpecVersion()
+	case "id":
+		value = event.ID()
+	case "source":
+		value = event.Source()
+	case "type":
+		value = event.Type()
+	case "subject":
+		value = event.Subject()
+	case "datacontenttype":
+		value = event.DataContentType()
+	case "dataschema":
+		value = event.DataSchema()
+	case "time":
+		if !event.Time().IsZero() {
+			value = event.Time().Format(time.RFC3339Nano)
+		}
+	default:
+		extension, ok := event.Extensions()[name]
+		if !ok {
+			return "", false
+		}
+
+		formatted, err := types.Format(extension)
+		if err != nil {
+			return "", false
+		}
+
+		return formatted, true
+	}
+
+	return value, value != ""
+}
@@ -0,0 +1,169 @@
+package triggers
+
+import (
+	"testing"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/cloudevents/sdk-go/v2/event"
+	"github.com/stretchr/testify/assert"
+	"ponglehub.co.uk/events/broker/internal/crds"
+)
+
+func testEvent() event.Event {
+	event := cloudevents.NewEvent()
+	event.SetID("event-id")
+	event.SetType("naughts-and-crosses.mark")
+	event.SetSource("client")
+	event.SetExtension("userid", "bot-123")
+	event.SetExtension("moves", 4)
+	event.SetExtension("finished", false)
+
+	return event
+}
+
+func TestFilter(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		specs   []crds.AttributeFilter
+		matches bool
+	}{
+		{name: "no filters", matches: true},
+		{name: "exact", specs: []crds.AttributeFilter{{Exact: map[string]string{"source": "client"}}}, matches: true},
+		{name: "exact mismatch", specs: []crds.AttributeFilter{{Exact: map[string]string{"source": "server"}}}, matches: false},
+		{name: "exact extension", specs: []crds.AttributeFilter{{Exact: map[string]string{"moves": "4"}}}, matches: true},
+		{name: "missing attribute", specs: []crds.AttributeFilter{{Exact: map[string]string{"subject": ""}}}, matches: false},
+		{name: "prefix", specs: []crds.AttributeFilter{{Prefix: map[string]string{"userid": "bot-"}}}, matches: true},
+		{name: "suffix", specs: []crds.AttributeFilter{{Suffix: map[string]string{"type": ".move"}}}, matches: false},
+		{
+			name: "all must match",
+			specs: []crds.AttributeFilter{
+				{Exact: map[string]string{"source": "client"}, Prefix: map[string]string{"type": "naughts-and-crosses."}},
+				{Suffix: map[string]string{"userid": "-456"}},
+			},
+			matches: false,
+		},
+		{name: "cesql", specs: []crds.AttributeFilter{{CESQL: "source = 'client' AND userid LIKE 'bot-%'"}}, matches: true},
+	} {
+		t.Run(test.name, func(u *testing.T) {
+			filter, err := NewFilter(test.specs)
+			assert.NoError(u, err)
+			assert.Equal(u, test.matches, filter.Matches(testEvent()))
+		})
+	}
+}
+
+func TestCESQL(t *testing.T) {
+	for _, test := range []struct {
+		expression string
+		matches    bool
+	}{
+		{expression: "source = 'client'", matches: true},
+		{expression: `source = "client"`, matches: true},
+		{expression: "source != 'client'", matches: false},
+		{expression: "source <> 'server'", matches: true},
+		{expression: "SOURCE = 'client' and TYPE = 'naughts-and-crosses.mark'", matches: true},
+		{expression: "source = 'server' OR type LIKE 'naughts-and-crosses.%'", matches: true},
+		{expression: "NOT (source = 'server' OR userid = 'bot-123')", matches: false},
+		{expression: "userid LIKE 'bot-___'", matches: true},
+		{expression: "userid NOT LIKE 'bot-%'", matches: false},
+		{expression: "type LIKE 'naughts\\_and%'", matches: false},
+		{expression: "moves = 4", matches: true},
+		{expression: "moves > 3 AND moves <= 4", matches: true},
+		{expression: "moves < 4", matches: false},
+		{expression: "finished = FALSE", matches: true},
+		{expression: "source IN ('client', 'server')", matches: true},
+		{expression: "moves NOT IN (1, 2, 3)", matches: true},
+		{expression: "EXISTS userid", matches: true},
+		{expression: "EXISTS subject", matches: false},
+		{expression: "NOT EXISTS subject", matches: true},
+		{expression: "subject = 'game'", matches: false},
+		{expression: "NOT subject = 'game'", matches: false},
+		{expression: "NOT (subject = 'game')", matches: false},
+		{expression: "NOT (subject = 'game' AND source = 'server')", matches: true},
+		{expression: "NOT (subject = 'game' OR source = 'server')", matches: false},
+		{expression: "subject NOT IN ('game')", matches: false},
+		{expression: "subject = 'game' OR source = 'server'", matches: false},
+		{expression: "subject = 'game' OR type = 'naughts-and-crosses.mark'", matches: true},
+		{expression: "type = 'naughts-and-crosses.mark' AND subject IN ('game')", matches: false},
+		{expression: "subject LIKE 'game%' OR NOT EXISTS subject", matches: true},
+		{expression: "source < 4", matches: false},
+		{expression: "'it''s' = 'it''s'", matches: true},
+		{expression: "TRUE", matches: true},
+	} {
+		t.Run(test.expression, func(u *testing.T) {
+			condition, err := ParseCESQL(test.expression)
+			assert.NoError(u, err)
+			assert.Equal(u, test.matches, condition(testEvent()))
+		})
+	}
+}
+
+func TestCESQLErrors(t *testing.T) {
+	for _, expression := range []string{
+		"",
+		"source =",
+		"source = 'client",
+		"(source = 'client'",
+		"source = 'client')",
+		"source LIKE type",
+		"source IN 'client'",
+		"source ! 'client'",
+		"source = 'client' AND",
+	} {
+		t.Run(expression, func(u *testing.T) {
+			_, err := ParseCESQL(expression)
+			assert.Error(u, err)
+		})
+	}
+}
+
+func TestResolve(t *testing.T) {
+	filter, err := NewFilter([]crds.AttributeFilter{{Exact: map[string]string{"source": "server"}}})
+	assert.NoError(t, err)
+
+	triggers := New()
+	triggers.Set(Key("games", "audit"), Trigger{URL: "http://audit", Filter: filter})
+	triggers.Set(Key("games", "game"), Trigger{URL: "http://game"})
+
+	_, ok := triggers.Resolve(Key("games", "audit"), testEvent())
+	assert.False(t, ok)
+
+	url, ok := triggers.Resolve(Key("games", "game"), testEvent())
+	assert.True(t, ok)
+	assert.Equal(t, "http://game", url)
+
+	_, ok = triggers.Resolve(Key("games", "unknown"), testEvent())
+	assert.False(t, ok)
+
+	var none *Triggers
+	url, ok = none.Resolve("http://direct", testEvent())
+	assert.True(t, ok)
+	assert.Equal(t, "http://direct", url)
+}
+
+func TestScope(t *testing.T) {
+	trigger := func(namespace string, brokers ...string) *crds.EventTrigger {
+		trigger := &crds.EventTrigger{Spec: crds.EventTriggerSpec{Brokers: brokers}}
+		trigger.Namespace = namespace
+		return trigger
+	}
+
+	for _, test := range []struct {
+		name     string
+		scope    Scope
+		trigger  *crds.EventTrigger
+		includes bool
+	}{
+		{name: "cluster wide", scope: "", trigger: trigger("games"), includes: true},
+		{name: "same namespace", scope: "games", trigger: trigger("games"), includes: true},
+		{name: "other namespace", scope: "staging", trigger: trigger("games"), includes: false},
+		{name: "opted in", scope: "staging", trigger: trigger("games", "staging"), includes: true},
+		{name: "opted in elsewhere", scope: "staging", trigger: trigger("games", "testing"), includes: false},
+		{name: "any broker", scope: "staging", trigger: trigger("games", "*"), includes: true},
+		{name: "no trigger", scope: "", trigger: nil, includes: false},
+	} {
+		t.Run(test.name, func(u *testing.T) {
+			assert.Equal(u, test.includes, test.scope.Includes(test.trigger))
+		})
+	}
+}
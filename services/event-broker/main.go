@@ -1,21 +1,159 @@
 package main
 
 import (
+	"context"
 	"log"
+	nethttp "net/http"
 	"os"
 	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
+	"github.com/cloudevents/sdk-go/v2/event"
+	"github.com/cloudevents/sdk-go/v2/protocol/http"
+	"github.com/go-redis/redis/v8"
 	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/cache"
+	"ponglehub.co.uk/events/broker/internal/admin"
 	"ponglehub.co.uk/events/broker/internal/crds"
+	"ponglehub.co.uk/events/broker/internal/publishers"
+	"ponglehub.co.uk/events/broker/internal/queue"
 	"ponglehub.co.uk/events/broker/internal/router"
+	"ponglehub.co.uk/events/broker/internal/schemas"
 	"ponglehub.co.uk/events/broker/internal/server"
+	"ponglehub.co.uk/events/broker/internal/store"
+	"ponglehub.co.uk/events/broker/internal/subscribers"
+	"ponglehub.co.uk/events/broker/internal/triggers"
+	"ponglehub.co.uk/lib/events"
+	"ponglehub.co.uk/lib/postgres/pkg/connect"
 )
 
 func main() {
 	logrus.Infof("Starting operator...")
 
+	shutdownTracing, err := events.InitTracing(context.Background(), "event-broker")
+	if err != nil {
+		logrus.Fatalf("Failed to initialise tracing: %+v", err)
+	}
+	defer shutdownTracing(context.Background())
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	r := router.New()
+	t := triggers.New()
+	subs := subscribers.New()
+	clients := server.NewClients()
+	deliveries := admin.NewTracker(100)
+	collector := schemas.New()
+
+	var eventStore *store.Store
+	if _, ok := os.LookupEnv("POSTGRES_HOST"); ok {
+		cfg, err := connect.ConfigFromEnv()
+		if err != nil {
+			logrus.Fatalf("Failed to get postgres config: %+v", err)
+		}
+
+		eventStore, err = store.New(cfg)
+		if err != nil {
+			logrus.Fatalf("Failed to open event store: %+v", err)
+		}
+		defer eventStore.Stop()
+	}
+
+	// without a token the admin endpoints refuse every request, since they expose users' events
+	adminToken := ""
+	if tokenFile, ok := os.LookupEnv("ADMIN_TOKEN_FILE"); ok {
+		token, err := os.ReadFile(tokenFile)
+		if err != nil {
+			logrus.Fatalf("Failed to read admin token: %+v", err)
+		}
+
+		adminToken = strings.TrimSpace(string(token))
+	} else {
+		logrus.Warnf("ADMIN_TOKEN_FILE not set, the admin endpoints are disabled")
+	}
+
+	// the admin handler is served by the transport that replays use, so the transport is set once it's created
+	var transport *events.HTTPTransport
+	adminArgs := admin.HandlerArgs{
+		Token:      adminToken,
+		Router:     r,
+		Triggers:   t,
+		Deliveries: deliveries,
+		Replay: func(ctx context.Context, trigger string, event event.Event) error {
+			return server.Deliver(ctx, server.StartArgs{Transport: transport, Triggers: t, Subscribers: subs, Clients: clients, Deliveries: deliveries}, trigger, event)
+		},
+		Replays: admin.NewReplays(100),
+		Context: ctx,
+	}
+	if eventStore != nil {
+		adminArgs.Store = eventStore
+	}
+	adminHandler := admin.Handler(adminArgs)
+
+	// the admin endpoints get their own port, which the broker's service doesn't expose, so that they can only be
+	// reached with a port forward
+	adminPort, ok := os.LookupEnv("ADMIN_PORT")
+	if !ok {
+		adminPort = "8080"
+	}
+
+	adminServer := &nethttp.Server{
+		Addr:    ":" + adminPort,
+		Handler: adminHandler,
+	}
+
+	go func() {
+		if err := adminServer.ListenAndServe(); err != nil && err != nethttp.ErrServerClosed {
+			logrus.Fatalf("Error starting admin server: %+v", err)
+		}
+	}()
+
+	transport, err = events.NewHTTPTransport(events.HTTPTransportArgs{
+		// the broker sends to the same few subscribers over and over, so keep their connections open
+		MaxIdleConnsPerHost: 100,
+		ListenOptions:       []http.Option{http.WithGetHandlerFunc(getHandler(collector.Registry))},
+	})
+	if err != nil {
+		logrus.Fatalf("Failed to create event transport: %+v", err)
+	}
+
+	var deadLetter events.DeadLetterSink
+	if url, ok := os.LookupEnv("DEAD_LETTER_URL"); ok {
+		deadLetter, err = events.New(events.EventsArgs{
+			BrokerURL: url,
+			Source:    "event-broker",
+			Transport: transport,
+		})
+		if err != nil {
+			logrus.Fatalf("Failed to create dead letter client: %+v", err)
+		}
+	}
+
+	var q *queue.Queue
+	if redisUrl, ok := os.LookupEnv("REDIS_URL"); ok {
+		hostname, err := os.Hostname()
+		if err != nil {
+			logrus.Fatalf("Failed to get consumer name: %+v", err)
+		}
+
+		q = queue.New(redis.NewClient(&redis.Options{Addr: redisUrl}), queue.QueueArgs{
+			Consumer:      hostname,
+			MaxDeliveries: 100,
+			DeadLetter:    subs.DeadLetterSink(deadLetter),
+		})
+	}
+
+	subscribe := func(trigger string) {
+		q.Subscribe(ctx, trigger, subs.Get(trigger), func(ctx context.Context, event event.Event) error {
+			// the queue dead-letters events itself, once it has given up redelivering them
+			return server.Deliver(ctx, server.StartArgs{Transport: transport, Triggers: t, Subscribers: subs, Clients: clients, Deliveries: deliveries, SkipDeadLetter: true}, trigger, event)
+		})
+	}
 
 	crds.AddToScheme(scheme.Scheme)
 	crdClient, err := crds.New(&crds.ClientArgs{})
@@ -23,44 +161,222 @@ func main() {
 		logrus.Fatalf("Failed to start operator client: %+v", err)
 	}
 
-	_, crdStopper := crdClient.Listen(func(oldTrigger *crds.EventTrigger, newTrigger *crds.EventTrigger) {
+	// a namespaced broker still watches every trigger, since triggers in other namespaces can opt in to its events
+	scope := triggers.Scope(os.Getenv("BROKER_NAMESPACE"))
+	if scope != "" {
+		logrus.Infof("Routing events to triggers in %s", scope)
+	}
+
+	crdStore, crdStopper := crdClient.Listen(func(oldTrigger *crds.EventTrigger, newTrigger *crds.EventTrigger) {
+		if !scope.Includes(oldTrigger) {
+			oldTrigger = nil
+		}
+
+		if !scope.Includes(newTrigger) {
+			newTrigger = nil
+		}
+
+		if oldTrigger == nil && newTrigger == nil {
+			return
+		}
+
 		logrus.Infof("Detected trigger change")
 
 		if oldTrigger != nil {
+			key := triggers.Key(oldTrigger.Namespace, oldTrigger.Name)
+
+			collector.Remove(oldTrigger.Spec.URL)
+
+			// updated triggers keep their subscriber and queue consumer, so that their pending deliveries stay in
+			// order and their stats carry on
+			if newTrigger == nil {
+				subs.Remove(key)
+				clients.Remove(key)
+			}
+
+			if q != nil && !oldTrigger.Spec.Paused && (newTrigger == nil || newTrigger.Spec.Paused) {
+				q.Unsubscribe(key)
+			}
+
 			for _, filter := range oldTrigger.Spec.Filters {
-				if err := r.Remove(filter, oldTrigger.Spec.URL); err != nil {
-					logrus.Errorf("failed to remove %s -> %s: %+v", filter, oldTrigger.Spec.URL, err)
+				if err := r.Remove(filter, key); err != nil {
+					logrus.Errorf("failed to remove %s -> %s: %+v", filter, key, err)
 				} else {
-					logrus.Infof("removed %s -> %s", filter, oldTrigger.Spec.URL)
+					logrus.Infof("removed %s -> %s", filter, key)
 				}
 			}
+
+			if newTrigger == nil {
+				t.Remove(key)
+			}
 		}
 
 		if newTrigger != nil {
+			key := triggers.Key(newTrigger.Namespace, newTrigger.Name)
+
+			collector.Add(ctx, newTrigger.Spec.URL)
+
+			options, err := subscribers.FromSpec(newTrigger.Spec, transport)
+			if err != nil {
+				logrus.Errorf("invalid delivery options for %s/%s, using defaults: %+v", newTrigger.Namespace, newTrigger.Name, err)
+				options = subscribers.DefaultOptions
+			}
+			subs.Set(key, options)
+
+			if q != nil && !newTrigger.Spec.Paused {
+				subscribe(key)
+			}
+
+			filter, err := triggers.NewFilter(newTrigger.Spec.Attributes)
+			if err != nil {
+				// routing without the filter could send the subscriber events it isn't meant to see
+				logrus.Errorf("invalid attribute filter for %s, not routing any events to it: %+v", key, err)
+				t.Remove(key)
+				return
+			}
+			t.Set(key, triggers.Trigger{URL: newTrigger.Spec.URL, Filter: filter})
+
 			for _, filter := range newTrigger.Spec.Filters {
-				r.Add(filter, newTrigger.Spec.URL)
-				logrus.Infof("added %s -> %s", filter, newTrigger.Spec.URL)
+				r.Add(filter, key)
+				logrus.Infof("added %s -> %s (%s)", filter, key, newTrigger.Spec.URL)
 			}
 		}
 	})
 
-	serverStopper, err := server.Start(&r)
+	var pubs *publishers.Publishers
+	var publisherStopper chan<- struct{}
+	if keyDir, ok := os.LookupEnv("PUBLISHER_KEYS"); ok {
+		keys, err := publishers.LoadKeys(keyDir)
+		if err != nil {
+			logrus.Fatalf("Failed to load publisher keys: %+v", err)
+		}
+
+		pubs = publishers.New(keys)
+		publisherStopper = crdClient.ListenPublishers(func(oldPublisher *crds.EventPublisher, newPublisher *crds.EventPublisher) {
+			if newPublisher == nil {
+				pubs.Remove(oldPublisher.Name)
+				logrus.Infof("removed publisher %s", oldPublisher.Name)
+				return
+			}
+
+			if _, ok := keys[newPublisher.Name]; !ok {
+				logrus.Warnf("no key for publisher %s, its events will be rejected", newPublisher.Name)
+			}
+
+			pubs.Set(newPublisher.Name, newPublisher.Spec)
+			logrus.Infof("set publisher %s: sources %v, types %v", newPublisher.Name, newPublisher.Spec.Sources, newPublisher.Spec.Types)
+		})
+	}
+
+	go collector.Run(ctx, time.Minute)
+	go reportStatus(ctx, crdClient, crdStore, scope, subs, 10*time.Second)
+
+	args := server.StartArgs{
+		Transport:   transport,
+		Address:     ":80",
+		Router:      r,
+		Triggers:    t,
+		Subscribers: subs,
+		Clients:     clients,
+		Deliveries:  deliveries,
+		DeadLetter:  subs.DeadLetterSink(deadLetter),
+	}
+	if q != nil {
+		args.Queue = q
+	}
+	if eventStore != nil {
+		args.Store = eventStore
+	}
+	if pubs != nil {
+		args.Publishers = pubs
+	}
+
+	done, err := server.Start(ctx, args)
 	if err != nil {
 		logrus.Fatalf("Failed to listen for events: %+v", err)
 	}
 
 	logrus.Infof("Running...")
 
-	// Wait for interrupt signal to gracefully shutdown the server with
-	// a timeout of 5 seconds.
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, os.Interrupt)
-	<-quit
+	err = <-done
+	if err != nil {
+		logrus.Errorf("Event listener stopped unexpectedly: %+v", err)
+	}
 
 	log.Println("Shutdown Server...")
 
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := adminServer.Shutdown(shutdownCtx); err != nil {
+		logrus.Errorf("Failed to stop admin server: %+v", err)
+	}
+
 	crdStopper <- struct{}{}
-	serverStopper()
+	if publisherStopper != nil {
+		publisherStopper <- struct{}{}
+	}
 
 	log.Println("Stopped")
 }
+
+// reportStatus copies the delivery stats for each trigger onto its status, so that kubectl shows whether the
+// subscriber is healthy. Only the broker in a trigger's own namespace reports its status, so that brokers sharing a
+// trigger don't overwrite each other's stats.
+func reportStatus(ctx context.Context, client *crds.Client, store cache.Store, scope triggers.Scope, subs *subscribers.Subscribers, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		for _, obj := range store.List() {
+			trigger := obj.(*crds.EventTrigger)
+			if scope != "" && trigger.Namespace != string(scope) {
+				continue
+			}
+
+			stats := subs.Get(triggers.Key(trigger.Namespace, trigger.Name)).Stats()
+
+			if stats.Delivered == trigger.Status.Delivered && stats.Failed == trigger.Status.Failed && stats.LastError == trigger.Status.LastError {
+				continue
+			}
+
+			status := crds.EventTriggerStatus{
+				Delivered: stats.Delivered,
+				Failed:    stats.Failed,
+				LastError: stats.LastError,
+			}
+
+			if !stats.LastErrorTime.IsZero() {
+				lastErrorTime := metav1.NewTime(stats.LastErrorTime)
+				status.LastErrorTime = &lastErrorTime
+			}
+
+			err := client.UpdateStatus(trigger.Name, trigger.Namespace, status)
+			if err != nil {
+				logrus.Errorf("failed to update status of %s/%s: %+v", trigger.Namespace, trigger.Name, err)
+			}
+		}
+	}
+}
+
+// getHandler serves the schemas collected from subscribers for the frontends and prometheus metrics
+func getHandler(registry *events.Registry) nethttp.HandlerFunc {
+	metrics := events.MetricsHandler()
+
+	return func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		switch r.URL.Path {
+		case "/schemas":
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+			registry.ServeHTTP(w, r)
+		case "/metrics":
+			metrics.ServeHTTP(w, r)
+		default:
+			w.WriteHeader(nethttp.StatusNotFound)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/cloudevents/sdk-go/v2/event"
+)
+
+// Target is where the broker sends an event, the trigger it was routed to and that trigger's url
+type Target struct {
+	Trigger string `json:"trigger"`
+	URL     string `json:"url"`
+}
+
+// Route is an entry in the broker's routing table
+type Route struct {
+	Filter string `json:"filter"`
+	Target
+}
+
+// Delivery is an event being sent to a subscriber
+type Delivery struct {
+	EventID   string    `json:"eventId"`
+	EventType string    `json:"eventType"`
+	URL       string    `json:"url"`
+	Started   time.Time `json:"started"`
+}
+
+// Failure is a delivery the broker gave up on
+type Failure struct {
+	Delivery
+	Finished   time.Time `json:"finished"`
+	StatusCode int       `json:"statusCode,omitempty"`
+	Error      string    `json:"error"`
+}
+
+type Deliveries struct {
+	InFlight []Delivery `json:"inFlight"`
+	Failed   []Failure  `json:"failed"`
+}
+
+// Record is an event from the broker's event store
+type Record struct {
+	Seq      int64       `json:"seq"`
+	Received time.Time   `json:"received"`
+	Event    event.Event `json:"event"`
+}
+
+// EventQuery selects stored events received between From and To, or up until now if To is zero, which match the
+// CESQL expression in Filter
+type EventQuery struct {
+	From   time.Time
+	To     time.Time
+	Filter string
+}
+
+func (q EventQuery) values() url.Values {
+	values := url.Values{}
+	values.Set("from", q.From.Format(time.RFC3339Nano))
+	if !q.To.IsZero() {
+		values.Set("to", q.To.Format(time.RFC3339Nano))
+	}
+	if q.Filter != "" {
+		values.Set("filter", q.Filter)
+	}
+
+	return values
+}
+
+// Replay is the progress of replaying stored events to a trigger
+type Replay struct {
+	Replayed int `json:"replayed"`
+	Failed   int `json:"failed"`
+}
+
+const (
+	ReplayRunning  = "running"
+	ReplayFinished = "finished"
+	ReplayFailed   = "failed"
+)
+
+// ReplayJob is a replay running in the broker, which keeps going after the request that started it
+type ReplayJob struct {
+	ID      string    `json:"id"`
+	Trigger string    `json:"trigger"`
+	Status  string    `json:"status"`
+	Started time.Time `json:"started"`
+	// Error is why the replay stopped early, when its status is failed
+	Error string `json:"error,omitempty"`
+	Replay
+}
+
+// Client queries a broker's admin endpoints, authenticating with the broker's admin token
+type Client struct {
+	url    string
+	token  string
+	client *http.Client
+}
+
+func NewClient(brokerUrl string, token string) *Client {
+	return &Client{
+		url:    brokerUrl,
+		token:  token,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (c *Client) get(path string, query url.Values, result interface{}) error {
+	return c.do(http.MethodGet, path, query, result)
+}
+
+func (c *Client) do(method string, path string, query url.Values, result interface{}) error {
+	target := c.url + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequest(method, target, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %+v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+
+	res, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to query broker: %+v", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK && res.StatusCode != http.StatusAccepted {
+		return fmt.Errorf("failed to query broker, response code: %d", res.StatusCode)
+	}
+
+	err = json.NewDecoder(res.Body).Decode(result)
+	if err != nil {
+		return fmt.Errorf("failed to decode broker response: %+v", err)
+	}
+
+	return nil
+}
+
+func (c *Client) Routes() ([]Route, error) {
+	routes := []Route{}
+	err := c.get("/admin/routes", nil, &routes)
+
+	return routes, err
+}
+
+// TestRoute returns the targets an event would fan out to, given its type and any other attributes or extensions
+// that the triggers filter on
+func (c *Client) TestRoute(eventType string, attributes map[string]string) ([]Target, error) {
+	query := url.Values{}
+	for name, value := range attributes {
+		query.Set(name, value)
+	}
+	query.Set("type", eventType)
+
+	targets := []Target{}
+	err := c.get("/admin/routes/test", query, &targets)
+
+	return targets, err
+}
+
+func (c *Client) Deliveries() (Deliveries, error) {
+	deliveries := Deliveries{}
+	err := c.get("/admin/deliveries", nil, &deliveries)
+
+	return deliveries, err
+}
+
+// Events returns up to limit stored events matching the query, starting after the record with sequence number after
+func (c *Client) Events(query EventQuery, after int64, limit int) ([]Record, error) {
+	values := query.values()
+	values.Set("after", strconv.FormatInt(after, 10))
+	values.Set("limit", strconv.Itoa(limit))
+
+	records := []Record{}
+	err := c.get("/admin/events", values, &records)
+
+	return records, err
+}
+
+// Replay starts re-delivering the stored events matching the query to a trigger, given as namespace/name, returning
+// the job to poll with ReplayStatus. Only events that the trigger would be sent now, given its filters, are replayed.
+func (c *Client) Replay(trigger string, query EventQuery) (ReplayJob, error) {
+	values := query.values()
+	values.Set("trigger", trigger)
+
+	job := ReplayJob{}
+	err := c.do(http.MethodPost, "/admin/replay", values, &job)
+
+	return job, err
+}
+
+// ReplayStatus returns the progress of a replay started by Replay
+func (c *Client) ReplayStatus(id string) (ReplayJob, error) {
+	job := ReplayJob{}
+	err := c.get("/admin/replay", url.Values{"id": []string{id}}, &job)
+
+	return job, err
+}
@@ -358,9 +358,6 @@ func TestEventResponses(t *testing.T) {
 			} else {
 				assert.Equal(u, []byte{}, body)
 			}
-
-			messages := redisClient.GetResponses(u, user.ID)
-			assert.Equal(u, []string{}, messages)
 		})
 	}
 }
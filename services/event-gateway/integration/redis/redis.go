@@ -31,9 +31,14 @@ func (r *Redis) AddResponses(t *testing.T, id string, responses []interface{}) {
 	}
 
 	key := fmt.Sprintf("%s.responses", id)
-	err := r.client.RPush(context.Background(), key, responses...).Err()
-	if err != nil {
-		assert.FailNow(t, "failed to add responses", err)
+	for _, response := range responses {
+		err := r.client.XAdd(context.Background(), &redis.XAddArgs{
+			Stream: key,
+			Values: map[string]interface{}{"response": response},
+		}).Err()
+		if err != nil {
+			assert.FailNow(t, "failed to add responses", err)
+		}
 	}
 }
 
@@ -47,13 +52,16 @@ func (r *Redis) ClearResponses(t *testing.T, id string) {
 
 func (r *Redis) GetResponses(t *testing.T, id string) []string {
 	key := fmt.Sprintf("%s.responses", id)
-	values, err := r.client.LRange(context.Background(), key, 0, -1).Result()
-	if err == redis.Nil {
-		return nil
-	} else if err != nil {
+	messages, err := r.client.XRange(context.Background(), key, "-", "+").Result()
+	if err != nil {
 		assert.Fail(t, "failed to fetch responses:", err)
 	}
 
+	values := []string{}
+	for _, message := range messages {
+		values = append(values, message.Values["response"].(string))
+	}
+
 	return values
 }
 
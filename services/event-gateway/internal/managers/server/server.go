@@ -1,9 +1,13 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
+	"net/url"
+	"os"
 	"time"
 
 	cloudevents "github.com/cloudevents/sdk-go/v2"
@@ -11,18 +15,37 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"ponglehub.co.uk/events/gateway/internal/services/notifier"
 	"ponglehub.co.uk/events/gateway/internal/services/tokens"
 	"ponglehub.co.uk/events/gateway/internal/services/user_store"
 	"ponglehub.co.uk/events/gateway/pkg/crds"
 	"ponglehub.co.uk/lib/events"
 )
 
-func Start(brokerEnv string, domain string, origins []string, crdClient *crds.UserClient, store *user_store.Store, tokens *tokens.Tokens) func() {
+const (
+	// LoginExpiry is how long a login lasts before it has to be refreshed
+	LoginExpiry = time.Hour
+	// RefreshWindow is how long before their login expires that websocket clients are asked to refresh it
+	RefreshWindow = 5 * time.Minute
+	// SessionCheckInterval is how often websockets check that their session hasn't been revoked
+	SessionCheckInterval = time.Minute
+	// ResetExpiry is how long a password reset link can be used for
+	ResetExpiry = time.Hour
+)
+
+func Start(brokerEnv string, domain string, origins []string, crdClient *crds.UserClient, store *user_store.Store, tokens *tokens.Tokens, limits Limits, notifier notifier.Notifier, publicURL string) func() {
 	eventClient, err := events.New(events.EventsArgs{BrokerEnv: brokerEnv, Source: "event-gateway"})
 	if err != nil {
 		logrus.Fatalf("Failed to create broker client: %+v", err)
 	}
 
+	ctx, cancel := context.WithCancel(context.Background())
+
+	registry := events.NewRegistry()
+	go watchSchemas(ctx, os.Getenv(brokerEnv), registry)
+
 	engine := gin.Default()
 
 	allowedOrigins := []string{"http://ponglehub.co.uk"}
@@ -32,7 +55,7 @@ func Start(brokerEnv string, domain string, origins []string, crdClient *crds.Us
 
 	engine.Use(cors.New(cors.Config{
 		AllowOrigins: allowedOrigins,
-		AllowMethods: []string{"POST", "GET"},
+		AllowMethods: []string{"POST", "GET", "DELETE"},
 		AllowHeaders: []string{
 			"Origin", "Content-Type", "ce-dataschema",
 			"ce-id", "ce-source", "ce-specversion",
@@ -44,13 +67,22 @@ func Start(brokerEnv string, domain string, origins []string, crdClient *crds.Us
 
 	engine.LoadHTMLGlob("/html/*")
 
-	engine.GET("/events", eventsGetRoute(tokens, domain, store, crdClient, eventClient))
+	engine.GET("/metrics", gin.WrapH(events.MetricsHandler()))
+	engine.GET("/schemas", gin.WrapH(registry))
+	engine.GET("/events", eventsGetRoute(tokens, domain, store, crdClient, eventClient, registry, limits))
 	engine.GET("/auth/user", userRoute(tokens, domain, crdClient, store))
 	engine.GET("/auth/login", loginHTML)
 	engine.POST("/auth/login", loginRoute(store, tokens, domain))
 	engine.POST("/auth/logout", logoutRoute(tokens, domain))
+	engine.POST("/auth/refresh", refreshRoute(tokens, domain))
+	engine.GET("/auth/sessions", sessionsRoute(tokens, domain))
+	engine.DELETE("/auth/sessions/:session", revokeSessionRoute(tokens, domain))
 	engine.GET("/auth/set-password", setPasswordHTML)
 	engine.POST("/auth/set-password", setPasswordRoute(store, crdClient, tokens))
+	engine.GET("/auth/forgot-password", forgotPasswordHTML)
+	engine.POST("/auth/forgot-password", forgotPasswordRoute(store, tokens, notifier, publicURL))
+	engine.GET("/auth/reset-password", resetPasswordHTML)
+	engine.POST("/auth/reset-password", resetPasswordRoute(tokens))
 
 	server := &http.Server{
 		Addr:    "0.0.0.0:80",
@@ -65,6 +97,8 @@ func Start(brokerEnv string, domain string, origins []string, crdClient *crds.Us
 	}()
 
 	return func() {
+		cancel()
+
 		err := server.Close()
 		if err != nil {
 			logrus.Errorf("Error closing server: %+v", err)
@@ -72,22 +106,33 @@ func Start(brokerEnv string, domain string, origins []string, crdClient *crds.Us
 	}
 }
 
-func watchEvents(conn *websocket.Conn) (<-chan cloudevents.Event, <-chan struct{}) {
-	events := make(chan cloudevents.Event)
-	stopper := make(chan struct{})
+// watchEvents reads the client's events until the connection fails or goes idle, stopping the socket
+func watchEvents(sock *socket) <-chan cloudevents.Event {
+	incoming := make(chan cloudevents.Event)
+
+	sock.keepAlive()
+	sock.conn.SetPongHandler(func(string) error {
+		sock.keepAlive()
+		return nil
+	})
+
+	go func(incoming chan<- cloudevents.Event) {
+		defer sock.stop()
 
-	go func(events chan<- cloudevents.Event, stopper chan<- struct{}) {
 		for {
-			_, msg, err := conn.ReadMessage()
+			_, msg, err := sock.conn.ReadMessage()
 			if err != nil {
 				logrus.Warnf("Closing websocket connection: %+v", err)
-				stopper <- struct{}{}
 				return
 			}
 
+			sock.keepAlive()
+
 			type eventData struct {
-				EventType string                 `json:"type"`
-				EventData map[string]interface{} `json:"data"`
+				EventType     string                 `json:"type"`
+				EventData     map[string]interface{} `json:"data"`
+				CorrelationID string                 `json:"correlationId"`
+				PartitionKey  string                 `json:"partitionKey"`
 			}
 
 			var data eventData
@@ -102,20 +147,55 @@ func watchEvents(conn *websocket.Conn) (<-chan cloudevents.Event, <-chan struct{
 			event.SetType(data.EventType)
 			event.SetSource("client")
 
+			if data.CorrelationID != "" {
+				event.SetExtension(events.CorrelationIDExtension, data.CorrelationID)
+			}
+
+			if data.PartitionKey != "" {
+				event.SetExtension(events.PartitionKeyExtension, data.PartitionKey)
+			}
+
 			err = event.SetData(cloudevents.ApplicationJSON, data.EventData)
 			if err != nil {
 				logrus.Errorf("Failed to serialize event data: %+v", err)
 				continue
 			}
 
-			events <- event
+			select {
+			case incoming <- event:
+			case <-sock.stopped():
+				return
+			}
 		}
-	}(events, stopper)
+	}(incoming)
 
-	return events, stopper
+	return incoming
 }
 
-func eventsGetRoute(tokens *tokens.Tokens, domain string, store *user_store.Store, crdClient *crds.UserClient, client *events.Events) func(c *gin.Context) {
+// watchSchemas keeps the registry up to date with the schemas the broker has collected from its subscribers
+func watchSchemas(ctx context.Context, brokerUrl string, registry *events.Registry) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		schemas, err := events.FetchSchemas(ctx, brokerUrl)
+		if err != nil {
+			logrus.Warnf("Failed to refresh event schemas: %+v", err)
+		} else {
+			registry.Set("broker", schemas)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func eventsGetRoute(tokens *tokens.Tokens, domain string, store *user_store.Store, crdClient *crds.UserClient, client *events.Events, registry *events.Registry, limits Limits) func(c *gin.Context) {
+	open := newConnections(limits)
+
 	var wsupgrader = websocket.Upgrader{
 		ReadBufferSize:  1024,
 		WriteBufferSize: 1024,
@@ -123,10 +203,11 @@ func eventsGetRoute(tokens *tokens.Tokens, domain string, store *user_store.Stor
 	}
 
 	return func(c *gin.Context) {
-		subject, err := loggedIn(c, tokens, domain)
+		claims, err := loggedIn(c, tokens, domain)
 		if err != nil {
 			return
 		}
+		subject := claims.Subject
 
 		name, ok := store.GetName(subject)
 		if !ok {
@@ -140,12 +221,23 @@ func eventsGetRoute(tokens *tokens.Tokens, domain string, store *user_store.Stor
 			return
 		}
 
+		status, ok := open.acquire(subject)
+		if !ok {
+			logrus.Warnf("Refusing websocket connection for %s: too many connections", subject)
+			c.Status(status)
+			return
+		}
+		defer open.release(subject)
+
 		conn, err := wsupgrader.Upgrade(c.Writer, c.Request, nil)
 		if err != nil {
 			logrus.Errorf("Failed to set websocket upgrade: %+v", err)
 			return
 		}
 
+		sock := newSocket(conn, limits)
+		defer sock.stop()
+
 		whoamiResponse, err := json.Marshal(map[string]interface{}{
 			"type": "auth.whoami.response",
 			"data": map[string]interface{}{
@@ -157,28 +249,92 @@ func eventsGetRoute(tokens *tokens.Tokens, domain string, store *user_store.Stor
 			logrus.Errorf("Error serialising whoami response: %+v", err)
 			return
 		}
-		conn.WriteMessage(websocket.TextMessage, whoamiResponse)
+		sock.send(whoamiResponse)
 
-		responses, stopper, err := tokens.WatchResponses(subject)
+		// a reconnecting client sends the cursor of the last response it saw, to be sent the ones it missed
+		watching, stopWatching := context.WithCancel(context.Background())
+		defer stopWatching()
+
+		responses, err := tokens.WatchResponses(watching, subject, c.Query("cursor"))
 		if err != nil {
 			logrus.Errorf("Failed to watch responses: %+v", err)
 			return
 		}
 
-		events, stopped := watchEvents(conn)
+		incoming := watchEvents(sock)
+
+		// the client is asked to refresh its login shortly before it expires, and disconnected if it doesn't or its
+		// session is revoked
+		expires := claims.Expires
+		expiring := time.NewTimer(time.Until(expires.Add(-RefreshWindow)))
+		defer expiring.Stop()
+		expired := time.NewTimer(time.Until(expires))
+		defer expired.Stop()
+		checking := time.NewTicker(SessionCheckInterval)
+		defer checking.Stop()
+
+		refreshed := func() bool {
+			latest, err := tokens.LoginExpiry(subject, claims.Session)
+			if err != nil {
+				logrus.Errorf("Failed to check login expiry for %s: %+v", subject, err)
+				return false
+			}
+
+			if !latest.After(expires) {
+				return false
+			}
+
+			expires = latest
+			expiring.Reset(time.Until(expires.Add(-RefreshWindow)))
+			expired.Reset(time.Until(expires))
+			return true
+		}
 
 		for {
 			select {
-			case <-stopped:
-				stopper <- struct{}{}
+			case <-sock.stopped():
 				return
-			case response := <-responses:
+			case <-expiring.C:
+				if refreshed() {
+					continue
+				}
+
+				message, err := json.Marshal(map[string]interface{}{
+					"type": "auth.session.expiring",
+					"data": map[string]interface{}{"expires": expires.Unix()},
+				})
+				if err != nil {
+					logrus.Errorf("Error serialising session expiring message: %+v", err)
+					continue
+				}
+
+				sock.send(message)
+			case <-checking.C:
+				latest, err := tokens.LoginExpiry(subject, claims.Session)
+				if err == nil && latest.IsZero() {
+					logrus.Infof("Closing websocket connection for %s: session revoked", subject)
+					return
+				}
+			case <-expired.C:
+				if !refreshed() {
+					logrus.Infof("Closing websocket connection for %s: login expired", subject)
+					return
+				}
+			case response, ok := <-responses:
+				if !ok {
+					return
+				}
+
 				logrus.Infof("sending response to %s", subject)
-				err = conn.WriteMessage(websocket.TextMessage, []byte(response))
+
+				payload, err := withCursor(response)
 				if err != nil {
-					logrus.Errorf("Error return response: %+v", err)
+					logrus.Errorf("Error adding cursor to response: %+v", err)
+					continue
 				}
-			case event := <-events:
+
+				sock.send(payload)
+			case event := <-incoming:
 				switch event.Type() {
 				case "auth.list-friends":
 					logrus.Infof("listing friends for: %s", subject)
@@ -195,111 +351,138 @@ func eventsGetRoute(tokens *tokens.Tokens, domain string, store *user_store.Stor
 					}
 
 					response, err := json.Marshal(map[string]interface{}{
-						"type": "auth.list-friends.response",
-						"data": friendData,
+						"type":          "auth.list-friends.response",
+						"data":          friendData,
+						"correlationId": events.CorrelationID(event),
 					})
 					if err != nil {
 						logrus.Errorf("Error serialising list-friends response: %+v", err)
 						continue
 					}
 
-					err = conn.WriteMessage(websocket.TextMessage, response)
-					if err != nil {
-						logrus.Errorf("Error returning list-friends response: %+v", err)
-					}
+					sock.send(response)
 
 				default:
 					logrus.Infof("passing through event: %s", event.Type())
 
+					err = registry.Validate(event.Type(), event.Data())
+					if err != nil {
+						logrus.Warnf("Rejecting invalid %s from %s: %+v", event.Type(), subject, err)
+
+						response, err := json.Marshal(map[string]interface{}{
+							"type":          event.Type() + ".rejection.response",
+							"data":          map[string]interface{}{"reason": "invalid payload: " + err.Error()},
+							"correlationId": events.CorrelationID(event),
+						})
+						if err != nil {
+							logrus.Errorf("Error serialising rejection response: %+v", err)
+							continue
+						}
+
+						sock.send(response)
+
+						continue
+					}
+
 					event.SetExtension("userid", subject)
-					err = client.Proxy(event)
+
+					// without a key from the client, a user's events are at least delivered in the order they sent them
+					if events.PartitionKey(event) == "" {
+						event.SetExtension(events.PartitionKeyExtension, subject)
+					}
+
+					ctx, span := events.StartSpan(
+						context.Background(),
+						"gateway "+event.Type(),
+						trace.WithNewRoot(),
+						trace.WithSpanKind(trace.SpanKindServer),
+						trace.WithAttributes(attribute.String("user.id", subject)),
+					)
+
+					err = client.ProxyContext(ctx, event)
 					if err != nil {
 						logrus.Errorf("Error proxying event to broker: %+v", err)
+						span.RecordError(err)
 					}
+
+					span.End()
 				}
 			}
 		}
 	}
 }
 
-func loggedIn(c *gin.Context, tokens *tokens.Tokens, domain string) (string, error) {
+// withCursor adds the response's cursor to its payload, for the client to resume from if it reconnects
+func withCursor(response tokens.Response) ([]byte, error) {
+	payload := map[string]interface{}{}
+	err := json.Unmarshal([]byte(response.Payload), &payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode response: %+v", err)
+	}
+
+	payload["cursor"] = response.Cursor
+
+	return json.Marshal(payload)
+}
+
+func loggedIn(c *gin.Context, tokens *tokens.Tokens, domain string) (claims tokens.Claims, err error) {
 	token, err := c.Cookie("ponglehub.login")
 	if err == http.ErrNoCookie {
 		logrus.Errorf("No cookie provided: %+v", err)
 		c.Status(http.StatusUnauthorized)
-		return "", err
+		return claims, err
 	}
 
 	if err != nil {
 		logrus.Errorf("Error getting cookie: %+v", err)
 		c.Status(http.StatusInternalServerError)
-		return "", err
+		return claims, err
 	}
 
-	claims, err := tokens.Parse(token)
+	claims, err = tokens.Parse(token)
 	if err != nil {
 		logrus.Errorf("Error parsing cookie: %+v", err)
 		c.Status(http.StatusUnauthorized)
-		return "", err
+		return claims, err
 	}
 
 	if claims.Kind != "login" {
 		logrus.Errorf("Accessed with non login cookie: %s", claims.Kind)
 		c.SetCookie("ponglehub.login", "", 0, "/", domain, false, true)
 		c.Status(http.StatusUnauthorized)
-		return "", errors.New("something")
+		return claims, errors.New("something")
 	}
 
-	return claims.Subject, nil
-}
-
-func userRoute(tokens *tokens.Tokens, domain string, users *crds.UserClient, store *user_store.Store) func(c *gin.Context) {
-	return func(c *gin.Context) {
-		token, err := c.Cookie("ponglehub.login")
-		if err == http.ErrNoCookie {
-			logrus.Errorf("No cookie found")
-			c.Status(http.StatusUnauthorized)
-			return
-		}
+	// the token is only valid while it's still the session's current login token, so that revoked sessions and
+	// replaced tokens are logged out straight away rather than once they expire
+	current, err := tokens.GetLoginToken(claims.Subject, claims.Session)
+	if err != nil {
+		logrus.Errorf("Failed to fetch login token: %+v", err)
+		c.Status(http.StatusInternalServerError)
+		return claims, err
+	}
 
-		if err != nil {
-			logrus.Errorf("Error getting cookie: %+v", err)
-			c.Status(http.StatusInternalServerError)
-			return
-		}
+	if current == "" {
+		logrus.Errorf("Login token expired or revoked: %s", claims.Subject)
+		c.SetCookie("ponglehub.login", "", 0, "/", domain, false, true)
+		c.Status(http.StatusUnauthorized)
+		return claims, errors.New("session not active")
+	}
 
-		claims, err := tokens.Parse(token)
-		if err != nil {
-			logrus.Errorf("Error parsing cookie: %+v", err)
-			c.Status(http.StatusUnauthorized)
-			return
-		}
+	if current != token {
+		logrus.Errorf("Login token doesn't match latest: %s", claims.Subject)
+		c.SetCookie("ponglehub.login", "", 0, "/", domain, false, true)
+		c.Status(http.StatusUnauthorized)
+		return claims, errors.New("login token replaced")
+	}
 
-		if claims.Kind != "login" {
-			logrus.Errorf("Accessed with non login cookie: %s", claims.Kind)
-			c.SetCookie("ponglehub.login", "", 0, "/", domain, false, true)
-			c.Status(http.StatusUnauthorized)
-			return
-		}
+	return claims, nil
+}
 
-		t, err := tokens.GetToken(claims.Subject, "login")
+func userRoute(tokens *tokens.Tokens, domain string, users *crds.UserClient, store *user_store.Store) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		claims, err := loggedIn(c, tokens, domain)
 		if err != nil {
-			logrus.Errorf("Failed to fetch invite token: %+v", err)
-			c.Status(http.StatusInternalServerError)
-			return
-		}
-
-		if t == "" {
-			logrus.Errorf("Invite token expired: %s", claims.Subject)
-			c.SetCookie("ponglehub.login", "", 0, "/", domain, false, true)
-			c.Status(http.StatusUnauthorized)
-			return
-		}
-
-		if t != token {
-			logrus.Errorf("Login token doesn't match latest: %s", claims.Subject)
-			c.SetCookie("ponglehub.login", "", 0, "/", domain, false, true)
-			c.Status(http.StatusUnauthorized)
 			return
 		}
 
@@ -385,76 +568,196 @@ func loginRoute(store *user_store.Store, tokens *tokens.Tokens, domain string) f
 			return
 		}
 
-		token, err := tokens.NewToken(id, "login", 1*time.Hour)
+		session, refresh, err := tokens.NewSession(id, c.Request.UserAgent())
+		if err != nil {
+			logrus.Errorf("Failed creating session for user %s: %+v", body.Email, err)
+			c.Status(http.StatusInternalServerError)
+			return
+		}
+
+		_, err = startSession(c, tokens, domain, id, session.ID, refresh)
 		if err != nil {
 			logrus.Errorf("Failed creating token for user %s: %+v", body.Email, err)
 			c.Status(http.StatusInternalServerError)
 			return
 		}
 
-		c.SetCookie("ponglehub.login", token, 6400, "/", domain, false, true)
 		c.Redirect(http.StatusFound, body.Redirect)
 	}
 }
 
 func logoutRoute(tokens *tokens.Tokens, domain string) func(c *gin.Context) {
 	return func(c *gin.Context) {
-		token, err := c.Cookie("ponglehub.login")
+		claims, err := loggedIn(c, tokens, domain)
+		if err != nil {
+			return
+		}
+
+		err = tokens.RevokeSession(claims.Subject, claims.Session)
+		if err != nil {
+			logrus.Errorf("Failed revoking session for user %s: %+v", claims.Subject, err)
+			c.Status(http.StatusInternalServerError)
+			return
+		}
+
+		clearSession(c, domain)
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// refreshRoute swaps the refresh cookie for a new login and refresh token, so that active users stay logged in
+func refreshRoute(tokens *tokens.Tokens, domain string) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		token, err := c.Cookie("ponglehub.refresh")
 		if err == http.ErrNoCookie {
-			logrus.Errorf("No cookie found")
+			logrus.Errorf("No refresh cookie found")
 			c.Status(http.StatusUnauthorized)
 			return
 		}
 
 		if err != nil {
-			logrus.Errorf("Error getting cookie: %+v", err)
+			logrus.Errorf("Error getting refresh cookie: %+v", err)
 			c.Status(http.StatusInternalServerError)
 			return
 		}
 
-		claims, err := tokens.Parse(token)
-		if err != nil {
-			logrus.Errorf("Error parsing cookie: %+v", err)
+		claims, refresh, raced, err := tokens.Refresh(token)
+		if refreshReused(err) {
+			logrus.Warnf("Refresh token reused for user %s, revoked session %s", claims.Subject, claims.Session)
+			clearSession(c, domain)
 			c.Status(http.StatusUnauthorized)
 			return
 		}
 
-		if claims.Kind != "login" {
-			logrus.Errorf("Accessed with non login cookie: %s", claims.Kind)
-			c.SetCookie("ponglehub.login", "", 0, "/", domain, false, true)
+		if refreshInvalid(err) {
+			logrus.Errorf("Invalid refresh token: %+v", err)
+			clearSession(c, domain)
 			c.Status(http.StatusUnauthorized)
 			return
 		}
 
-		t, err := tokens.GetToken(claims.Subject, "login")
 		if err != nil {
-			logrus.Errorf("Failed to fetch invite token: %+v", err)
+			logrus.Errorf("Failed refreshing token: %+v", err)
 			c.Status(http.StatusInternalServerError)
 			return
 		}
 
-		if t == "" {
-			logrus.Errorf("Invite token expired: %s", claims.Subject)
-			c.SetCookie("ponglehub.login", "", 0, "/", domain, false, true)
-			c.Status(http.StatusUnauthorized)
+		var expires time.Time
+		if raced {
+			// another tab has just refreshed the same session, so share its login token rather than replacing it
+			expires, err = resumeSession(c, tokens, domain, claims.Subject, claims.Session, refresh)
+		} else {
+			expires, err = startSession(c, tokens, domain, claims.Subject, claims.Session, refresh)
+		}
+		if err != nil {
+			logrus.Errorf("Failed creating token for user %s: %+v", claims.Subject, err)
+			c.Status(http.StatusInternalServerError)
 			return
 		}
 
-		if t != token {
-			logrus.Errorf("Login token doesn't match latest: %s", claims.Subject)
-			c.SetCookie("ponglehub.login", "", 0, "/", domain, false, true)
-			c.Status(http.StatusUnauthorized)
+		c.JSON(http.StatusOK, gin.H{"expires": expires.Unix()})
+	}
+}
+
+func refreshReused(err error) bool {
+	return errors.Is(err, tokens.ErrRefreshReused)
+}
+
+func refreshInvalid(err error) bool {
+	return errors.Is(err, tokens.ErrRefreshInvalid)
+}
+
+// startSession logs the session in with a new login token, alongside the refresh token that renews it
+func startSession(c *gin.Context, t *tokens.Tokens, domain string, id string, session string, refresh string) (time.Time, error) {
+	login, err := t.NewLoginToken(id, session, LoginExpiry)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	c.SetCookie("ponglehub.login", login, int(LoginExpiry.Seconds()), "/", domain, false, true)
+	c.SetCookie("ponglehub.refresh", refresh, int(tokens.RefreshExpiry.Seconds()), "/auth", domain, false, true)
+
+	return time.Now().Add(LoginExpiry), nil
+}
+
+// resumeSession sets the session's current login token alongside the refresh token, starting a new one if it's expired
+func resumeSession(c *gin.Context, t *tokens.Tokens, domain string, id string, session string, refresh string) (time.Time, error) {
+	login, err := t.GetLoginToken(id, session)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	expires, err := t.LoginExpiry(id, session)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if login == "" || time.Until(expires) < time.Second {
+		return startSession(c, t, domain, id, session, refresh)
+	}
+
+	c.SetCookie("ponglehub.login", login, int(time.Until(expires).Seconds()), "/", domain, false, true)
+	c.SetCookie("ponglehub.refresh", refresh, int(tokens.RefreshExpiry.Seconds()), "/auth", domain, false, true)
+
+	return expires, nil
+}
+
+func clearSession(c *gin.Context, domain string) {
+	c.SetCookie("ponglehub.login", "", 0, "/", domain, false, true)
+	c.SetCookie("ponglehub.refresh", "", 0, "/auth", domain, false, true)
+}
+
+// sessionsRoute lists the user's sessions on each of their devices
+func sessionsRoute(tokens *tokens.Tokens, domain string) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		claims, err := loggedIn(c, tokens, domain)
+		if err != nil {
 			return
 		}
 
-		err = tokens.DeleteToken(claims.Subject, "login")
+		sessions, err := tokens.Sessions(claims.Subject)
 		if err != nil {
-			logrus.Errorf("Failed revoking token for user %s: %+v", claims.Subject, err)
+			logrus.Errorf("Failed to list sessions for user %s: %+v", claims.Subject, err)
 			c.Status(http.StatusInternalServerError)
 			return
 		}
 
-		c.SetCookie("ponglehub.login", "", 0, "/", domain, false, true)
+		response := []gin.H{}
+		for _, session := range sessions {
+			response = append(response, gin.H{
+				"id":       session.ID,
+				"device":   session.Device,
+				"created":  session.Created,
+				"lastSeen": session.LastSeen,
+				"current":  session.ID == claims.Session,
+			})
+		}
+
+		c.JSON(http.StatusOK, gin.H{"sessions": response})
+	}
+}
+
+// revokeSessionRoute logs one of the user's sessions out, e.g. on a lost phone
+func revokeSessionRoute(tokens *tokens.Tokens, domain string) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		claims, err := loggedIn(c, tokens, domain)
+		if err != nil {
+			return
+		}
+
+		session := c.Param("session")
+
+		err = tokens.RevokeSession(claims.Subject, session)
+		if err != nil {
+			logrus.Errorf("Failed revoking session for user %s: %+v", claims.Subject, err)
+			c.Status(http.StatusInternalServerError)
+			return
+		}
+
+		if session == claims.Session {
+			clearSession(c, domain)
+		}
+
 		c.Status(http.StatusNoContent)
 	}
 }
@@ -566,3 +869,153 @@ func setPasswordRoute(store *user_store.Store, crdClient *crds.UserClient, token
 		}
 	}
 }
+
+func forgotPasswordHTML(c *gin.Context) {
+	c.HTML(http.StatusOK, "forgot-password.tmpl", gin.H{})
+}
+
+type forgotPasswordBody struct {
+	Email string `json:"email" form:"email" binding:"required"`
+}
+
+// forgotPasswordRoute sends members a link to reset their password, responding the same whether or not the email
+// belongs to anyone so that it can't be used to find out who has an account
+func forgotPasswordRoute(store *user_store.Store, tokens *tokens.Tokens, notifier notifier.Notifier, publicURL string) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		body := forgotPasswordBody{}
+		c.Bind(&body)
+
+		if body.Email == "" {
+			logrus.Errorf("Missing forgot password params")
+			c.JSON(http.StatusBadRequest, gin.H{"failure": "bad input"})
+			return
+		}
+
+		// sent in the background, so that the response takes as long whether or not the user exists
+		go sendResetLink(store, tokens, notifier, publicURL, body.Email)
+
+		c.HTML(http.StatusOK, "forgot-password.tmpl", gin.H{"sent": true})
+	}
+}
+
+func sendResetLink(store *user_store.Store, tokens *tokens.Tokens, notifier notifier.Notifier, publicURL string, email string) {
+	id, ok := store.GetID(email)
+	if !ok {
+		logrus.Warnf("Password reset requested for unknown user: %s", email)
+		return
+	}
+
+	// invited users set their first password with their invite instead
+	password, err := tokens.GetToken(id, "password")
+	if err != nil {
+		logrus.Errorf("Failed to fetch password: %+v", err)
+		return
+	}
+
+	if password == "" {
+		logrus.Warnf("Password reset requested for user without a password: %s", email)
+		return
+	}
+
+	token, err := tokens.NewToken(id, "reset", ResetExpiry)
+	if err != nil {
+		logrus.Errorf("Failed creating reset token for user %s: %+v", email, err)
+		return
+	}
+
+	link := fmt.Sprintf("%s/auth/reset-password?token=%s", publicURL, url.QueryEscape(token))
+	message := fmt.Sprintf(
+		"Someone asked to reset your Ponglehub password. If it was you, follow this link within %d minutes:\n\n%s\n\nOtherwise you can ignore this message.",
+		int(ResetExpiry.Minutes()),
+		link,
+	)
+
+	err = notifier.Notify(email, "Reset your Ponglehub password", message)
+	if err != nil {
+		logrus.Errorf("Failed sending reset link to user %s: %+v", email, err)
+		return
+	}
+
+	logrus.Infof("Sent password reset link to user %s", email)
+}
+
+func resetPasswordHTML(c *gin.Context) {
+	token, ok := c.GetQuery("token")
+	if !ok {
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	c.HTML(http.StatusOK, "reset-password.tmpl", gin.H{
+		"token": token,
+	})
+}
+
+type resetPasswordBody struct {
+	Token    string `json:"token" form:"token" binding:"required"`
+	Password string `json:"password" form:"password" binding:"required"`
+	Confirm  string `json:"confirm" form:"confirm" binding:"required"`
+}
+
+// resetPasswordRoute sets a new password with a reset token, which can only be used once, and logs the user out of
+// all their sessions
+func resetPasswordRoute(tokens *tokens.Tokens) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		body := resetPasswordBody{}
+		c.Bind(&body)
+
+		if body.Token == "" || body.Password == "" || body.Confirm == "" {
+			logrus.Errorf("Missing reset password params")
+			c.JSON(http.StatusBadRequest, gin.H{"failure": "bad input"})
+			return
+		}
+
+		if body.Password != body.Confirm {
+			logrus.Errorf("Mismatched password and confirmation")
+			c.JSON(http.StatusBadRequest, gin.H{"failure": "passwords"})
+			return
+		}
+
+		claims, err := tokens.Parse(body.Token)
+		if err != nil {
+			logrus.Errorf("Failed to parse reset token: %+v", err)
+			c.JSON(http.StatusUnauthorized, gin.H{"failure": "token"})
+			return
+		}
+
+		if claims.Kind != "reset" {
+			logrus.Errorf("Tried to reset password without a reset token: %s", claims.Kind)
+			c.Status(http.StatusUnauthorized)
+			return
+		}
+
+		ok, err := tokens.ConsumeToken(claims.Subject, "reset", body.Token)
+		if err != nil {
+			logrus.Errorf("Failed to use reset token: %+v", err)
+			c.Status(http.StatusInternalServerError)
+			return
+		}
+
+		if !ok {
+			logrus.Errorf("Reset token expired, used or replaced: %s", claims.Subject)
+			c.JSON(http.StatusUnauthorized, gin.H{"failure": "token"})
+			return
+		}
+
+		err = tokens.AddPasswordHash(claims.Subject, body.Password)
+		if err != nil {
+			logrus.Errorf("Failed to hash password: %+v", err)
+			c.Status(http.StatusInternalServerError)
+			return
+		}
+
+		logrus.Infof("Password reset for user %s", claims.Subject)
+
+		err = tokens.RevokeSessions(claims.Subject)
+		if err != nil {
+			logrus.Errorf("Failed to revoke sessions after resetting password: %+v", err)
+		}
+
+		c.HTML(http.StatusOK, "reset-password.tmpl", gin.H{"done": true})
+	}
+}
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"ponglehub.co.uk/events/gateway/internal/services/tokens"
+)
+
+func newTokens(t *testing.T) *tokens.Tokens {
+	keyfile := filepath.Join(t.TempDir(), "key")
+	assert.NoError(t, os.WriteFile(keyfile, []byte("secret"), 0600))
+
+	server := miniredis.RunT(t)
+	tokens, err := tokens.New(keyfile, server.Addr())
+	assert.NoError(t, err)
+
+	return tokens
+}
+
+func login(t *testing.T, tokens *tokens.Tokens, device string) (string, string) {
+	session, _, err := tokens.NewSession("user", device)
+	assert.NoError(t, err)
+
+	token, err := tokens.NewLoginToken("user", session.ID, time.Hour)
+	assert.NoError(t, err)
+
+	return session.ID, token
+}
+
+func TestRevokedSession(t *testing.T) {
+	logrus.SetOutput(io.Discard)
+	gin.SetMode(gin.TestMode)
+
+	tokens := newTokens(t)
+	phone, phoneToken := login(t, tokens, "phone")
+	laptop, laptopToken := login(t, tokens, "laptop")
+
+	engine := gin.New()
+	engine.GET("/auth/sessions", sessionsRoute(tokens, "localhost"))
+	engine.DELETE("/auth/sessions/:session", revokeSessionRoute(tokens, "localhost"))
+
+	request := func(method string, path string, token string) int {
+		req := httptest.NewRequest(method, path, nil)
+		req.AddCookie(&http.Cookie{Name: "ponglehub.login", Value: token})
+
+		res := httptest.NewRecorder()
+		engine.ServeHTTP(res, req)
+
+		return res.Code
+	}
+
+	assert.Equal(t, http.StatusOK, request(http.MethodGet, "/auth/sessions", phoneToken))
+	assert.Equal(t, http.StatusNoContent, request(http.MethodDelete, "/auth/sessions/"+phone, laptopToken))
+
+	// the phone's token is still a valid jwt, but its session is gone
+	assert.Equal(t, http.StatusUnauthorized, request(http.MethodGet, "/auth/sessions", phoneToken))
+	assert.Equal(t, http.StatusUnauthorized, request(http.MethodDelete, "/auth/sessions/"+laptop, phoneToken))
+
+	current, err := tokens.GetLoginToken("user", laptop)
+	assert.NoError(t, err)
+	assert.Equal(t, laptopToken, current, "the revoked session can't log the others out")
+}
@@ -0,0 +1,216 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/sirupsen/logrus"
+)
+
+// Limits bound the gateway's websocket connections, so that dead and slow clients are dropped
+type Limits struct {
+	// PingInterval is how often clients are pinged to keep their connections alive
+	PingInterval time.Duration
+	// IdleTimeout closes connections which haven't answered a ping or sent anything for this long
+	IdleTimeout time.Duration
+	// WriteTimeout closes connections which take longer than this to accept a message
+	WriteTimeout time.Duration
+	// SendBuffer is how many messages can queue for a client before it's disconnected as too slow
+	SendBuffer int
+	// MaxPerUser caps each user's connections, and MaxConnections the gateway's, zero meaning no limit
+	MaxPerUser     int
+	MaxConnections int
+}
+
+var DefaultLimits = Limits{
+	PingInterval:   30 * time.Second,
+	IdleTimeout:    60 * time.Second,
+	WriteTimeout:   10 * time.Second,
+	SendBuffer:     64,
+	MaxPerUser:     5,
+	MaxConnections: 10000,
+}
+
+// LimitsFromEnv overrides the default limits with WS_PING_INTERVAL, WS_IDLE_TIMEOUT, WS_WRITE_TIMEOUT,
+// WS_SEND_BUFFER, WS_MAX_PER_USER and WS_MAX_CONNECTIONS where they're set
+func LimitsFromEnv() (Limits, error) {
+	limits := DefaultLimits
+
+	for env, target := range map[string]*time.Duration{
+		"WS_PING_INTERVAL": &limits.PingInterval,
+		"WS_IDLE_TIMEOUT":  &limits.IdleTimeout,
+		"WS_WRITE_TIMEOUT": &limits.WriteTimeout,
+	} {
+		value, ok := os.LookupEnv(env)
+		if !ok {
+			continue
+		}
+
+		duration, err := time.ParseDuration(value)
+		if err != nil || duration <= 0 {
+			return Limits{}, fmt.Errorf("invalid duration for %s: %s", env, value)
+		}
+
+		*target = duration
+	}
+
+	for env, target := range map[string]*int{
+		"WS_SEND_BUFFER":     &limits.SendBuffer,
+		"WS_MAX_PER_USER":    &limits.MaxPerUser,
+		"WS_MAX_CONNECTIONS": &limits.MaxConnections,
+	} {
+		value, ok := os.LookupEnv(env)
+		if !ok {
+			continue
+		}
+
+		number, err := strconv.Atoi(value)
+		if err != nil || number < 0 {
+			return Limits{}, fmt.Errorf("invalid number for %s: %s", env, value)
+		}
+
+		*target = number
+	}
+
+	if limits.IdleTimeout <= limits.PingInterval {
+		return Limits{}, fmt.Errorf("idle timeout %s must be longer than the ping interval %s", limits.IdleTimeout, limits.PingInterval)
+	}
+
+	return limits, nil
+}
+
+// connections counts the open websockets, for each user and in total
+type connections struct {
+	lock   sync.Mutex
+	limits Limits
+	total  int
+	users  map[string]int
+}
+
+func newConnections(limits Limits) *connections {
+	return &connections{
+		limits: limits,
+		users:  map[string]int{},
+	}
+}
+
+// acquire counts a new connection for the user, or returns the status to refuse it with if they already have too
+// many or the gateway is full
+func (c *connections) acquire(user string) (int, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.limits.MaxConnections > 0 && c.total >= c.limits.MaxConnections {
+		return http.StatusServiceUnavailable, false
+	}
+
+	if c.limits.MaxPerUser > 0 && c.users[user] >= c.limits.MaxPerUser {
+		return http.StatusTooManyRequests, false
+	}
+
+	c.total++
+	c.users[user]++
+
+	return 0, true
+}
+
+func (c *connections) release(user string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.total--
+	c.users[user]--
+	if c.users[user] <= 0 {
+		delete(c.users, user)
+	}
+}
+
+// socket owns a websocket connection's writes, which all go through a single goroutine that also pings the client
+type socket struct {
+	conn     *websocket.Conn
+	limits   Limits
+	outbound chan []byte
+	done     chan struct{}
+	once     sync.Once
+}
+
+func newSocket(conn *websocket.Conn, limits Limits) *socket {
+	s := &socket{
+		conn:     conn,
+		limits:   limits,
+		outbound: make(chan []byte, limits.SendBuffer),
+		done:     make(chan struct{}),
+	}
+
+	go s.write()
+
+	return s
+}
+
+// send queues a message for the client, disconnecting clients which have fallen too far behind
+func (s *socket) send(message []byte) {
+	select {
+	case <-s.done:
+	case s.outbound <- message:
+	default:
+		logrus.Warnf("Closing websocket connection: client is too slow, %d messages waiting", len(s.outbound))
+		s.stop()
+	}
+}
+
+// stop closes the connection, once the writer has said goodbye to the client
+func (s *socket) stop() {
+	s.once.Do(func() {
+		close(s.done)
+	})
+}
+
+// stopped is closed once the connection is closing
+func (s *socket) stopped() <-chan struct{} {
+	return s.done
+}
+
+// keepAlive expects the client to send something, even if only a pong, within the idle timeout
+func (s *socket) keepAlive() {
+	s.conn.SetReadDeadline(time.Now().Add(s.limits.IdleTimeout))
+}
+
+func (s *socket) write() {
+	ticker := time.NewTicker(s.limits.PingInterval)
+	defer ticker.Stop()
+
+	defer func() {
+		s.stop()
+		s.conn.Close()
+	}()
+
+	for {
+		select {
+		case <-s.done:
+			s.conn.WriteControl(
+				websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""),
+				time.Now().Add(s.limits.WriteTimeout),
+			)
+			return
+		case message := <-s.outbound:
+			s.conn.SetWriteDeadline(time.Now().Add(s.limits.WriteTimeout))
+			err := s.conn.WriteMessage(websocket.TextMessage, message)
+			if err != nil {
+				logrus.Warnf("Closing websocket connection, failed to write: %+v", err)
+				return
+			}
+		case <-ticker.C:
+			err := s.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(s.limits.WriteTimeout))
+			if err != nil {
+				logrus.Warnf("Closing websocket connection, failed to ping: %+v", err)
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConnections(t *testing.T) {
+	open := newConnections(Limits{MaxPerUser: 2, MaxConnections: 3})
+
+	for _, user := range []string{"alice", "alice", "bob"} {
+		_, ok := open.acquire(user)
+		assert.True(t, ok)
+	}
+
+	status, ok := open.acquire("alice")
+	assert.False(t, ok)
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+
+	open.release("bob")
+
+	status, ok = open.acquire("alice")
+	assert.False(t, ok)
+	assert.Equal(t, http.StatusTooManyRequests, status)
+
+	_, ok = open.acquire("carol")
+	assert.True(t, ok)
+}
+
+func TestLimitsFromEnv(t *testing.T) {
+	t.Setenv("WS_PING_INTERVAL", "5s")
+	t.Setenv("WS_MAX_PER_USER", "0")
+
+	limits, err := LimitsFromEnv()
+	assert.NoError(t, err)
+	assert.Equal(t, 5*time.Second, limits.PingInterval)
+	assert.Equal(t, 0, limits.MaxPerUser)
+	assert.Equal(t, DefaultLimits.IdleTimeout, limits.IdleTimeout)
+
+	t.Setenv("WS_IDLE_TIMEOUT", "1s")
+	_, err = LimitsFromEnv()
+	assert.Error(t, err)
+}
+
+func TestSocket(t *testing.T) {
+	limits := Limits{
+		PingInterval: 20 * time.Millisecond,
+		IdleTimeout:  100 * time.Millisecond,
+		WriteTimeout: 100 * time.Millisecond,
+		SendBuffer:   1,
+	}
+
+	for _, test := range []struct {
+		name     string
+		read     bool
+		messages int
+		stopped  bool
+	}{
+		{
+			name:     "answers pings",
+			read:     true,
+			messages: 1,
+			stopped:  false,
+		},
+		{
+			name:     "idle client",
+			read:     false,
+			messages: 0,
+			stopped:  true,
+		},
+		{
+			name:     "slow client",
+			read:     true,
+			messages: 100,
+			stopped:  true,
+		},
+	} {
+		t.Run(test.name, func(u *testing.T) {
+			sockets := make(chan *socket, 1)
+			upgrader := websocket.Upgrader{}
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				conn, err := upgrader.Upgrade(w, r, nil)
+				if err != nil {
+					return
+				}
+
+				sock := newSocket(conn, limits)
+				watchEvents(sock)
+				sockets <- sock
+			}))
+			defer server.Close()
+
+			client, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+			if !assert.NoError(u, err) {
+				return
+			}
+			defer client.Close()
+
+			sock := <-sockets
+
+			if test.read {
+				// reading answers the server's pings
+				go func() {
+					for {
+						if _, _, err := client.ReadMessage(); err != nil {
+							return
+						}
+					}
+				}()
+			}
+
+			for i := 0; i < test.messages; i++ {
+				sock.send([]byte("message"))
+			}
+
+			select {
+			case <-sock.stopped():
+				assert.True(u, test.stopped, "socket stopped")
+			case <-time.After(300 * time.Millisecond):
+				assert.False(u, test.stopped, "socket still open")
+			}
+
+			sock.stop()
+		})
+	}
+}
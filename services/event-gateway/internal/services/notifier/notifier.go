@@ -0,0 +1,134 @@
+package notifier
+
+import (
+	"fmt"
+	"net"
+	"net/smtp"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Notifier sends messages to users about their accounts, e.g. password reset links
+type Notifier interface {
+	Notify(email string, subject string, body string) error
+}
+
+// FromEnv picks the notifier named by NOTIFIER, either "smtp" or "log". There's no default, so that a deployment
+// can't silently log its users' password reset links instead of sending them.
+func FromEnv() (Notifier, error) {
+	kind, ok := os.LookupEnv("NOTIFIER")
+	if !ok {
+		return nil, fmt.Errorf("environment variable NOTIFIER not found, expected smtp or log")
+	}
+
+	switch kind {
+	case "smtp":
+		return SMTPFromEnv()
+	case "log":
+		return &Log{Path: os.Getenv("NOTIFIER_FILE")}, nil
+	default:
+		return nil, fmt.Errorf("unknown notifier: %s", kind)
+	}
+}
+
+// SMTP emails users through a mail server
+type SMTP struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+// SMTPFromEnv reads the mail server's settings from SMTP_HOST, SMTP_PORT, SMTP_FROM and optionally SMTP_USERNAME
+// and SMTP_PASSWORD_FILE
+func SMTPFromEnv() (*SMTP, error) {
+	notifier := &SMTP{
+		Port:     "587",
+		Username: os.Getenv("SMTP_USERNAME"),
+	}
+
+	for env, target := range map[string]*string{
+		"SMTP_HOST": &notifier.Host,
+		"SMTP_FROM": &notifier.From,
+	} {
+		value, ok := os.LookupEnv(env)
+		if !ok {
+			return nil, fmt.Errorf("environment variable %s not found", env)
+		}
+
+		*target = value
+	}
+
+	if port, ok := os.LookupEnv("SMTP_PORT"); ok {
+		notifier.Port = port
+	}
+
+	if passwordFile, ok := os.LookupEnv("SMTP_PASSWORD_FILE"); ok {
+		password, err := os.ReadFile(passwordFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read smtp password: %+v", err)
+		}
+
+		notifier.Password = strings.TrimSpace(string(password))
+	}
+
+	return notifier, nil
+}
+
+func (s *SMTP) Notify(email string, subject string, body string) error {
+	var auth smtp.Auth
+	if s.Username != "" {
+		auth = smtp.PlainAuth("", s.Username, s.Password, s.Host)
+	}
+
+	message := strings.Join([]string{
+		"From: " + s.From,
+		"To: " + email,
+		"Subject: " + subject,
+		"Date: " + time.Now().Format(time.RFC1123Z),
+		"Content-Type: text/plain; charset=UTF-8",
+		"",
+		body,
+	}, "\r\n")
+
+	err := smtp.SendMail(net.JoinHostPort(s.Host, s.Port), auth, s.From, []string{email}, []byte(message))
+	if err != nil {
+		return fmt.Errorf("failed to send email to %s: %+v", email, err)
+	}
+
+	return nil
+}
+
+// Log writes messages to the log, or appends them to the file at Path if it's set, instead of sending them
+type Log struct {
+	Path string
+	lock sync.Mutex
+}
+
+func (l *Log) Notify(email string, subject string, body string) error {
+	if l.Path == "" {
+		logrus.Infof("Notifying %s: %s\n%s", email, subject, body)
+		return nil
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	file, err := os.OpenFile(l.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open notifier file: %+v", err)
+	}
+	defer file.Close()
+
+	_, err = fmt.Fprintf(file, "To: %s\nSubject: %s\n\n%s\n\n", email, subject, body)
+	if err != nil {
+		return fmt.Errorf("failed to write notification: %+v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,92 @@
+package notifier
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notifications")
+	notifier := &Log{Path: path}
+
+	assert.NoError(t, notifier.Notify("someone@example.com", "first", "hello"))
+	assert.NoError(t, notifier.Notify("other@example.com", "second", "world"))
+
+	contents, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(
+		t,
+		"To: someone@example.com\nSubject: first\n\nhello\n\nTo: other@example.com\nSubject: second\n\nworld\n\n",
+		string(contents),
+	)
+}
+
+func TestFromEnv(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		env      map[string]string
+		expected Notifier
+		err      bool
+	}{
+		{
+			name: "unset",
+			env:  map[string]string{},
+			err:  true,
+		},
+		{
+			name:     "log",
+			env:      map[string]string{"NOTIFIER": "log"},
+			expected: &Log{},
+		},
+		{
+			name:     "log file",
+			env:      map[string]string{"NOTIFIER": "log", "NOTIFIER_FILE": "/tmp/notifications"},
+			expected: &Log{Path: "/tmp/notifications"},
+		},
+		{
+			name: "smtp",
+			env:  map[string]string{"NOTIFIER": "smtp", "SMTP_HOST": "mail", "SMTP_FROM": "hub@example.com"},
+			expected: &SMTP{
+				Host: "mail",
+				Port: "587",
+				From: "hub@example.com",
+			},
+		},
+		{
+			name: "smtp without host",
+			env:  map[string]string{"NOTIFIER": "smtp", "SMTP_FROM": "hub@example.com"},
+			err:  true,
+		},
+		{
+			name: "unknown",
+			env:  map[string]string{"NOTIFIER": "pigeon"},
+			err:  true,
+		},
+	} {
+		t.Run(test.name, func(u *testing.T) {
+			for _, env := range []string{"NOTIFIER", "NOTIFIER_FILE", "SMTP_HOST", "SMTP_FROM", "SMTP_USERNAME", "SMTP_PORT", "SMTP_PASSWORD_FILE"} {
+				value, ok := os.LookupEnv(env)
+				os.Unsetenv(env)
+				if ok {
+					defer os.Setenv(env, value)
+				}
+			}
+
+			for key, value := range test.env {
+				u.Setenv(key, value)
+			}
+
+			notifier, err := FromEnv()
+			if test.err {
+				assert.Error(u, err)
+				return
+			}
+
+			assert.NoError(u, err)
+			assert.Equal(u, test.expected, notifier)
+		})
+	}
+}
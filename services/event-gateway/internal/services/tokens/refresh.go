@@ -0,0 +1,131 @@
+package tokens
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/golang-jwt/jwt"
+	"github.com/sirupsen/logrus"
+)
+
+// RefreshExpiry is how long a session lasts without being refreshed, each refresh extending it
+const RefreshExpiry = 14 * 24 * time.Hour
+
+// RefreshGrace is how long a refresh token can still be used after it's been swapped, e.g. by another tab refreshing
+// the same session at the same time, getting the token it was swapped for rather than revoking the session
+const RefreshGrace = 30 * time.Second
+
+// refreshAttempts is how many times a refresh is retried when another request changes the session at the same time
+const refreshAttempts = 3
+
+var (
+	ErrRefreshInvalid = errors.New("invalid or expired refresh token")
+	// ErrRefreshReused means a refresh token was used after it had been swapped for a new one, e.g. by someone who
+	// stole it, so its session has been revoked
+	ErrRefreshReused = errors.New("refresh token reused")
+)
+
+// refreshKey holds the id of the session's latest refresh token, the only one that can still be used
+func refreshKey(id string, session string) string {
+	return fmt.Sprintf("%s.refresh.%s", id, session)
+}
+
+// graceKey holds the id of the session's previous refresh token and the token it was swapped for, for RefreshGrace
+func graceKey(id string, session string) string {
+	return fmt.Sprintf("%s.refresh.%s.grace", id, session)
+}
+
+// Refresh swaps a refresh token for the next one in its session, returning the refresh token's claims. A token that
+// was swapped within RefreshGrace returns the token it was swapped for, with raced set, while using one that was
+// swapped before that revokes its session, returning ErrRefreshReused along with the claims.
+func (t *Tokens) Refresh(token string) (claims Claims, refreshed string, raced bool, err error) {
+	claims, err = t.Parse(token)
+	if err != nil || claims.Kind != "refresh" || claims.Session == "" {
+		return Claims{}, "", false, ErrRefreshInvalid
+	}
+
+	ctx := context.Background()
+	key := refreshKey(claims.Subject, claims.Session)
+	grace := graceKey(claims.Subject, claims.Session)
+
+	swap := func(tx *redis.Tx) error {
+		current, err := tx.Get(ctx, key).Result()
+		if err == redis.Nil {
+			return ErrRefreshInvalid
+		} else if err != nil {
+			return fmt.Errorf("failed to fetch refresh token: %+v", err)
+		}
+
+		if current != claims.ID {
+			previous, err := tx.HGetAll(ctx, grace).Result()
+			if err != nil {
+				return fmt.Errorf("failed to fetch previous refresh token: %+v", err)
+			}
+
+			if previous["id"] != claims.ID {
+				return ErrRefreshReused
+			}
+
+			refreshed = previous["next"]
+			raced = true
+			return nil
+		}
+
+		next, jti, err := t.signRefresh(claims.Subject, claims.Session)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, key, jti, RefreshExpiry)
+			pipe.Del(ctx, grace)
+			pipe.HSet(ctx, grace, "id", claims.ID, "next", next)
+			pipe.Expire(ctx, grace, RefreshGrace)
+			pipe.Expire(ctx, sessionsKey(claims.Subject), RefreshExpiry)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		refreshed = next
+		raced = false
+		return nil
+	}
+
+	// another request swapping the same token first is a race rather than a replay, so try again to pick up the
+	// token it was swapped for
+	for attempt := 0; attempt < refreshAttempts; attempt++ {
+		err = t.redis.Watch(ctx, swap, key, grace)
+		if err != redis.TxFailedErr {
+			break
+		}
+	}
+
+	if errors.Is(err, ErrRefreshReused) {
+		revokeErr := t.RevokeSession(claims.Subject, claims.Session)
+		if revokeErr != nil {
+			return claims, "", false, fmt.Errorf("failed to revoke session after refresh token reuse: %+v", revokeErr)
+		}
+
+		return claims, "", false, err
+	}
+
+	if err != nil {
+		return Claims{}, "", false, err
+	}
+
+	err = t.touchSession(claims.Subject, claims.Session)
+	if err != nil {
+		logrus.Warnf("Failed to update session %s: %+v", claims.Session, err)
+	}
+
+	return claims, refreshed, raced, nil
+}
+
+func (t *Tokens) signRefresh(id string, session string) (string, string, error) {
+	return t.sign(jwt.MapClaims{"Subject": id, "Kind": "refresh", "Session": session}, RefreshExpiry)
+}
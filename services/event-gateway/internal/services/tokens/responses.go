@@ -0,0 +1,205 @@
+package tokens
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/sirupsen/logrus"
+)
+
+// Response is a message for a user, along with its cursor in their response stream
+type Response struct {
+	Cursor  string
+	Payload string
+}
+
+var cursorPattern = regexp.MustCompile(`^\d+-\d+$`)
+
+// responseBuffer is how many responses a socket can fall behind by before it's dropped, to reconnect from its cursor
+const responseBuffer = 100
+
+// WatchResponses streams the user's responses after cursor, replaying any they missed while disconnected before
+// waiting for new ones. An empty or unknown cursor starts from the latest response. The channel is closed once ctx
+// is done, or if the responses aren't read fast enough.
+func (t *Tokens) WatchResponses(ctx context.Context, id string, cursor string) (<-chan Response, error) {
+	key := fmt.Sprintf("%s.responses", id)
+
+	if !cursorPattern.MatchString(cursor) {
+		latest, err := t.redis.XRevRangeN(ctx, key, "+", "-", 1).Result()
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch latest response: %+v", err)
+		}
+
+		cursor = "0-0"
+		if len(latest) > 0 {
+			cursor = latest[0].ID
+		}
+	}
+
+	t.readerOnce.Do(func() {
+		t.reader = &responseReader{redis: t.redis, watchers: map[string]map[*watcher]struct{}{}}
+	})
+
+	return t.reader.watch(ctx, key, cursor), nil
+}
+
+// responseReader shares one blocking XREAD between all of the gateway's websockets, rather than each one holding a
+// connection from the pool while it waits, fanning the responses out to the sockets watching each stream
+type responseReader struct {
+	redis    *redis.Client
+	lock     sync.Mutex
+	watchers map[string]map[*watcher]struct{}
+	running  bool
+	// interrupt cancels the read in progress, so that it's restarted with a newly watched stream
+	interrupt context.CancelFunc
+}
+
+type watcher struct {
+	cursor    string
+	responses chan Response
+}
+
+func (r *responseReader) watch(ctx context.Context, key string, cursor string) <-chan Response {
+	w := &watcher{cursor: cursor, responses: make(chan Response, responseBuffer)}
+
+	r.lock.Lock()
+	if r.watchers[key] == nil {
+		r.watchers[key] = map[*watcher]struct{}{}
+	}
+	r.watchers[key][w] = struct{}{}
+
+	if !r.running {
+		r.running = true
+		go r.run()
+	} else if r.interrupt != nil {
+		r.interrupt()
+	}
+	r.lock.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		r.remove(key, w)
+	}()
+
+	return w.responses
+}
+
+// remove stops sending to the watcher, closing its channel, unless it was already dropped for falling behind
+func (r *responseReader) remove(key string, w *watcher) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if _, ok := r.watchers[key][w]; !ok {
+		return
+	}
+
+	delete(r.watchers[key], w)
+	if len(r.watchers[key]) == 0 {
+		delete(r.watchers, key)
+	}
+	close(w.responses)
+}
+
+// run reads every watched stream from the earliest cursor watching it, until nothing is being watched
+func (r *responseReader) run() {
+	for {
+		r.lock.Lock()
+		if len(r.watchers) == 0 {
+			r.running = false
+			r.interrupt = nil
+			r.lock.Unlock()
+			return
+		}
+
+		keys := []string{}
+		cursors := []string{}
+		for key, watchers := range r.watchers {
+			earliest := ""
+			for w := range watchers {
+				if earliest == "" || before(w.cursor, earliest) {
+					earliest = w.cursor
+				}
+			}
+
+			keys = append(keys, key)
+			cursors = append(cursors, earliest)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		r.interrupt = cancel
+		r.lock.Unlock()
+
+		streams, err := r.redis.XRead(ctx, &redis.XReadArgs{
+			Streams: append(keys, cursors...),
+			Count:   100,
+			Block:   5 * time.Second,
+		}).Result()
+		interrupted := ctx.Err() != nil
+		cancel()
+
+		if err == redis.Nil || interrupted {
+			continue
+		} else if err != nil {
+			logrus.Errorf("failed to read responses: %+v", err)
+			time.Sleep(time.Second)
+			continue
+		}
+
+		r.lock.Lock()
+		for _, stream := range streams {
+			for _, message := range stream.Messages {
+				payload, ok := message.Values["response"].(string)
+
+				for w := range r.watchers[stream.Stream] {
+					if !before(w.cursor, message.ID) {
+						continue
+					}
+					w.cursor = message.ID
+
+					if !ok {
+						continue
+					}
+
+					select {
+					case w.responses <- Response{Cursor: message.ID, Payload: payload}:
+					default:
+						logrus.Warnf("dropping slow response watcher for %s", stream.Stream)
+						delete(r.watchers[stream.Stream], w)
+						close(w.responses)
+					}
+				}
+			}
+
+			if len(r.watchers[stream.Stream]) == 0 {
+				delete(r.watchers, stream.Stream)
+			}
+		}
+		r.lock.Unlock()
+	}
+}
+
+// before compares stream ids, which are a millisecond timestamp and a sequence number
+func before(a string, b string) bool {
+	aTime, aSeq := streamID(a)
+	bTime, bSeq := streamID(b)
+
+	return aTime < bTime || (aTime == bTime && aSeq < bSeq)
+}
+
+func streamID(id string) (uint64, uint64) {
+	parts := strings.SplitN(id, "-", 2)
+	if len(parts) != 2 {
+		return 0, 0
+	}
+
+	timestamp, _ := strconv.ParseUint(parts[0], 10, 64)
+	seq, _ := strconv.ParseUint(parts[1], 10, 64)
+
+	return timestamp, seq
+}
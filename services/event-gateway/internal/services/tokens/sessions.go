@@ -0,0 +1,210 @@
+package tokens
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/golang-jwt/jwt"
+)
+
+// Session is one of a user's logins, e.g. on their phone or their laptop, each with its own login and refresh tokens
+type Session struct {
+	ID       string    `json:"id"`
+	Device   string    `json:"device"`
+	Created  time.Time `json:"created"`
+	LastSeen time.Time `json:"lastSeen"`
+}
+
+// sessionsKey holds a hash of the user's sessions by id
+func sessionsKey(id string) string {
+	return fmt.Sprintf("%s.sessions", id)
+}
+
+func loginKey(id string, session string) string {
+	return fmt.Sprintf("%s.login.%s", id, session)
+}
+
+// NewSession starts a session for the user on the device, returning it along with its first refresh token
+func (t *Tokens) NewSession(id string, device string) (Session, string, error) {
+	random := make([]byte, 16)
+	_, err := rand.Read(random)
+	if err != nil {
+		return Session{}, "", fmt.Errorf("failed to generate session id: %+v", err)
+	}
+
+	now := time.Now()
+	session := Session{
+		ID:       hex.EncodeToString(random),
+		Device:   device,
+		Created:  now,
+		LastSeen: now,
+	}
+
+	token, jti, err := t.signRefresh(id, session.ID)
+	if err != nil {
+		return Session{}, "", err
+	}
+
+	data, err := json.Marshal(session)
+	if err != nil {
+		return Session{}, "", fmt.Errorf("failed to encode session: %+v", err)
+	}
+
+	ctx := context.Background()
+	_, err = t.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, refreshKey(id, session.ID), jti, RefreshExpiry)
+		pipe.HSet(ctx, sessionsKey(id), session.ID, string(data))
+		pipe.Expire(ctx, sessionsKey(id), RefreshExpiry)
+		return nil
+	})
+	if err != nil {
+		return Session{}, "", fmt.Errorf("failed to save session: %+v", err)
+	}
+
+	return session, token, nil
+}
+
+// NewLoginToken logs the session in until the token expires, replacing its previous login token
+func (t *Tokens) NewLoginToken(id string, session string, expiration time.Duration) (string, error) {
+	token, _, err := t.sign(jwt.MapClaims{"Subject": id, "Kind": "login", "Session": session}, expiration)
+	if err != nil {
+		return "", err
+	}
+
+	err = t.redis.Set(context.Background(), loginKey(id, session), token, expiration).Err()
+	if err != nil {
+		return "", fmt.Errorf("failed to save token: %+v", err)
+	}
+
+	return token, nil
+}
+
+// GetLoginToken returns the session's current login token, or an empty string if it has expired or been revoked
+func (t *Tokens) GetLoginToken(id string, session string) (string, error) {
+	value, err := t.redis.Get(context.Background(), loginKey(id, session)).Result()
+	if err == redis.Nil {
+		return "", nil
+	} else if err != nil {
+		return "", fmt.Errorf("failed to fetch token: %+v", err)
+	}
+
+	return value, nil
+}
+
+// LoginExpiry returns when the session's current login token expires, or the zero time if it doesn't have one
+func (t *Tokens) LoginExpiry(id string, session string) (time.Time, error) {
+	token, err := t.GetLoginToken(id, session)
+	if err != nil || token == "" {
+		return time.Time{}, err
+	}
+
+	claims, err := t.Parse(token)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return claims.Expires, nil
+}
+
+// Sessions lists the user's sessions, oldest first, forgetting those whose refresh tokens have expired
+func (t *Tokens) Sessions(id string) ([]Session, error) {
+	ctx := context.Background()
+
+	values, err := t.redis.HGetAll(ctx, sessionsKey(id)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch sessions: %+v", err)
+	}
+
+	sessions := []Session{}
+	for sessionID, value := range values {
+		active, err := t.redis.Exists(ctx, refreshKey(id, sessionID)).Result()
+		if err != nil {
+			return nil, fmt.Errorf("failed to check session %s: %+v", sessionID, err)
+		}
+
+		if active == 0 {
+			err = t.redis.HDel(ctx, sessionsKey(id), sessionID).Err()
+			if err != nil {
+				return nil, fmt.Errorf("failed to remove expired session %s: %+v", sessionID, err)
+			}
+			continue
+		}
+
+		var session Session
+		err = json.Unmarshal([]byte(value), &session)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode session %s: %+v", sessionID, err)
+		}
+
+		sessions = append(sessions, session)
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].Created.Before(sessions[j].Created)
+	})
+
+	return sessions, nil
+}
+
+// RevokeSession logs the session out, removing its login and refresh tokens, including one still in its grace window
+func (t *Tokens) RevokeSession(id string, session string) error {
+	ctx := context.Background()
+	_, err := t.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, loginKey(id, session), refreshKey(id, session), graceKey(id, session))
+		pipe.HDel(ctx, sessionsKey(id), session)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to revoke session %s: %+v", session, err)
+	}
+
+	return nil
+}
+
+// RevokeSessions logs the user out everywhere, e.g. when their password is reset
+func (t *Tokens) RevokeSessions(id string) error {
+	sessions, err := t.redis.HKeys(context.Background(), sessionsKey(id)).Result()
+	if err != nil {
+		return fmt.Errorf("failed to fetch sessions: %+v", err)
+	}
+
+	for _, session := range sessions {
+		err = t.RevokeSession(id, session)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// touchSession records that the session has just been refreshed
+func (t *Tokens) touchSession(id string, sessionID string) error {
+	ctx := context.Background()
+
+	value, err := t.redis.HGet(ctx, sessionsKey(id), sessionID).Result()
+	if err != nil {
+		return fmt.Errorf("failed to fetch session: %+v", err)
+	}
+
+	var session Session
+	err = json.Unmarshal([]byte(value), &session)
+	if err != nil {
+		return fmt.Errorf("failed to decode session: %+v", err)
+	}
+
+	session.LastSeen = time.Now()
+
+	data, err := json.Marshal(session)
+	if err != nil {
+		return fmt.Errorf("failed to encode session: %+v", err)
+	}
+
+	return t.redis.HSet(ctx, sessionsKey(id), sessionID, string(data)).Err()
+}
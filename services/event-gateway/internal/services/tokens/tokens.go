@@ -2,24 +2,33 @@ package tokens
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"io/ioutil"
+	"sync"
 	"time"
 
 	"github.com/go-redis/redis/v8"
 	"github.com/golang-jwt/jwt"
-	"github.com/sirupsen/logrus"
 	"golang.org/x/crypto/bcrypt"
 )
 
 type Claims struct {
 	Subject string
 	Kind    string
+	ID      string
+	// Session is the login that a login or refresh token belongs to
+	Session string
+	Expires time.Time
 }
 
 type Tokens struct {
 	key   []byte
 	redis *redis.Client
+	// reader is started by the first call to WatchResponses
+	reader     *responseReader
+	readerOnce sync.Once
 }
 
 func New(keyfile string, redisUrl string) (*Tokens, error) {
@@ -42,70 +51,58 @@ func New(keyfile string, redisUrl string) (*Tokens, error) {
 	return &tokens, nil
 }
 
-func (t *Tokens) WatchResponses(id string) (<-chan string, chan<- struct{}, error) {
-	key := fmt.Sprintf("%s.responses", id)
-	pubsub := t.redis.PSubscribe(context.TODO(), key)
+func (t *Tokens) DeleteToken(id string, kind string) error {
+	key := fmt.Sprintf("%s.%s", id, kind)
+	err := t.redis.Del(context.Background(), key).Err()
 
-	if pubsub == nil {
-		return nil, nil, fmt.Errorf("failed to create redis pubsub for key: %s", key)
+	if err != nil {
+		return fmt.Errorf("error deleting token %s: %+v", key, err)
 	}
 
-	responses := make(chan string)
-	stopper := make(chan struct{})
+	return nil
+}
 
-	go func(responses chan<- string, stopper <-chan struct{}, pubsub *redis.PubSub) {
-		events := pubsub.Channel()
-		for {
-			select {
-			case msg := <-events:
-				if msg == nil {
-					logrus.Errorf("pubsub closed for key: %s", key)
-					return
-				}
+// ConsumeToken deletes the user's token of the given kind if it matches token, returning whether it did, so that
+// single use tokens such as password resets can't be used twice
+func (t *Tokens) ConsumeToken(id string, kind string, token string) (bool, error) {
+	ctx := context.Background()
+	key := fmt.Sprintf("%s.%s", id, kind)
 
-				responses <- msg.Payload
-			case <-stopper:
-				return
-			}
+	consumed := false
+	err := t.redis.Watch(ctx, func(tx *redis.Tx) error {
+		current, err := tx.Get(ctx, key).Result()
+		if err == redis.Nil {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("failed to fetch token: %+v", err)
 		}
-	}(responses, stopper, pubsub)
-
-	return responses, stopper, nil
-}
 
-func (t *Tokens) GetResponses(id string) ([]string, error) {
-	key := fmt.Sprintf("%s.responses", id)
-	values, err := t.redis.LRange(context.Background(), key, 0, -1).Result()
-	if err == redis.Nil {
-		return nil, nil
-	} else if err != nil {
-		return nil, fmt.Errorf("failed to fetch responses: %+v", err)
-	}
+		if current != token {
+			return nil
+		}
 
-	return values, nil
-}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Del(ctx, key)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
 
-func (t *Tokens) RemoveResponses(id string, items int64) error {
-	logrus.Infof("Removing %d items from %s", items, id)
+		consumed = true
+		return nil
+	}, key)
 
-	key := fmt.Sprintf("%s.responses", id)
-	err := t.redis.LTrim(context.Background(), key, items, -1).Err()
-	if err != nil {
-		return fmt.Errorf("failed to clear responses: %+v", err)
+	// another request used the token first
+	if err == redis.TxFailedErr {
+		return false, nil
 	}
 
-	return nil
-}
-
-func (t *Tokens) DeleteToken(id string, kind string) error {
-	key := fmt.Sprintf("%s.%s", id, kind)
-	err := t.redis.Del(context.Background(), key).Err()
-
 	if err != nil {
-		return fmt.Errorf("error deleting token %s: %+v", key, err)
+		return false, fmt.Errorf("failed to consume token %s: %+v", key, err)
 	}
 
-	return nil
+	return consumed, nil
 }
 
 func (t *Tokens) GetToken(id string, kind string) (string, error) {
@@ -123,17 +120,9 @@ func (t *Tokens) GetToken(id string, kind string) (string, error) {
 func (t *Tokens) NewToken(id string, kind string, expiration time.Duration) (string, error) {
 	key := fmt.Sprintf("%s.%s", id, kind)
 
-	token := jwt.NewWithClaims(
-		jwt.SigningMethodHS256,
-		jwt.MapClaims{
-			"Subject": id,
-			"Kind":    kind,
-		},
-	)
-
-	tokenString, err := token.SignedString(t.key)
+	tokenString, _, err := t.sign(jwt.MapClaims{"Subject": id, "Kind": kind}, expiration)
 	if err != nil {
-		return "", fmt.Errorf("failed to sign token: %+v", err)
+		return "", err
 	}
 
 	err = t.redis.Set(context.Background(), key, tokenString, expiration).Err()
@@ -144,6 +133,29 @@ func (t *Tokens) NewToken(id string, kind string, expiration time.Duration) (str
 	return tokenString, nil
 }
 
+// sign adds the standard expiry, issued at and unique id claims to the token's own, returning the token and its id
+func (t *Tokens) sign(claims jwt.MapClaims, expiration time.Duration) (string, string, error) {
+	jti := make([]byte, 16)
+	_, err := rand.Read(jti)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to generate token id: %+v", err)
+	}
+
+	now := time.Now()
+	claims["jti"] = hex.EncodeToString(jti)
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(expiration).Unix()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+
+	tokenString, err := token.SignedString(t.key)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to sign token: %+v", err)
+	}
+
+	return tokenString, claims["jti"].(string), nil
+}
+
 func (t *Tokens) Parse(token string) (Claims, error) {
 	tokenObj, err := jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
@@ -156,15 +168,28 @@ func (t *Tokens) Parse(token string) (Claims, error) {
 		return Claims{}, fmt.Errorf("failed to parse token: %+v", err)
 	}
 
-	if claims, ok := tokenObj.Claims.(jwt.MapClaims); ok {
-		return Claims{
-			Subject: claims["Subject"].(string),
-			Kind:    claims["Kind"].(string),
-		}, nil
-
-	} else {
+	claims, ok := tokenObj.Claims.(jwt.MapClaims)
+	if !ok {
 		return Claims{}, fmt.Errorf("invalid claims in parsed token")
 	}
+
+	subject, _ := claims["Subject"].(string)
+	kind, _ := claims["Kind"].(string)
+	id, _ := claims["jti"].(string)
+	session, _ := claims["Session"].(string)
+	expires, _ := claims["exp"].(float64)
+
+	if subject == "" || kind == "" || id == "" || expires == 0 {
+		return Claims{}, fmt.Errorf("missing claims in parsed token")
+	}
+
+	return Claims{
+		Subject: subject,
+		Kind:    kind,
+		ID:      id,
+		Session: session,
+		Expires: time.Unix(int64(expires), 0),
+	}, nil
 }
 
 func (t *Tokens) AddPasswordHash(id string, password string) error {
@@ -0,0 +1,446 @@
+package tokens
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWatchResponses(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		existing []string
+		cursor   int
+		latest   []string
+		expected []string
+	}{
+		{
+			name:     "no cursor skips existing responses",
+			existing: []string{"one", "two"},
+			cursor:   -1,
+			latest:   []string{"three"},
+			expected: []string{"three"},
+		},
+		{
+			name:     "replays responses after cursor",
+			existing: []string{"one", "two", "three"},
+			cursor:   0,
+			latest:   []string{"four"},
+			expected: []string{"two", "three", "four"},
+		},
+		{
+			name:     "nothing missed",
+			existing: []string{"one"},
+			cursor:   0,
+			latest:   []string{"two"},
+			expected: []string{"two"},
+		},
+		{
+			name:     "empty stream",
+			existing: []string{},
+			cursor:   -1,
+			latest:   []string{"one", "two"},
+			expected: []string{"one", "two"},
+		},
+	} {
+		t.Run(test.name, func(u *testing.T) {
+			server := miniredis.RunT(u)
+			rdb := redis.NewClient(&redis.Options{Addr: server.Addr()})
+			tokens := &Tokens{redis: rdb}
+
+			ids := []string{}
+			for _, response := range test.existing {
+				ids = append(ids, addResponse(u, rdb, response))
+			}
+
+			cursor := ""
+			if test.cursor >= 0 {
+				cursor = ids[test.cursor]
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			responses, err := tokens.WatchResponses(ctx, "user", cursor)
+			if !assert.NoError(u, err) {
+				return
+			}
+
+			for _, response := range test.latest {
+				addResponse(u, rdb, response)
+			}
+
+			for _, expected := range test.expected {
+				select {
+				case response := <-responses:
+					assert.Equal(u, expected, response.Payload)
+					assert.NotEmpty(u, response.Cursor)
+				case <-time.After(2 * time.Second):
+					assert.FailNow(u, "timed out waiting for response", expected)
+				}
+			}
+
+			cancel()
+			for range responses {
+			}
+		})
+	}
+}
+
+func TestWatchResponsesShareConnection(t *testing.T) {
+	server := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	tokens := &Tokens{redis: rdb}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	watchers := map[string][]<-chan Response{}
+	for i := 0; i < 50; i++ {
+		user := fmt.Sprintf("user-%d", i%10)
+
+		responses, err := tokens.WatchResponses(ctx, user, "")
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		watchers[user] = append(watchers[user], responses)
+	}
+
+	for user := range watchers {
+		addUserResponse(t, rdb, user, "hello "+user)
+	}
+
+	for user, userWatchers := range watchers {
+		for _, responses := range userWatchers {
+			select {
+			case response := <-responses:
+				assert.Equal(t, "hello "+user, response.Payload)
+			case <-time.After(2 * time.Second):
+				assert.FailNow(t, "timed out waiting for response", user)
+			}
+		}
+	}
+
+	assert.LessOrEqual(t, rdb.PoolStats().TotalConns, uint32(3), "sockets don't each hold a connection")
+}
+
+func TestWatchResponsesNewStream(t *testing.T) {
+	server := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	tokens := &Tokens{redis: rdb}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	_, err := tokens.WatchResponses(ctx, "user", "")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// let the shared read start blocking on the first user's stream
+	time.Sleep(100 * time.Millisecond)
+
+	responses, err := tokens.WatchResponses(ctx, "other", "")
+	if !assert.NoError(t, err) {
+		return
+	}
+	addUserResponse(t, rdb, "other", "hello")
+
+	select {
+	case response := <-responses:
+		assert.Equal(t, "hello", response.Payload)
+	case <-time.After(time.Second):
+		assert.FailNow(t, "watching another stream didn't restart the read")
+	}
+}
+
+func TestWatchResponsesDropsSlowWatchers(t *testing.T) {
+	server := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	tokens := &Tokens{redis: rdb}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	responses, err := tokens.WatchResponses(ctx, "user", "")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	for i := 0; i <= responseBuffer; i++ {
+		addResponse(t, rdb, fmt.Sprintf("response %d", i))
+	}
+
+	assert.Eventually(t, func() bool {
+		tokens.reader.lock.Lock()
+		defer tokens.reader.lock.Unlock()
+
+		return len(tokens.reader.watchers) == 0
+	}, 2*time.Second, 10*time.Millisecond, "slow watcher wasn't dropped")
+
+	received := 0
+	for range responses {
+		received += 1
+	}
+	assert.Equal(t, responseBuffer, received)
+}
+
+func addResponse(t *testing.T, rdb *redis.Client, response string) string {
+	return addUserResponse(t, rdb, "user", response)
+}
+
+func addUserResponse(t *testing.T, rdb *redis.Client, user string, response string) string {
+	id, err := rdb.XAdd(context.Background(), &redis.XAddArgs{
+		Stream: user + ".responses",
+		Values: map[string]interface{}{"response": response},
+	}).Result()
+	if err != nil {
+		assert.FailNow(t, "failed to add response", err)
+	}
+
+	return id
+}
+
+func TestNewToken(t *testing.T) {
+	server := miniredis.RunT(t)
+	tokens := &Tokens{key: []byte("secret"), redis: redis.NewClient(&redis.Options{Addr: server.Addr()})}
+
+	token, err := tokens.NewToken("user", "login", time.Hour)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	claims, err := tokens.Parse(token)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, "user", claims.Subject)
+	assert.Equal(t, "login", claims.Kind)
+	assert.NotEmpty(t, claims.ID)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), claims.Expires, 5*time.Second)
+
+	expired, err := tokens.NewToken("user", "invite", -time.Minute)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	_, err = tokens.Parse(expired)
+	assert.Error(t, err)
+}
+
+func TestRefresh(t *testing.T) {
+	server := miniredis.RunT(t)
+	tokens := &Tokens{key: []byte("secret"), redis: redis.NewClient(&redis.Options{Addr: server.Addr()})}
+
+	session, first, err := tokens.NewSession("user", "phone")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	claims, second, raced, err := tokens.Refresh(first)
+	assert.NoError(t, err)
+	assert.False(t, raced)
+	assert.Equal(t, "user", claims.Subject)
+	assert.Equal(t, session.ID, claims.Session)
+
+	_, third, _, err := tokens.Refresh(second)
+	assert.NoError(t, err)
+
+	claims, _, _, err = tokens.Refresh(first)
+	assert.ErrorIs(t, err, ErrRefreshReused)
+	assert.Equal(t, "user", claims.Subject)
+
+	_, _, _, err = tokens.Refresh(third)
+	assert.ErrorIs(t, err, ErrRefreshInvalid, "reuse revokes the session")
+
+	login, err := tokens.NewToken("user", "login", time.Hour)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	_, _, _, err = tokens.Refresh(login)
+	assert.ErrorIs(t, err, ErrRefreshInvalid)
+}
+
+func TestRefreshGrace(t *testing.T) {
+	server := miniredis.RunT(t)
+	tokens := &Tokens{key: []byte("secret"), redis: redis.NewClient(&redis.Options{Addr: server.Addr()})}
+
+	_, first, err := tokens.NewSession("user", "phone")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	_, second, raced, err := tokens.Refresh(first)
+	assert.NoError(t, err)
+	assert.False(t, raced)
+
+	_, again, raced, err := tokens.Refresh(first)
+	assert.NoError(t, err, "another tab refreshing at the same time isn't reuse")
+	assert.True(t, raced)
+	assert.Equal(t, second, again)
+
+	server.FastForward(RefreshGrace + time.Second)
+
+	_, _, _, err = tokens.Refresh(first)
+	assert.ErrorIs(t, err, ErrRefreshReused)
+}
+
+func TestRefreshGraceSessions(t *testing.T) {
+	server := miniredis.RunT(t)
+	tokens := &Tokens{key: []byte("secret"), redis: redis.NewClient(&redis.Options{Addr: server.Addr()})}
+
+	phone, phoneRefresh, err := tokens.NewSession("user", "phone")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	_, laptopRefresh, err := tokens.NewSession("user", "laptop")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	_, _, _, err = tokens.Refresh(phoneRefresh)
+	assert.NoError(t, err)
+	_, _, _, err = tokens.Refresh(phoneRefresh)
+	assert.NoError(t, err)
+
+	sessions, err := tokens.Sessions("user")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"phone", "laptop"}, devices(sessions), "racing refreshes keep the session")
+
+	_, _, _, err = tokens.Refresh(laptopRefresh)
+	assert.NoError(t, err, "the grace window is per session")
+	_, _, _, err = tokens.Refresh(laptopRefresh)
+	assert.NoError(t, err)
+
+	assert.NoError(t, tokens.RevokeSession("user", phone.ID))
+	assert.False(t, server.Exists(graceKey("user", phone.ID)), "revoking the session forgets its previous token")
+
+	_, _, _, err = tokens.Refresh(phoneRefresh)
+	assert.ErrorIs(t, err, ErrRefreshInvalid)
+}
+
+func TestConcurrentRefresh(t *testing.T) {
+	server := miniredis.RunT(t)
+	tokens := &Tokens{key: []byte("secret"), redis: redis.NewClient(&redis.Options{Addr: server.Addr()})}
+
+	_, first, err := tokens.NewSession("user", "phone")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	results := make(chan string, 5)
+	for i := 0; i < 5; i++ {
+		go func() {
+			_, refreshed, _, err := tokens.Refresh(first)
+			assert.NoError(t, err)
+			results <- refreshed
+		}()
+	}
+
+	refreshed := map[string]bool{}
+	for i := 0; i < 5; i++ {
+		refreshed[<-results] = true
+	}
+
+	assert.Equal(t, 1, len(refreshed), "every tab gets the same refresh token")
+}
+
+func TestSessions(t *testing.T) {
+	server := miniredis.RunT(t)
+	tokens := &Tokens{key: []byte("secret"), redis: redis.NewClient(&redis.Options{Addr: server.Addr()})}
+
+	phone, phoneRefresh, err := tokens.NewSession("user", "phone")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	laptop, _, err := tokens.NewSession("user", "laptop")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	phoneLogin, err := tokens.NewLoginToken("user", phone.ID, time.Hour)
+	assert.NoError(t, err)
+	laptopLogin, err := tokens.NewLoginToken("user", laptop.ID, time.Hour)
+	assert.NoError(t, err)
+
+	claims, err := tokens.Parse(phoneLogin)
+	assert.NoError(t, err)
+	assert.Equal(t, phone.ID, claims.Session)
+
+	current, err := tokens.GetLoginToken("user", phone.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, phoneLogin, current, "logging in on the laptop keeps the phone logged in")
+
+	sessions, err := tokens.Sessions("user")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"phone", "laptop"}, devices(sessions))
+
+	assert.NoError(t, tokens.RevokeSession("user", phone.ID))
+
+	current, err = tokens.GetLoginToken("user", phone.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "", current)
+
+	expiry, err := tokens.LoginExpiry("user", phone.ID)
+	assert.NoError(t, err)
+	assert.True(t, expiry.IsZero())
+
+	_, _, _, err = tokens.Refresh(phoneRefresh)
+	assert.ErrorIs(t, err, ErrRefreshInvalid)
+
+	current, err = tokens.GetLoginToken("user", laptop.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, laptopLogin, current)
+
+	server.Del(refreshKey("user", laptop.ID))
+
+	sessions, err = tokens.Sessions("user")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{}, devices(sessions), "expired sessions are forgotten")
+}
+
+func devices(sessions []Session) []string {
+	names := []string{}
+	for _, session := range sessions {
+		names = append(names, session.Device)
+	}
+
+	return names
+}
+
+func TestConsumeToken(t *testing.T) {
+	server := miniredis.RunT(t)
+	tokens := &Tokens{key: []byte("secret"), redis: redis.NewClient(&redis.Options{Addr: server.Addr()})}
+
+	first, err := tokens.NewToken("user", "reset", time.Hour)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	second, err := tokens.NewToken("user", "reset", time.Hour)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	ok, err := tokens.ConsumeToken("user", "reset", first)
+	assert.NoError(t, err)
+	assert.False(t, ok, "replaced tokens can't be used")
+
+	ok, err = tokens.ConsumeToken("user", "reset", second)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	ok, err = tokens.ConsumeToken("user", "reset", second)
+	assert.NoError(t, err)
+	assert.False(t, ok, "tokens can only be used once")
+}
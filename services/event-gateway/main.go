@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
 	"os/signal"
@@ -10,9 +11,11 @@ import (
 	"k8s.io/client-go/kubernetes/scheme"
 	"ponglehub.co.uk/events/gateway/internal/managers/server"
 	"ponglehub.co.uk/events/gateway/internal/managers/state"
+	"ponglehub.co.uk/events/gateway/internal/services/notifier"
 	"ponglehub.co.uk/events/gateway/internal/services/tokens"
 	"ponglehub.co.uk/events/gateway/internal/services/user_store"
 	"ponglehub.co.uk/events/gateway/pkg/crds"
+	"ponglehub.co.uk/lib/events"
 )
 
 func getEnv(env string) string {
@@ -49,9 +52,33 @@ func main() {
 
 	client, tokens, store := getServices()
 
+	shutdownTracing, err := events.InitTracing(context.Background(), "event-gateway")
+	if err != nil {
+		logrus.Fatalf("Failed to initialise tracing: %+v", err)
+	}
+	defer shutdownTracing(context.Background())
+
 	origins := strings.Split(getEnv("ALLOWED_ORIGINS"), "/")
 
-	stopServer := server.Start("BROKER_URL", getEnv("TOKEN_DOMAIN"), origins, client, store, tokens)
+	limits, err := server.LimitsFromEnv()
+	if err != nil {
+		logrus.Fatalf("Failed to read websocket limits: %+v", err)
+	}
+
+	notifier, err := notifier.FromEnv()
+	if err != nil {
+		logrus.Fatalf("Failed to create notifier: %+v", err)
+	}
+
+	domain := getEnv("TOKEN_DOMAIN")
+
+	// links sent to users point here, e.g. to reset their password
+	publicURL, ok := os.LookupEnv("PUBLIC_URL")
+	if !ok {
+		publicURL = "http://" + domain
+	}
+
+	stopServer := server.Start("BROKER_URL", domain, origins, client, store, tokens, limits, notifier, publicURL)
 	defer stopServer()
 
 	stopListener := state.Start(client, store, tokens)
@@ -8,6 +8,7 @@ import (
 	"os"
 	"os/signal"
 	"strconv"
+	"syscall"
 	"time"
 
 	"github.com/cloudevents/sdk-go/v2/event"
@@ -42,9 +43,13 @@ func main() {
 
 	eventList := []event.Event{}
 
-	cancelFunc, err := events.Listen(eventPort, func(ctx context.Context, event event.Event) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	done, err := events.Listen(ctx, eventPort, func(ctx context.Context, event event.Event) error {
 		logrus.Infof("Recording event: %s", event.Type())
 		eventList = append(eventList, event)
+		return nil
 	})
 	if err != nil {
 		logrus.Fatalf("Failed to start event listener: %+v", err)
@@ -94,19 +99,22 @@ func main() {
 
 	logrus.Infof("Running server: %d, and events: %d...", serverPort, eventPort)
 
-	// Wait for interrupt signal to gracefully shutdown the server with
+	// Wait for an interrupt or terminate signal to gracefully shutdown the server with
 	// a timeout of 5 seconds.
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, os.Interrupt)
-	<-quit
+	select {
+	case <-ctx.Done():
+	case err := <-done:
+		logrus.Errorf("Event listener stopped unexpectedly: %+v", err)
+		stop()
+	}
 
 	log.Println("Shutdown Server...")
 
-	cancelFunc()
+	<-done
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
-	if err := srv.Shutdown(ctx); err != nil {
+	if err := srv.Shutdown(shutdownCtx); err != nil {
 		log.Fatal("Server Shutdown:", err)
 	}
 	log.Println("Server exiting")
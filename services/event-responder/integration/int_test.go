@@ -24,9 +24,28 @@ func clearEvents(t *testing.T, rdb *redis.Client, id string) {
 	noErr(t, rdb.Del(context.Background(), fmt.Sprintf("%s.responses", id)).Err())
 }
 
-func pubsubChannel(t *testing.T, rdb *redis.Client, id string) <-chan *redis.Message {
-	pubsub := rdb.Subscribe(context.TODO(), fmt.Sprintf("%s.responses", id))
-	return pubsub.Channel(redis.WithChannelSize(10))
+func streamChannel(ctx context.Context, rdb *redis.Client, id string) <-chan string {
+	responses := make(chan string, 10)
+
+	go func() {
+		cursor := "0"
+		for ctx.Err() == nil {
+			streams, err := rdb.XRead(ctx, &redis.XReadArgs{
+				Streams: []string{fmt.Sprintf("%s.responses", id), cursor},
+				Block:   time.Millisecond * 500,
+			}).Result()
+			if err != nil {
+				continue
+			}
+
+			for _, message := range streams[0].Messages {
+				cursor = message.ID
+				responses <- message.Values["response"].(string)
+			}
+		}
+	}()
+
+	return responses
 }
 
 func TestEvents(t *testing.T) {
@@ -50,6 +69,7 @@ func TestEvents(t *testing.T) {
 
 	const TEST_USER = "1234"
 	const OTHER_USER = "5678"
+	const TEST_CORRELATION = "abcd"
 
 	for _, test := range []struct {
 		name     string
@@ -62,7 +82,7 @@ func TestEvents(t *testing.T) {
 				{Type: "test.event", Data: "messages", UserId: TEST_USER},
 			},
 			expected: []map[string]interface{}{
-				{"data": "\"messages\"", "type": "test.event"},
+				{"correlationId": TEST_CORRELATION, "data": "\"messages\"", "type": "test.event"},
 			},
 		},
 		{
@@ -72,8 +92,8 @@ func TestEvents(t *testing.T) {
 				{Type: "another.event", Data: "message 2", UserId: TEST_USER},
 			},
 			expected: []map[string]interface{}{
-				{"data": "\"message 1\"", "type": "test.event"},
-				{"data": "\"message 2\"", "type": "another.event"},
+				{"correlationId": TEST_CORRELATION, "data": "\"message 1\"", "type": "test.event"},
+				{"correlationId": TEST_CORRELATION, "data": "\"message 2\"", "type": "another.event"},
 			},
 		},
 		{
@@ -83,7 +103,7 @@ func TestEvents(t *testing.T) {
 				{Type: "another.event", Data: "message 2", UserId: OTHER_USER},
 			},
 			expected: []map[string]interface{}{
-				{"data": "\"message 1\"", "type": "test.event"},
+				{"correlationId": TEST_CORRELATION, "data": "\"message 1\"", "type": "test.event"},
 			},
 		},
 		{
@@ -93,7 +113,7 @@ func TestEvents(t *testing.T) {
 				{Type: "another.event", Data: "message 2", UserId: TEST_USER},
 			},
 			expected: []map[string]interface{}{
-				{"data": "\"message 2\"", "type": "another.event"},
+				{"correlationId": TEST_CORRELATION, "data": "\"message 2\"", "type": "another.event"},
 			},
 		},
 	} {
@@ -101,17 +121,15 @@ func TestEvents(t *testing.T) {
 			clearEvents(u, rdb, TEST_USER)
 			clearEvents(u, rdb, OTHER_USER)
 
-			pubsub := rdb.Subscribe(context.TODO(), TEST_USER+".responses")
-			defer pubsub.Close()
-			responseChannel := pubsub.Channel(redis.WithChannelSize(10))
-
-			time.Sleep(time.Millisecond * 500)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			responseChannel := streamChannel(ctx, rdb, TEST_USER)
 
 			for _, event := range test.events {
 				client.Send(
 					event.Type,
 					event.Data,
-					map[string]interface{}{"userid": event.UserId},
+					map[string]interface{}{"userid": event.UserId, events.CorrelationIDExtension: TEST_CORRELATION},
 				)
 			}
 
@@ -119,7 +137,7 @@ func TestEvents(t *testing.T) {
 				select {
 				case actual := <-responseChannel:
 					data, _ := json.Marshal(expected)
-					assert.Equal(u, string(data), actual.Payload)
+					assert.Equal(u, string(data), actual)
 				case <-time.After(time.Second * 2):
 					assert.FailNow(u, "timed out waiting for event")
 				}
@@ -0,0 +1,43 @@
+package server
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cloudevents/sdk-go/v2/event"
+	"github.com/sirupsen/logrus"
+	"ponglehub.co.uk/lib/events"
+)
+
+type Store interface {
+	AddEvent(ctx context.Context, id string, event event.Event) error
+}
+
+func Start(ctx context.Context, transport events.Transport, address string, store Store) (<-chan error, error) {
+	return transport.Listen(ctx, address, func(ctx context.Context, event event.Event) error {
+		userIdObj, err := event.Context.GetExtension("userid")
+		if err != nil {
+			logrus.Errorf("Failed to get user id from event: %+v", err)
+			return nil
+		}
+
+		userId, ok := userIdObj.(string)
+		if !ok {
+			logrus.Errorf("Expected user id to be a string, got %T", userIdObj)
+			return nil
+		}
+
+		if userId == "" {
+			logrus.Infof("Not responding to event %s, empty userId", event.Type())
+			return nil
+		}
+
+		err = store.AddEvent(ctx, userId, event)
+		if err != nil {
+			return fmt.Errorf("failed to store event %s: %+v", event.Type(), err)
+		}
+
+		logrus.Infof("Stored event '%s' for user '%s'", event.Type(), userId)
+		return nil
+	})
+}
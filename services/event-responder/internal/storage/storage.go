@@ -4,9 +4,21 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"time"
 
 	"github.com/cloudevents/sdk-go/v2/event"
 	"github.com/go-redis/redis/v8"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"ponglehub.co.uk/lib/events"
+)
+
+const (
+	// MaxResponses is roughly how many responses are kept for each user, for the gateway to replay to reconnecting
+	// players
+	MaxResponses = 100
+	// ResponseTTL removes the responses of users who haven't had any for a while
+	ResponseTTL = 24 * time.Hour
 )
 
 type Storage struct {
@@ -27,20 +39,35 @@ func New(redisUrl string) (*Storage, error) {
 	return &storage, nil
 }
 
-func (s *Storage) AddEvent(id string, event event.Event) error {
+func (s *Storage) AddEvent(ctx context.Context, id string, event event.Event) error {
 	key := fmt.Sprintf("%s.responses", id)
 
+	ctx, span := events.StartSpan(ctx, "store "+event.Type(), trace.WithAttributes(attribute.String("redis.key", key)))
+	defer span.End()
+
 	data, err := json.Marshal(map[string]interface{}{
-		"type": event.Type(),
-		"data": string(event.Data()),
+		"type":          event.Type(),
+		"data":          string(event.Data()),
+		"correlationId": events.CorrelationID(event),
 	})
 	if err != nil {
+		span.RecordError(err)
 		return fmt.Errorf("failed to marshal event data: %+v", err)
 	}
 
-	err = s.redis.Publish(context.Background(), key, string(data)).Err()
+	_, err = s.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.XAdd(ctx, &redis.XAddArgs{
+			Stream: key,
+			MaxLen: MaxResponses,
+			Approx: true,
+			Values: map[string]interface{}{"response": string(data)},
+		})
+		pipe.Expire(ctx, key, ResponseTTL)
+		return nil
+	})
 	if err != nil {
-		return fmt.Errorf("failed to publish event to redis: %+v", err)
+		span.RecordError(err)
+		return fmt.Errorf("failed to add event to response stream: %+v", err)
 	}
 
 	return nil
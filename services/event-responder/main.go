@@ -5,10 +5,12 @@ import (
 	"log"
 	"os"
 	"os/signal"
+	"syscall"
 
-	"github.com/cloudevents/sdk-go/v2/event"
+	"github.com/cloudevents/sdk-go/v2/protocol/http"
 	"github.com/sirupsen/logrus"
 
+	"ponglehub.co.uk/events/responder/internal/server"
 	"ponglehub.co.uk/events/responder/internal/storage"
 	"ponglehub.co.uk/lib/events"
 )
@@ -29,43 +31,33 @@ func main() {
 		logrus.Fatalf("Failed to create storage client: %+v", err)
 	}
 
-	cancelFunc, err := events.Listen(80, func(ctx context.Context, event event.Event) {
-		userIdObj, err := event.Context.GetExtension("userid")
-		if err != nil {
-			logrus.Errorf("Failed to get user id from event: %+v", err)
-			return
-		}
-
-		userId, ok := userIdObj.(string)
-		if !ok {
-			logrus.Errorf("Expected user id to be a string, got %T", userId)
-			return
-		}
-
-		if userId == "" {
-			logrus.Infof("Not responding to event %s, empty userId", event.Type())
-			return
-		}
+	shutdownTracing, err := events.InitTracing(context.Background(), "event-responder")
+	if err != nil {
+		logrus.Fatalf("Failed to initialise tracing: %+v", err)
+	}
+	defer shutdownTracing(context.Background())
 
-		err = store.AddEvent(userId, event)
-		if err != nil {
-			logrus.Errorf("Failed to store event %s: %+v", event.Type(), err)
-			return
-		}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-		logrus.Infof("Stored event '%s' for user '%s'", event.Type(), userId)
+	transport, err := events.NewHTTPTransport(events.HTTPTransportArgs{
+		ListenOptions: []http.Option{http.WithGetHandlerFunc(events.MetricsHandler().ServeHTTP)},
 	})
+	if err != nil {
+		logrus.Fatalf("Failed to create event transport: %+v", err)
+	}
+
+	done, err := server.Start(ctx, transport, ":80", store)
 	if err != nil {
 		logrus.Fatalf("Failed to start event listener: %+v", err)
 	}
-	defer cancelFunc()
 
 	logrus.Infof("Running...")
 
-	// Wait for interrupt signal to gracefully shutdown the server
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, os.Interrupt)
-	<-quit
+	err = <-done
+	if err != nil {
+		logrus.Fatalf("Event listener stopped unexpectedly: %+v", err)
+	}
 
-	log.Println("Shutdown Server...")
+	log.Println("Stopped")
 }
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"context"
+
 	"github.com/sirupsen/logrus"
 	"ponglehub.co.uk/games/naughts-and-crosses/pkg/database"
 	"ponglehub.co.uk/games/naughts-and-crosses/pkg/routes"
@@ -10,19 +12,30 @@ import (
 func main() {
 	logrus.Infof("Starting server...")
 
+	shutdownTracing, err := events.InitTracing(context.Background(), "naughts-and-crosses")
+	if err != nil {
+		logrus.Fatalf("failed to initialise tracing: %+v", err)
+	}
+	defer shutdownTracing(context.Background())
+
 	db, err := database.New()
 	if err != nil {
 		logrus.Fatalf("failed to create database client: %+v", err)
 	}
 
-	err = events.Serve(events.ServeParams{
+	err = events.Serve(context.Background(), events.ServeParams{
 		BrokerEnv: "BROKER_URL",
 		Source:    "naughts-and-crosses",
-		Routes: events.EventRoutes{
-			"naughts-and-crosses.list-games": routes.ListGames(db),
-			"naughts-and-crosses.new-game":   routes.NewGame(db),
-			"naughts-and-crosses.load-game":  routes.LoadGame(db),
-			"naughts-and-crosses.mark":       routes.Mark(db),
+		Metrics:   true,
+		Middlewares: []events.Middleware{
+			events.Logging(),
+			events.RateLimit(10, 20),
+		},
+		Handlers: events.TypedRoutes{
+			"naughts-and-crosses.list-games": events.Handle(routes.ListGames(db)),
+			"naughts-and-crosses.new-game":   events.Handle(routes.NewGame(db)),
+			"naughts-and-crosses.load-game":  events.Handle(routes.LoadGame(db)),
+			"naughts-and-crosses.mark":       events.Handle(routes.Mark(db)),
 		},
 	})
 	if err != nil {
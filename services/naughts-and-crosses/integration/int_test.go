@@ -1,6 +1,7 @@
 package integration
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -150,7 +151,7 @@ func TestNewGameEvent(t *testing.T) {
 
 	recorder.WaitForEvent(t, os.Getenv("RECORDER_URL"), "naughts-and-crosses.new-game.response")
 
-	games, err := db.ListGames(userId)
+	games, err := db.ListGames(context.Background(), userId)
 	noErr(t, err)
 
 	assertGames(t, []Game{{Player1: opponentId, Player2: userId, Turn: 0}}, games)
@@ -41,12 +41,12 @@ func (d *Database) Clear() error {
 	return nil
 }
 
-func (d *Database) NewGame(player1 string, player2 string) (Game, error) {
+func (d *Database) NewGame(ctx context.Context, player1 string, player2 string) (Game, error) {
 	logrus.Infof("Creating new game for %s vs %s", player1, player2)
 	created := time.Now()
 
 	row := d.conn.QueryRow(
-		context.TODO(),
+		ctx,
 		"INSERT INTO games (player1, player2, created_time, turn, marks, finished) VALUES ($1, $2, $3, 0, '---------', false) RETURNING id;",
 		player1,
 		player2,
@@ -93,9 +93,9 @@ type Game struct {
 	Finished bool
 }
 
-func (d *Database) ListGames(player string) ([]Game, error) {
+func (d *Database) ListGames(ctx context.Context, player string) ([]Game, error) {
 	logrus.Infof("Listing games for user %s", player)
-	rows, err := d.conn.Query(context.TODO(), "SELECT id, player1, player2, created_time, turn, finished FROM games WHERE player1=$1 OR player2=$1", player)
+	rows, err := d.conn.Query(ctx, "SELECT id, player1, player2, created_time, turn, finished FROM games WHERE player1=$1 OR player2=$1", player)
 	if err != nil {
 		return nil, fmt.Errorf("error fetching games data: %+v", err)
 	}
@@ -116,9 +116,9 @@ func (d *Database) ListGames(player string) ([]Game, error) {
 	return games, nil
 }
 
-func (d *Database) LoadGame(id string) (*Game, string, error) {
+func (d *Database) LoadGame(ctx context.Context, id string) (*Game, string, error) {
 	logrus.Infof("Loading game %s", id)
-	rows, err := d.conn.Query(context.TODO(), "SELECT id, player1, player2, created_time, turn, marks, finished FROM games WHERE id=$1", id)
+	rows, err := d.conn.Query(ctx, "SELECT id, player1, player2, created_time, turn, marks, finished FROM games WHERE id=$1", id)
 	if err != nil {
 		return nil, "", fmt.Errorf("error fetching game data: %+v", err)
 	}
@@ -139,10 +139,10 @@ func (d *Database) LoadGame(id string) (*Game, string, error) {
 	return &game, marks, nil
 }
 
-func (d *Database) SetMarks(id string, turn int16, marks string, finished bool) error {
+func (d *Database) SetMarks(ctx context.Context, id string, turn int16, marks string, finished bool) error {
 	logrus.Infof("Updating game %s", id)
 
-	_, err := d.conn.Exec(context.TODO(), "UPDATE games SET turn=$1, marks=$2, finished=$3 WHERE id=$4", turn, marks, finished, id)
+	_, err := d.conn.Exec(ctx, "UPDATE games SET turn=$1, marks=$2, finished=$3 WHERE id=$4", turn, marks, finished, id)
 	if err != nil {
 		return fmt.Errorf("error setting mark data: %+v", err)
 	}
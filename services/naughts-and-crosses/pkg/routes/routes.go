@@ -1,6 +1,7 @@
 package routes
 
 import (
+	"context"
 	"errors"
 	"fmt"
 
@@ -11,122 +12,93 @@ import (
 	"ponglehub.co.uk/lib/events"
 )
 
-func ListGames(db *database.Database) events.EventRoute {
-	return func(userId string, into events.EventParser) ([]events.Response, error) {
-		games, err := db.ListGames(userId)
+type GamesResponse struct {
+	Games []database.Game `json:"games"`
+}
+
+type GameResponse struct {
+	Game database.Game `json:"game"`
+}
+
+type GameStateResponse struct {
+	Game  *database.Game `json:"game"`
+	Marks string         `json:"marks"`
+}
+
+type NewGameRequest struct {
+	Opponent string `json:"opponent"`
+}
+
+type LoadGameRequest struct {
+	ID string `json:"id"`
+}
+
+type MarkRequest struct {
+	Game     string `json:"game"`
+	Position int    `json:"position"`
+}
+
+func ListGames(db *database.Database) events.Handler[events.Empty, GamesResponse] {
+	return func(ctx context.Context, userId string, _ events.Empty) ([]events.Reply[GamesResponse], error) {
+		games, err := db.ListGames(ctx, userId)
 		if err != nil {
 			return nil, fmt.Errorf("failed to list games: %+v", err)
 		}
 
-		return []events.Response{{
-			EventType: "response",
-			Data:      map[string]interface{}{"games": games},
-			UserId:    userId,
+		return []events.Reply[GamesResponse]{{
+			Data:   GamesResponse{Games: games},
+			UserId: userId,
 		}}, nil
 	}
 }
 
-func NewGame(db *database.Database) events.EventRoute {
-	return func(userId string, into events.EventParser) ([]events.Response, error) {
-		data := struct {
-			Opponent string `json:"opponent"`
-		}{}
-
-		err := into(&data)
-		if err != nil {
-			return nil, fmt.Errorf("failed to parse payload data from event: %+v", err)
-		}
-
-		game, err := db.NewGame(data.Opponent, userId)
+func NewGame(db *database.Database) events.Handler[NewGameRequest, GameResponse] {
+	return func(ctx context.Context, userId string, data NewGameRequest) ([]events.Reply[GameResponse], error) {
+		game, err := db.NewGame(ctx, data.Opponent, userId)
 		if err != nil {
 			return nil, fmt.Errorf("failed to create new game: %+v", err)
 		}
 
-		responses := []events.Response{}
+		replies := []events.Reply[GameResponse]{}
 
 		for _, id := range []string{userId, data.Opponent} {
-			responses = append(responses, events.Response{
-				EventType: "response",
-				Data:      map[string]database.Game{"game": game},
-				UserId:    id,
+			replies = append(replies, events.Reply[GameResponse]{
+				Data:   GameResponse{Game: game},
+				UserId: id,
 			})
 		}
 
-		return responses, nil
+		return replies, nil
 	}
 }
 
-func LoadGame(db *database.Database) events.EventRoute {
-	return func(userId string, into events.EventParser) ([]events.Response, error) {
-		data := struct {
-			ID string `json:"id"`
-		}{}
-
-		err := into(&data)
+func LoadGame(db *database.Database) events.Handler[LoadGameRequest, GameStateResponse] {
+	return func(ctx context.Context, userId string, data LoadGameRequest) ([]events.Reply[GameStateResponse], error) {
+		game, marks, err := db.LoadGame(ctx, data.ID)
 		if err != nil {
-			return nil, fmt.Errorf("failed to parse payload data from event: %+v", err)
+			return nil, fmt.Errorf("failed to load game data: %+v", err)
 		}
 
-		game, marks, err := db.LoadGame(data.ID)
-		if err != nil {
-			return []events.Response{{
-					EventType: "rejection.response",
-					Data:      nil,
-					UserId:    userId,
-				}},
-				fmt.Errorf("failed to load game data: %+v", err)
-		}
-
-		return []events.Response{{
-				EventType: "response",
-				Data:      map[string]interface{}{"game": game, "marks": marks},
-				UserId:    userId,
-			}},
-			nil
+		return []events.Reply[GameStateResponse]{{
+			Data:   GameStateResponse{Game: game, Marks: marks},
+			UserId: userId,
+		}}, nil
 	}
 }
 
-func Mark(db *database.Database) events.EventRoute {
-	return func(userId string, into events.EventParser) ([]events.Response, error) {
-		data := struct {
-			Game     string `json:"game"`
-			Position int    `json:"position"`
-		}{}
-
-		err := into(&data)
-		if err != nil {
-			return nil, fmt.Errorf("failed to parse payload data from event: %+v", err)
-		}
-
-		game, marks, err := db.LoadGame(data.Game)
+func Mark(db *database.Database) events.Handler[MarkRequest, GameStateResponse] {
+	return func(ctx context.Context, userId string, data MarkRequest) ([]events.Reply[GameStateResponse], error) {
+		game, marks, err := db.LoadGame(ctx, data.Game)
 		if err != nil {
-			return []events.Response{{
-					EventType: "rejection.response",
-					Data:      map[string]interface{}{"reason": "server error"},
-					UserId:    userId,
-				}},
-				fmt.Errorf("failed to load game data: %+v", err)
+			return nil, fmt.Errorf("failed to load game data: %+v", err)
 		}
 
 		fail := rules.Validate(game, marks, userId, data.Position)
 		if fail != nil {
-			return []events.Response{{
-					EventType: "rejection.response",
-					Data:      map[string]interface{}{"reason": fail.Response()},
-					UserId:    userId,
-				}},
-				errors.New(fail.Log())
+			return nil, events.Reject(fail.Response(), errors.New(fail.Log()))
 		}
 
 		marks = rules.PlaceMark(marks, data.Position, game.Turn)
-		if err != nil {
-			return []events.Response{{
-					EventType: "rejection.response",
-					Data:      map[string]interface{}{"reason": "server error"},
-					UserId:    userId,
-				}},
-				fmt.Errorf("failed to load game data: %+v", err)
-		}
 
 		winner := rules.IsWinner(marks, data.Position)
 		tie := rules.IsTie(marks)
@@ -142,25 +114,19 @@ func Mark(db *database.Database) events.EventRoute {
 			game.Turn = rules.NextTurn(game.Turn)
 		}
 
-		err = db.SetMarks(data.Game, game.Turn, marks, game.Finished)
+		err = db.SetMarks(ctx, data.Game, game.Turn, marks, game.Finished)
 		if err != nil {
-			return []events.Response{{
-					EventType: "rejection.response",
-					Data:      map[string]interface{}{"reason": "server error"},
-					UserId:    userId,
-				}},
-				fmt.Errorf("failed to set marks back in database: %+v", err)
+			return nil, fmt.Errorf("failed to set marks back in database: %+v", err)
 		}
 
-		responses := []events.Response{}
+		replies := []events.Reply[GameStateResponse]{}
 		for _, uuid := range []uuid.UUID{game.Player1, game.Player2} {
-			responses = append(responses, events.Response{
-				EventType: "response",
-				Data:      map[string]interface{}{"game": game, "marks": marks},
-				UserId:    uuid.String(),
+			replies = append(replies, events.Reply[GameStateResponse]{
+				Data:   GameStateResponse{Game: game, Marks: marks},
+				UserId: uuid.String(),
 			})
 		}
 
-		return responses, nil
+		return replies, nil
 	}
 }
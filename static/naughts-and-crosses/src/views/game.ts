@@ -152,11 +152,11 @@ export class GameView extends LitElement {
 
   private list(id: string) {
     this.events.send("auth.list-friends", null);
-    this.events.send("naughts-and-crosses.load-game", {id});
+    this.events.send("naughts-and-crosses.load-game", {id}, id);
   }
 
   private select(index: number) {
-    this.events.send("naughts-and-crosses.mark", {game: this.gameId, position: index})
+    this.events.send("naughts-and-crosses.mark", {game: this.gameId, position: index}, this.gameId)
   }
 
   private async logOut() {
@@ -0,0 +1,236 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/urfave/cli/v2"
+	"ponglehub.co.uk/events/broker/pkg/admin"
+)
+
+var BrokerCommand = cli.Command{
+	Name:        "broker",
+	Description: "commands to inspect the event broker",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:    "url",
+			Aliases: []string{"u"},
+			Value:   "http://localhost:3002",
+			Usage:   "the broker's admin address, from a port forward to its admin port",
+		},
+		&cli.StringFlag{
+			Name:    "token",
+			EnvVars: []string{"BROKER_ADMIN_TOKEN"},
+			Usage:   "the broker's admin token, as in its ADMIN_TOKEN_FILE",
+		},
+	},
+	Subcommands: []*cli.Command{
+		&BrokerRoutesCommand,
+		&BrokerTestRouteCommand,
+		&BrokerDeliveriesCommand,
+		&BrokerEventsCommand,
+		&BrokerReplayCommand,
+	},
+}
+
+func brokerClient(c *cli.Context) *admin.Client {
+	return admin.NewClient(c.String("url"), c.String("token"))
+}
+
+var BrokerRoutesCommand = cli.Command{
+	Name:        "routes",
+	Description: "list the routing table",
+	Action: func(c *cli.Context) error {
+		routes, err := brokerClient(c).Routes()
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "FILTER\tTRIGGER\tURL")
+		for _, route := range routes {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", route.Filter, route.Trigger, route.URL)
+		}
+
+		return w.Flush()
+	},
+}
+
+var BrokerTestRouteCommand = cli.Command{
+	Name:        "test-route",
+	Description: "list where an event would be sent",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:     "type",
+			Aliases:  []string{"t"},
+			Required: true,
+		},
+		&cli.StringSliceFlag{
+			Name:    "attribute",
+			Aliases: []string{"a"},
+			Usage:   "an attribute or extension for attribute filters, as name=value",
+		},
+	},
+	Action: func(c *cli.Context) error {
+		attributes := map[string]string{}
+		for _, attribute := range c.StringSlice("attribute") {
+			parts := strings.SplitN(attribute, "=", 2)
+			if len(parts) != 2 {
+				return fmt.Errorf("expected attribute as name=value, got %s", attribute)
+			}
+
+			attributes[parts[0]] = parts[1]
+		}
+
+		targets, err := brokerClient(c).TestRoute(c.String("type"), attributes)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "TRIGGER\tURL")
+		for _, target := range targets {
+			fmt.Fprintf(w, "%s\t%s\n", target.Trigger, target.URL)
+		}
+
+		return w.Flush()
+	},
+}
+
+var BrokerDeliveriesCommand = cli.Command{
+	Name:        "deliveries",
+	Description: "list the deliveries in flight and those which failed recently",
+	Action: func(c *cli.Context) error {
+		deliveries, err := brokerClient(c).Deliveries()
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+
+		fmt.Fprintln(w, "IN FLIGHT\tTYPE\tID\tURL")
+		for _, delivery := range deliveries.InFlight {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", time.Since(delivery.Started).Round(time.Millisecond), delivery.EventType, delivery.EventID, delivery.URL)
+		}
+
+		fmt.Fprintln(w, "\nFAILED\tTYPE\tID\tURL\tSTATUS\tERROR")
+		for _, failure := range deliveries.Failed {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\n", failure.Finished.Format(time.RFC3339), failure.EventType, failure.EventID, failure.URL, failure.StatusCode, failure.Error)
+		}
+
+		return w.Flush()
+	},
+}
+
+var eventQueryFlags = []cli.Flag{
+	&cli.DurationFlag{
+		Name:    "since",
+		Aliases: []string{"s"},
+		Value:   time.Hour,
+		Usage:   "how far back to look, ignored if --from is set",
+	},
+	&cli.TimestampFlag{
+		Name:   "from",
+		Layout: time.RFC3339,
+		Usage:  "the start of the time range, e.g. 2006-01-02T15:04:05Z",
+	},
+	&cli.TimestampFlag{
+		Name:   "to",
+		Layout: time.RFC3339,
+		Usage:  "the end of the time range, defaults to now",
+	},
+	&cli.StringFlag{
+		Name:    "filter",
+		Aliases: []string{"f"},
+		Usage:   "a CESQL expression the events must match, e.g. \"subject = 'some-user'\"",
+	},
+}
+
+func eventQuery(c *cli.Context) admin.EventQuery {
+	query := admin.EventQuery{
+		From:   time.Now().Add(-c.Duration("since")),
+		Filter: c.String("filter"),
+	}
+
+	if from := c.Timestamp("from"); from != nil {
+		query.From = *from
+	}
+
+	if to := c.Timestamp("to"); to != nil {
+		query.To = *to
+	}
+
+	return query
+}
+
+var BrokerEventsCommand = cli.Command{
+	Name:        "events",
+	Description: "list the events in the broker's event store",
+	Flags: append([]cli.Flag{
+		&cli.IntFlag{
+			Name:    "limit",
+			Aliases: []string{"l"},
+			Value:   100,
+		},
+		&cli.Int64Flag{
+			Name:  "after",
+			Usage: "only list events after this sequence number, to page through the results",
+		},
+	}, eventQueryFlags...),
+	Action: func(c *cli.Context) error {
+		records, err := brokerClient(c).Events(eventQuery(c), c.Int64("after"), c.Int("limit"))
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "SEQ\tRECEIVED\tTYPE\tSOURCE\tSUBJECT\tID")
+		for _, record := range records {
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\n", record.Seq, record.Received.Format(time.RFC3339), record.Event.Type(), record.Event.Source(), record.Event.Subject(), record.Event.ID())
+		}
+
+		return w.Flush()
+	},
+}
+
+var BrokerReplayCommand = cli.Command{
+	Name:        "replay",
+	Description: "re-deliver stored events to a trigger, if the trigger's filters still match them",
+	Flags: append([]cli.Flag{
+		&cli.StringFlag{
+			Name:     "trigger",
+			Aliases:  []string{"t"},
+			Required: true,
+			Usage:    "the trigger to replay events to, as namespace/name",
+		},
+	}, eventQueryFlags...),
+	Action: func(c *cli.Context) error {
+		client := brokerClient(c)
+
+		job, err := client.Replay(c.String("trigger"), eventQuery(c))
+		if err != nil {
+			return err
+		}
+
+		// the broker replays in the background, so poll until it's done
+		for job.Status == admin.ReplayRunning {
+			time.Sleep(time.Second)
+
+			job, err = client.ReplayStatus(job.ID)
+			if err != nil {
+				return err
+			}
+		}
+
+		fmt.Printf("replayed %d events, %d failed\n", job.Replayed, job.Failed)
+
+		if job.Status == admin.ReplayFailed {
+			return fmt.Errorf("replay stopped early: %s", job.Error)
+		}
+
+		return nil
+	},
+}
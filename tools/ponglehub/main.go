@@ -18,6 +18,7 @@ func main() {
 		Description: "admin cli for the ponglehub app",
 		Commands: []*cli.Command{
 			&commands.UserCommand,
+			&commands.BrokerCommand,
 		},
 	}
 